@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/kborovik/gcp-iam/config"
 	"github.com/kborovik/gcp-iam/db"
@@ -14,19 +15,92 @@ type DBAction func(ctx context.Context, cmd *cli.Command, cfg *config.Config, da
 
 // WithDB wraps a command action with config loading and database initialization.
 // This eliminates the need to repeat config and database setup in every command.
+// Inside an interactive shell session the session's config and open database are reused,
+// unless the line gives --config, --db or --profile; those load their own config and database.
 func WithDB(action DBAction) func(context.Context, *cli.Command) error {
 	return func(ctx context.Context, cmd *cli.Command) error {
-		cfg, err := config.Load()
+		if session := SessionFrom(ctx); session != nil && !overridesConfig(cmd) {
+			return action(ctx, cmd, session.Config, session.DB)
+		}
+
+		cfg, err := LoadConfig(cmd)
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		database, err := db.New(cfg.DatabasePath)
+		database, err := OpenDB(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to open database: %w", err)
 		}
 		defer database.Close()
 
+		warnIfStale(ctx, cmd, cfg, database)
 		return action(ctx, cmd, cfg, database)
 	}
 }
+
+// LoadConfig loads the config selected by the global flags and writes a warning to stderr
+// for every unknown key or relative database path it tolerated
+func LoadConfig(cmd *cli.Command) (*config.Config, error) {
+	cfg, err := config.LoadWith(LoadOptions(cmd))
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", w)
+	}
+	return cfg, nil
+}
+
+// LoadOptions returns the config overrides given by the global --config, --db and --profile flags
+func LoadOptions(cmd *cli.Command) config.Options {
+	return config.Options{
+		ConfigPath:   cmd.String("config"),
+		DatabasePath: cmd.String("db"),
+		Profile:      cmd.String("profile"),
+	}
+}
+
+// overridesConfig reports whether any of the global --config, --db and --profile flags is set
+func overridesConfig(cmd *cli.Command) bool {
+	return cmd.IsSet("config") || cmd.IsSet("db") || cmd.IsSet("profile")
+}
+
+// OpenDB opens the database configured in cfg, read-only if cfg.ReadOnly is set
+func OpenDB(cfg *config.Config) (*db.DB, error) {
+	var opts []db.Option
+	if cfg.ReadOnly {
+		opts = append(opts, db.WithReadOnly())
+	}
+	return db.New(cfg.DatabasePath, opts...)
+}
+
+// Session holds state shared by commands run from an interactive shell
+type Session struct {
+	Config *config.Config
+	DB     *db.DB
+
+	// Last is the result list of the most recent command that produced one
+	Last []string
+}
+
+type sessionKey struct{}
+
+// WithSession returns a context carrying the shell session
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFrom returns the shell session carried by ctx, or nil outside the shell
+func SessionFrom(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// Record stores the names a command listed as the session's last result.
+// It is a no-op outside the shell.
+func Record(ctx context.Context, results []string) {
+	if session := SessionFrom(ctx); session != nil {
+		session.Last = results
+	}
+}
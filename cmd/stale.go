@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/urfave/cli/v3"
+)
+
+// SkipStaleCheck is the command metadata key that disables the stale data warning,
+// for commands that update or report the data age themselves
+const SkipStaleCheck = "skipStaleCheck"
+
+// warnIfStale writes a warning to stderr when any updated resource is older than the
+// configured stale_after. Resources that were never updated are not reported.
+func warnIfStale(ctx context.Context, cmd *cli.Command, cfg *config.Config, database *db.DB) {
+	threshold := cfg.StaleThreshold()
+	if threshold == 0 || cmd.Metadata[SkipStaleCheck] == true {
+		return
+	}
+
+	for _, resource := range db.Resources {
+		last, err := database.LastUpdateContext(ctx, resource)
+		if err != nil || last.IsZero() || time.Since(last) <= threshold {
+			continue
+		}
+		writeStaleWarning(os.Stderr, resource, last)
+		return
+	}
+}
+
+func writeStaleWarning(w io.Writer, resource string, last time.Time) {
+	flag := "--roles"
+	if resource == db.ResourceServices {
+		flag = "--services"
+	}
+	fmt.Fprintf(w, "Warning: %s were last updated %s ago (%s); run 'gcp-iam update %s' to refresh\n",
+		resource, FormatAge(time.Since(last)), last.Local().Format(time.DateOnly), flag)
+}
+
+// FormatAge renders an age in the largest whole unit, e.g. "45 days" or "3 hours"
+func FormatAge(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case d >= 24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int(d/time.Minute), "minute")
+	}
+}
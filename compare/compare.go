@@ -0,0 +1,144 @@
+package compare
+
+import "sort"
+
+// RolePermissions is the permission set of a single role
+type RolePermissions struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// Result is the comparison of the permission sets of several roles
+type Result struct {
+	Roles  []string            `json:"roles"`
+	Common []string            `json:"common"`
+	Unique map[string][]string `json:"unique"`
+	// Similarity[i][j] is the Jaccard similarity of the permission sets of Roles[i] and Roles[j]
+	Similarity [][]float64 `json:"similarity"`
+}
+
+// Row is a permission of the permission × role matrix
+type Row struct {
+	Permission string `json:"permission"`
+	// Granted reports, in the order of the compared roles, whether each role grants Permission
+	Granted []bool `json:"granted"`
+	Change  Change `json:"change"`
+}
+
+// Report is a Result with the full permission × role matrix
+type Report struct {
+	Result
+	Matrix []Row `json:"matrix"`
+
+	// roleTotals keeps the permission count of each role once Filter dropped matrix rows
+	roleTotals []int
+}
+
+// Compare returns the permissions common to all roles, the permissions unique to each role
+// and the similarity of every pair of roles. All permission lists in the result are sorted.
+func Compare(roles []RolePermissions) Result {
+	result := Result{
+		Roles:      make([]string, 0, len(roles)),
+		Common:     []string{},
+		Unique:     make(map[string][]string, len(roles)),
+		Similarity: Similarity(roles),
+	}
+
+	// count how many roles grant each permission
+	counts := make(map[string]int)
+	for _, rp := range roles {
+		result.Roles = append(result.Roles, rp.Role)
+		for perm := range toSet(rp.Permissions) {
+			counts[perm]++
+		}
+	}
+
+	for perm, count := range counts {
+		if count == len(roles) {
+			result.Common = append(result.Common, perm)
+		}
+	}
+	sort.Strings(result.Common)
+
+	for _, rp := range roles {
+		unique := []string{}
+		for perm := range toSet(rp.Permissions) {
+			if counts[perm] == 1 {
+				unique = append(unique, perm)
+			}
+		}
+		sort.Strings(unique)
+		result.Unique[rp.Role] = unique
+	}
+
+	return result
+}
+
+// NewReport compares roles and adds the matrix of every permission granted by any of them
+func NewReport(roles []RolePermissions) Report {
+	return Report{Result: Compare(roles), Matrix: Matrix(roles)}
+}
+
+// Matrix returns every permission granted by any of roles, sorted, with the roles granting it
+func Matrix(roles []RolePermissions) []Row {
+	sets := make([]map[string]bool, len(roles))
+	union := make(map[string]bool)
+	for i, rp := range roles {
+		sets[i] = toSet(rp.Permissions)
+		for perm := range sets[i] {
+			union[perm] = true
+		}
+	}
+
+	perms := make([]string, 0, len(union))
+	for perm := range union {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+
+	rows := make([]Row, len(perms))
+	for i, perm := range perms {
+		rows[i] = Row{Permission: perm, Granted: make([]bool, len(roles))}
+		for j, set := range sets {
+			rows[i].Granted[j] = set[perm]
+		}
+		rows[i].Change = change(rows[i].Granted)
+	}
+	return rows
+}
+
+// Similarity returns the Jaccard similarity (shared permissions divided by the permissions
+// of either role) of every pair of roles. Two roles without permissions are identical.
+func Similarity(roles []RolePermissions) [][]float64 {
+	sets := make([]map[string]bool, len(roles))
+	for i, rp := range roles {
+		sets[i] = toSet(rp.Permissions)
+	}
+
+	similarity := make([][]float64, len(roles))
+	for i := range sets {
+		similarity[i] = make([]float64, len(roles))
+		for j := range sets {
+			shared := 0
+			for perm := range sets[i] {
+				if sets[j][perm] {
+					shared++
+				}
+			}
+			if union := len(sets[i]) + len(sets[j]) - shared; union > 0 {
+				similarity[i][j] = float64(shared) / float64(union)
+			} else {
+				similarity[i][j] = 1
+			}
+		}
+	}
+	return similarity
+}
+
+func toSet(perms []string) map[string]bool {
+	set := make(map[string]bool, len(perms))
+	for _, perm := range perms {
+		set[perm] = true
+	}
+	return set
+}
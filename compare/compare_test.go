@@ -0,0 +1,63 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	result := Compare([]RolePermissions{
+		{Role: "a", Permissions: []string{"x.get", "x.list", "y.get"}},
+		{Role: "b", Permissions: []string{"x.list", "x.get", "z.get"}},
+		{Role: "c", Permissions: []string{"x.get", "x.list", "z.get"}},
+	})
+
+	if !reflect.DeepEqual(result.Common, []string{"x.get", "x.list"}) {
+		t.Errorf("Expected common [x.get x.list], got %v", result.Common)
+	}
+
+	expected := map[string][]string{
+		"a": {"y.get"},
+		"b": {},
+		"c": {},
+	}
+	if !reflect.DeepEqual(result.Unique, expected) {
+		t.Errorf("Expected unique %v, got %v", expected, result.Unique)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	similarity := Similarity([]RolePermissions{
+		{Role: "a", Permissions: []string{"x.get", "x.list"}},
+		{Role: "b", Permissions: []string{"x.get", "x.list", "x.create", "x.delete"}},
+		{Role: "c", Permissions: []string{"y.get"}},
+		{Role: "d"},
+		{Role: "e"},
+	})
+
+	expected := [][]float64{
+		{1, 0.5, 0, 0, 0},
+		{0.5, 1, 0, 0, 0},
+		{0, 0, 1, 0, 0},
+		{0, 0, 0, 1, 1},
+		{0, 0, 0, 1, 1},
+	}
+	if !reflect.DeepEqual(similarity, expected) {
+		t.Errorf("Expected similarity %v, got %v", expected, similarity)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	rows := Matrix([]RolePermissions{
+		{Role: "a", Permissions: []string{"y.get", "x.get"}},
+		{Role: "b", Permissions: []string{"x.get", "x.get"}},
+	})
+
+	expected := []Row{
+		{Permission: "x.get", Granted: []bool{true, true}, Change: ChangeCommon},
+		{Permission: "y.get", Granted: []bool{true, false}, Change: ChangeRemoved},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected matrix %v, got %v", expected, rows)
+	}
+}
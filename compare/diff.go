@@ -0,0 +1,162 @@
+package compare
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Change classifies a permission against the first compared role, the base of a diff
+type Change string
+
+const (
+	// ChangeCommon permissions are granted by every role
+	ChangeCommon Change = "common"
+	// ChangeRemoved permissions are granted by the first role but not by every other role
+	ChangeRemoved Change = "removed"
+	// ChangeAdded permissions are not granted by the first role but by another role
+	ChangeAdded Change = "added"
+)
+
+func change(granted []bool) Change {
+	if !granted[0] {
+		return ChangeAdded
+	}
+	if slices.Contains(granted[1:], false) {
+		return ChangeRemoved
+	}
+	return ChangeCommon
+}
+
+// GroupBy lists the ways permissions can be grouped
+var GroupBy = []string{"service", "resource"}
+
+// GroupKey returns the group of permission: its service ("storage" for
+// "storage.buckets.get") or its resource ("storage.buckets"). Any other by gives no group.
+func GroupKey(permission, by string) string {
+	parts := strings.SplitN(permission, ".", 3)
+	switch {
+	case by == "service":
+		return parts[0]
+	case by == "resource" && len(parts) > 1:
+		return parts[0] + "." + parts[1]
+	case by == "resource":
+		return parts[0]
+	default:
+		return ""
+	}
+}
+
+// Filter returns report with only the matrix rows whose change is one of changes.
+// The role totals still count every permission. Without changes the report is returned unchanged.
+func (r Report) Filter(changes ...Change) Report {
+	if len(changes) == 0 {
+		return r
+	}
+	r.roleTotals = r.totals()
+
+	rows := []Row{}
+	for _, row := range r.Matrix {
+		if slices.Contains(changes, row.Change) {
+			rows = append(rows, row)
+		}
+	}
+	r.Matrix = rows
+	return r
+}
+
+// ANSI escape sequences used by WriteDiff
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// WriteList prints permissions one per line, under a header per group when groupBy is set
+func WriteList(w io.Writer, permissions []string, groupBy string) {
+	writeGrouped(w, permissions, groupBy, "", "")
+}
+
+// writeGrouped prints permissions with indent and marker, starting a new group with an
+// indented "[group]" header whenever the group of the permission changes
+func writeGrouped(w io.Writer, permissions []string, groupBy, indent, marker string) {
+	group := ""
+	for i, perm := range permissions {
+		if key := GroupKey(perm, groupBy); key != "" && (i == 0 || key != group) {
+			fmt.Fprintf(w, "%s[%s]\n", indent, key)
+			group = key
+		}
+		fmt.Fprintf(w, "%s%s%s\n", indent, marker, perm)
+	}
+}
+
+// WriteDiff prints the matrix of report as a unified diff from the first role to the other
+// roles: common permissions are context lines, removed ones start with '-' and added ones
+// with '+'. Each group of groupBy is a hunk; without grouping the whole list is one hunk.
+// color adds ANSI colors.
+func WriteDiff(w io.Writer, report Report, groupBy string, color bool) {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + ansiReset
+	}
+
+	if len(report.Roles) == 0 {
+		return
+	}
+	fmt.Fprintln(w, paint(ansiBold, "--- "+report.Roles[0]))
+	fmt.Fprintln(w, paint(ansiBold, "+++ "+strings.Join(report.Roles[1:], ", ")))
+
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(report.Matrix); {
+		group := GroupKey(report.Matrix[start].Permission, groupBy)
+		end := start
+		for end < len(report.Matrix) && GroupKey(report.Matrix[end].Permission, groupBy) == group {
+			end++
+		}
+		hunk := report.Matrix[start:end]
+
+		oldCount, newCount := 0, 0
+		for _, row := range hunk {
+			if row.Change != ChangeAdded {
+				oldCount++
+			}
+			if row.Change != ChangeRemoved {
+				newCount++
+			}
+		}
+
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		if group != "" {
+			header += " " + group
+		}
+		fmt.Fprintln(w, paint(ansiCyan, header))
+
+		for _, row := range hunk {
+			switch row.Change {
+			case ChangeRemoved:
+				fmt.Fprintln(w, paint(ansiRed, "-"+row.Permission))
+			case ChangeAdded:
+				fmt.Fprintln(w, paint(ansiGreen, "+"+row.Permission))
+			default:
+				fmt.Fprintln(w, " "+row.Permission)
+			}
+		}
+
+		oldLine += oldCount
+		newLine += newCount
+		start = end
+	}
+}
+
+// hunkRange formats the line range of a hunk; an empty range refers to the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
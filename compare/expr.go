@@ -0,0 +1,220 @@
+package compare
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Expr is a set-algebra expression over the permissions of roles, such as
+// "editor - viewer & compute.admin". Operators:
+//
+//	a & b  permissions granted by both a and b
+//	a | b  permissions granted by a or b (also a + b)
+//	a - b  permissions granted by a but not by b
+//
+// & binds tighter than | and -, which apply from left to right, so the example above
+// is editor - (viewer & compute.admin). Parentheses group explicitly. A '-' only
+// subtracts at the start of a word, so "a-b" is a single role name.
+type Expr struct {
+	root  exprNode
+	roles []string
+}
+
+type exprNode interface {
+	eval(permissions map[string]map[string]bool) map[string]bool
+}
+
+type roleNode string
+
+func (n roleNode) eval(permissions map[string]map[string]bool) map[string]bool {
+	return permissions[string(n)]
+}
+
+type opNode struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n opNode) eval(permissions map[string]map[string]bool) map[string]bool {
+	left, right := n.left.eval(permissions), n.right.eval(permissions)
+	result := make(map[string]bool)
+	switch n.op {
+	case '&':
+		for perm := range left {
+			if right[perm] {
+				result[perm] = true
+			}
+		}
+	case '|':
+		for perm := range left {
+			result[perm] = true
+		}
+		for perm := range right {
+			result[perm] = true
+		}
+	case '-':
+		for perm := range left {
+			if !right[perm] {
+				result[perm] = true
+			}
+		}
+	}
+	return result
+}
+
+// token is a role name or a single-character operator at a 1-based column of the expression
+type token struct {
+	text   string
+	column int
+}
+
+// ParseExpr parses a set-algebra expression, reporting the column of syntax errors
+func ParseExpr(s string) (*Expr, error) {
+	p := &exprParser{tokens: tokenize(s), end: len(s) + 1}
+	root, err := p.union()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("column %d: unexpected '%s'", tok.column, tok.text)
+	}
+	return &Expr{root: root, roles: p.roles}, nil
+}
+
+// Roles returns the role names in the expression, each once, in order of appearance
+func (e *Expr) Roles() []string {
+	return e.roles
+}
+
+// Eval returns the sorted permissions the expression selects, given the permissions of
+// every role in Roles
+func (e *Expr) Eval(permissions map[string][]string) []string {
+	sets := make(map[string]map[string]bool, len(permissions))
+	for role, perms := range permissions {
+		sets[role] = toSet(perms)
+	}
+
+	result := []string{}
+	for perm := range e.root.eval(sets) {
+		result = append(result, perm)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.IndexByte("()&|+-", c) >= 0:
+			tokens = append(tokens, token{text: string(c), column: i + 1})
+			i++
+		default:
+			start := i
+			for i < len(s) && strings.IndexByte(" \t\n()&|+", s[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, token{text: s[start:i], column: start + 1})
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	end    int
+	roles  []string
+}
+
+func (p *exprParser) peek() (token, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return token{}, false
+}
+
+// union parses terms joined by |, + and -
+func (p *exprParser) union() (exprNode, error) {
+	left, err := p.intersection()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || (tok.text != "|" && tok.text != "+" && tok.text != "-") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.intersection()
+		if err != nil {
+			return nil, err
+		}
+		op := tok.text[0]
+		if op == '+' {
+			op = '|'
+		}
+		left = opNode{op: op, left: left, right: right}
+	}
+}
+
+// intersection parses operands joined by &
+func (p *exprParser) intersection() (exprNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.text != "&" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		left = opNode{op: '&', left: left, right: right}
+	}
+}
+
+// operand parses a role name or a parenthesized expression
+func (p *exprParser) operand() (exprNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("column %d: expected a role name", p.end)
+	}
+	p.pos++
+
+	switch tok.text {
+	case "(":
+		node, err := p.union()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, fmt.Errorf("column %d: missing ')' for '(' at column %d", p.column(), tok.column)
+		}
+		p.pos++
+		return node, nil
+	case ")", "&", "|", "+", "-":
+		return nil, fmt.Errorf("column %d: expected a role name, got '%s'", tok.column, tok.text)
+	}
+
+	if !slices.Contains(p.roles, tok.text) {
+		p.roles = append(p.roles, tok.text)
+	}
+	return roleNode(tok.text), nil
+}
+
+// column returns the column of the next token, or the end of the expression
+func (p *exprParser) column() int {
+	if tok, ok := p.peek(); ok {
+		return tok.column
+	}
+	return p.end
+}
@@ -0,0 +1,61 @@
+package compare
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	permissions := map[string][]string{
+		"editor":        {"a.get", "a.list", "a.update", "b.get", "b.update"},
+		"viewer":        {"a.get", "a.list", "b.get"},
+		"compute.admin": {"a.update", "b.update", "c.get"},
+		"roles/x-y":     {"x.get"},
+	}
+
+	tests := []struct {
+		expr  string
+		roles []string
+		want  []string
+	}{
+		{"editor - viewer", []string{"editor", "viewer"}, []string{"a.update", "b.update"}},
+		{"editor - viewer & compute.admin", []string{"editor", "viewer", "compute.admin"}, []string{"a.get", "a.list", "a.update", "b.get", "b.update"}},
+		{"(editor - viewer) & compute.admin", []string{"editor", "viewer", "compute.admin"}, []string{"a.update", "b.update"}},
+		{"viewer | compute.admin - editor", []string{"viewer", "compute.admin", "editor"}, []string{"c.get"}},
+		{"viewer + roles/x-y", []string{"viewer", "roles/x-y"}, []string{"a.get", "a.list", "b.get", "x.get"}},
+		{"viewer&viewer", []string{"viewer"}, []string{"a.get", "a.list", "b.get"}},
+		{"viewer - viewer", []string{"viewer"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.expr, err)
+		}
+		if !reflect.DeepEqual(expr.Roles(), tt.roles) {
+			t.Errorf("%q: expected roles %v, got %v", tt.expr, tt.roles, expr.Roles())
+		}
+		if got := expr.Eval(permissions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                  "column 1: expected a role name",
+		"editor -":          "column 9: expected a role name",
+		"editor & & viewer": "column 10: expected a role name, got '&'",
+		"(editor - viewer":  "column 17: missing ')' for '(' at column 1",
+		"editor viewer":     "column 8: unexpected 'viewer'",
+		"editor )":          "column 8: unexpected ')'",
+	}
+
+	for expr, want := range tests {
+		_, err := ParseExpr(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error %q, got %v", expr, want, err)
+		}
+	}
+}
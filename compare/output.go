@@ -0,0 +1,222 @@
+package compare
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats lists the output formats of role compare
+var Formats = []string{"text", "matrix", "csv", "json"}
+
+// Options control how Write prints a report
+type Options struct {
+	// Titles maps role names to their titles for the text format
+	Titles map[string]string
+	// Changes keeps only the matrix rows with these changes; the text format then lists
+	// just those permissions
+	Changes []Change
+	// GroupBy groups permission lists and diff hunks, one of GroupBy or empty
+	GroupBy string
+	// Diff prints the text format as a unified diff from the first role to the others
+	Diff bool
+	// Color adds ANSI colors to the diff
+	Color bool
+}
+
+// Check reports an unknown format or grouping and options that do not apply to format
+func (opts Options) Check(format string) error {
+	if !slices.Contains(Formats, format) {
+		return fmt.Errorf("invalid format '%s': expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	if opts.GroupBy != "" && !slices.Contains(GroupBy, opts.GroupBy) {
+		return fmt.Errorf("invalid grouping '%s': expected one of %s", opts.GroupBy, strings.Join(GroupBy, ", "))
+	}
+	if opts.Diff && format != "text" {
+		return fmt.Errorf("a diff can only be printed in the text format, not %s", format)
+	}
+	return nil
+}
+
+// Write prints report in format, one of Formats
+func Write(w io.Writer, format string, report Report, opts Options) error {
+	if err := opts.Check(format); err != nil {
+		return err
+	}
+
+	report = report.Filter(opts.Changes...)
+	switch format {
+	case "text":
+		switch {
+		case opts.Diff:
+			WriteDiff(w, report, opts.GroupBy, opts.Color)
+		case len(opts.Changes) > 0:
+			permissions := make([]string, len(report.Matrix))
+			for i, row := range report.Matrix {
+				permissions[i] = row.Permission
+			}
+			WriteList(w, permissions, opts.GroupBy)
+		default:
+			WriteText(w, report, opts.Titles, opts.GroupBy)
+		}
+		return nil
+	case "matrix":
+		WriteMatrix(w, report)
+		return nil
+	case "csv":
+		return WriteCSV(w, report)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return nil
+}
+
+// WriteText prints the roles, their common and unique permissions grouped by groupBy,
+// their similarity and a summary
+func WriteText(w io.Writer, report Report, titles map[string]string, groupBy string) {
+	fmt.Fprintf(w, "Comparing roles:\n")
+	for i, role := range report.Roles {
+		fmt.Fprintf(w, "  Role %d: %s (%s)\n", i+1, role, titles[role])
+	}
+
+	fmt.Fprintf(w, "\nCommon permissions (%d):\n", len(report.Common))
+	writeGrouped(w, report.Common, groupBy, "  ", "✓ ")
+
+	// Like a diff from the first role, its own permissions are marked "-" and those of the others "+"
+	for i, role := range uniqueRoles(report.Roles) {
+		marker := "+ "
+		if i == 0 {
+			marker = "- "
+		}
+		fmt.Fprintf(w, "\nPermissions only in '%s' (%d):\n", role, len(report.Unique[role]))
+		writeGrouped(w, report.Unique[role], groupBy, "  ", marker)
+	}
+
+	fmt.Fprintf(w, "\nSimilarity (Jaccard):\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "\t")
+	for i := range report.Roles {
+		fmt.Fprintf(tw, "%d\t", i+1)
+	}
+	fmt.Fprintln(tw)
+	for i, row := range report.Similarity {
+		fmt.Fprintf(tw, "%d\t", i+1)
+		for _, value := range row {
+			fmt.Fprintf(tw, "%.2f\t", value)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	totals := report.totals()
+	fmt.Fprintf(w, "\nSummary:\n")
+	for i, role := range report.Roles {
+		fmt.Fprintf(w, "  Total permissions in '%s': %d\n", role, totals[i])
+	}
+	fmt.Fprintf(w, "  Common permissions: %d\n", len(report.Common))
+	for _, role := range uniqueRoles(report.Roles) {
+		fmt.Fprintf(w, "  Unique to '%s': %d\n", role, len(report.Unique[role]))
+	}
+}
+
+// WriteMatrix prints the permission × role matrix as a table, with the roles numbered
+// in the header to keep the columns narrow
+func WriteMatrix(w io.Writer, report Report) {
+	for i, role := range report.Roles {
+		fmt.Fprintf(w, "%d: %s\n", i+1, role)
+	}
+	fmt.Fprintln(w)
+
+	permWidth := len("PERMISSION")
+	for _, row := range report.Matrix {
+		permWidth = max(permWidth, len(row.Permission))
+	}
+	colWidth := len(strconv.Itoa(len(report.Roles)))
+
+	fmt.Fprintf(w, "%-*s", permWidth, "PERMISSION")
+	for i := range report.Roles {
+		fmt.Fprintf(w, "  %*d", colWidth, i+1)
+	}
+	fmt.Fprintln(w)
+
+	// The marks are padded by hand because they are one column wide but several bytes long
+	pad := strings.Repeat(" ", colWidth-1)
+	for _, row := range report.Matrix {
+		fmt.Fprintf(w, "%-*s", permWidth, row.Permission)
+		for _, granted := range row.Granted {
+			mark := "·"
+			if granted {
+				mark = "✓"
+			}
+			fmt.Fprintf(w, "  %s%s", pad, mark)
+		}
+		fmt.Fprintln(w)
+	}
+
+	totals := report.totals()
+	fmt.Fprintf(w, "%-*s", permWidth, "TOTAL")
+	for _, total := range totals {
+		fmt.Fprintf(w, "  %*d", colWidth, total)
+	}
+	fmt.Fprintln(w)
+}
+
+// WriteCSV prints the permission × role matrix as CSV with 1 where a role grants a permission
+func WriteCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"permission"}, report.Roles...)); err != nil {
+		return err
+	}
+	for _, row := range report.Matrix {
+		record := make([]string, 0, len(row.Granted)+1)
+		record = append(record, row.Permission)
+		for _, granted := range row.Granted {
+			if granted {
+				record = append(record, "1")
+			} else {
+				record = append(record, "0")
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// totals counts the permissions of each role, including matrix rows dropped by Filter
+func (r Report) totals() []int {
+	if r.roleTotals != nil {
+		return r.roleTotals
+	}
+	totals := make([]int, len(r.Roles))
+	for _, row := range r.Matrix {
+		for i, granted := range row.Granted {
+			if granted {
+				totals[i]++
+			}
+		}
+	}
+	return totals
+}
+
+// uniqueRoles drops repeated role names, which share one entry in Result.Unique
+func uniqueRoles(roles []string) []string {
+	seen := make(map[string]bool, len(roles))
+	var unique []string
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+	return unique
+}
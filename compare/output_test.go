@@ -0,0 +1,81 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	report := NewReport([]RolePermissions{
+		{Role: "a", Permissions: []string{"x.get", "x.list"}},
+		{Role: "b", Permissions: []string{"x.get"}},
+	})
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "csv", report, Options{}); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	if expected := "permission,a,b\nx.get,1,1\nx.list,1,0\n"; buf.String() != expected {
+		t.Errorf("Expected CSV %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := Write(&buf, "matrix", report, Options{}); err != nil {
+		t.Fatalf("Failed to write matrix: %v", err)
+	}
+	if !strings.Contains(buf.String(), "x.list      ✓  ·") || !strings.Contains(buf.String(), "TOTAL       2  1") {
+		t.Errorf("Unexpected matrix:\n%s", buf.String())
+	}
+
+	// Totals count every permission of a role, not just the rows left by a filter
+	buf.Reset()
+	if err := Write(&buf, "matrix", report, Options{Changes: []Change{ChangeRemoved}}); err != nil {
+		t.Fatalf("Failed to write filtered matrix: %v", err)
+	}
+	if strings.Contains(buf.String(), "x.get") || !strings.Contains(buf.String(), "TOTAL       2  1") {
+		t.Errorf("Unexpected filtered matrix:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Write(&buf, "text", report, Options{Titles: map[string]string{"a": "Role A"}}); err != nil {
+		t.Fatalf("Failed to write text: %v", err)
+	}
+	for _, want := range []string{"Role 1: a (Role A)", "Permissions only in 'a' (1):\n  - x.list\n", "  1  1.00  0.50", "Unique to 'b': 0"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected text output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := Write(&buf, "json", report, Options{}); err != nil {
+		t.Fatalf("Failed to write JSON: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if len(decoded.Matrix) != 2 || decoded.Similarity[0][1] != 0.5 {
+		t.Errorf("Unexpected JSON report: %+v", decoded)
+	}
+
+	if err := Write(&buf, "yaml", report, Options{}); err == nil {
+		t.Error("Expected unknown format to fail")
+	}
+}
+
+func TestWriteTextMarkers(t *testing.T) {
+	report := NewReport([]RolePermissions{
+		{Role: "a", Permissions: []string{"x.get", "x.list"}},
+		{Role: "b", Permissions: []string{"x.get", "x.update"}},
+	})
+
+	var buf bytes.Buffer
+	WriteText(&buf, report, nil, "")
+	for _, want := range []string{"  ✓ x.get\n", "Permissions only in 'a' (1):\n  - x.list\n", "Permissions only in 'b' (1):\n  + x.update\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected text output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package completion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/constants"
+)
+
+// The completion cache saves every TAB from opening SQLite and scanning the ~11k
+// permissions. It holds the role, permission and service names of one database, sorted
+// and grouped by their first dotted component (the service, as in "storage" for
+// "storage.buckets.get"), behind an index of the groups, so a lookup reads the index and
+// only the groups matching the word being completed:
+//
+//	gcp-iam completion cache 1
+//	stamp <database size> <database modification time>
+//	<section> TAB <group> TAB <offset> TAB <length>
+//	...
+//	<empty line>
+//	<name> TAB <description> LF ...
+//
+// Offsets are relative to the first byte after the empty line. The stamp ties the cache
+// to the database file, so any change to the database makes it stale.
+
+const cacheHeader = "gcp-iam completion cache 1"
+
+// ErrStaleCache is returned by LookupCache when the cache is missing or older than the database
+var ErrStaleCache = errors.New("completion cache is missing or out of date")
+
+// CachePath returns the completion cache file of the database at dbPath. Caches live in
+// the user's cache directory so read-only shared databases get one too.
+func CachePath(dbPath string) (string, error) {
+	dir, err := config.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	if abs, err := filepath.Abs(dbPath); err == nil {
+		dbPath = abs
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(dbPath))
+	return filepath.Join(dir, fmt.Sprintf("completion-%016x.cache", h.Sum64())), nil
+}
+
+// Candidates returns the names of section (one of db.Resources) starting with word. They
+// come from the cache when it is current; otherwise they are read from the database
+// opened by open and the cache is rebuilt for the next completion.
+func Candidates(ctx context.Context, dbPath string, open func() (*db.DB, error), section, word string) ([]Candidate, error) {
+	candidates, err := LookupCache(dbPath, section, word)
+	if !errors.Is(err, ErrStaleCache) {
+		return candidates, err
+	}
+
+	stamp, err := databaseStamp(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	sections, err := loadSections(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Completion works without a cache, e.g. when the cache directory is not writable
+	if path, err := CachePath(dbPath); err == nil {
+		_ = writeCache(path, stamp, sections)
+	}
+
+	return filterPrefix(sections[section], word), nil
+}
+
+// RebuildCache replaces the completion cache of the database at dbPath with the names in
+// database, which must be the database opened from dbPath
+func RebuildCache(ctx context.Context, database *db.DB, dbPath string) error {
+	// Stamp before reading so changes made meanwhile leave the cache stale
+	stamp, err := databaseStamp(dbPath)
+	if err != nil {
+		return err
+	}
+
+	sections, err := loadSections(ctx, database)
+	if err != nil {
+		return err
+	}
+
+	path, err := CachePath(dbPath)
+	if err != nil {
+		return err
+	}
+	return writeCache(path, stamp, sections)
+}
+
+// LookupCache returns the names of section starting with word from the completion cache
+// of the database at dbPath, or an ErrStaleCache error if the cache is missing, corrupt or
+// does not match the database
+func LookupCache(dbPath, section, word string) ([]Candidate, error) {
+	stamp, err := databaseStamp(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := CachePath(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrStaleCache
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("%w: %s is truncated", ErrStaleCache, path)
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	if header, err := readLine(); err != nil || header != cacheHeader {
+		return nil, ErrStaleCache
+	}
+	if line, err := readLine(); err != nil || line != "stamp "+stamp {
+		return nil, ErrStaleCache
+	}
+
+	// Groups of a section are stored in name order, so the groups matching a word
+	// without a dot are adjacent and read in one piece
+	key, dotted := groupKey(word)
+	bodyStart := int64(len(cacheHeader) + len("stamp ") + len(stamp) + 2)
+	start, end := int64(-1), int64(-1)
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		bodyStart += int64(len(line) + 1)
+		if line == "" {
+			break
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 || fields[0] != section {
+			continue
+		}
+		if (dotted && fields[1] != key) || (!dotted && !strings.HasPrefix(fields[1], key)) {
+			continue
+		}
+		offset, err1 := strconv.ParseInt(fields[2], 10, 64)
+		length, err2 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%w: %s has a bad index line %q", ErrStaleCache, path, line)
+		}
+		if start < 0 || offset < start {
+			start = offset
+		}
+		end = max(end, offset+length)
+	}
+	if start < 0 {
+		return nil, nil
+	}
+
+	body := make([]byte, end-start)
+	if _, err := f.ReadAt(body, bodyStart+start); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read completion cache %s: %w", path, err)
+	}
+
+	var candidates []Candidate
+	for line := range bytes.Lines(body) {
+		name, desc, _ := strings.Cut(strings.TrimSuffix(string(line), "\n"), "\t")
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, Candidate{Name: name, Description: desc})
+		}
+	}
+	return candidates, nil
+}
+
+// groupKey returns the group of names starting with word, and whether word contains the
+// whole group name; otherwise every group starting with the returned prefix matches
+func groupKey(word string) (string, bool) {
+	key, _, dotted := strings.Cut(word, ".")
+	return key, dotted
+}
+
+// databaseStamp identifies the current content of the database file
+func databaseStamp(dbPath string) (string, error) {
+	info, err := os.Stat(dbPath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// loadSections reads the names of every section from database
+func loadSections(ctx context.Context, database *db.DB) (map[string][]Candidate, error) {
+	roles, err := database.GetAllRolesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+	permissions, err := database.GetPermissionNamesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+	services, err := database.GetAllServicesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services: %w", err)
+	}
+
+	sections := map[string][]Candidate{}
+	for _, role := range roles {
+		sections[db.ResourceRoles] = append(sections[db.ResourceRoles], Candidate{Name: role.Name, Description: role.Title})
+	}
+	for _, permission := range permissions {
+		sections[db.ResourcePermissions] = append(sections[db.ResourcePermissions], Candidate{Name: permission})
+	}
+	for _, service := range services {
+		sections[db.ResourceServices] = append(sections[db.ResourceServices], Candidate{Name: service.Name, Description: service.Title})
+	}
+	return sections, nil
+}
+
+// writeCache writes sections to path, replacing the previous cache atomically so
+// concurrent completions never read a partial file
+func writeCache(path, stamp string, sections map[string][]Candidate) error {
+	var index, body bytes.Buffer
+	fmt.Fprintf(&index, "%s\nstamp %s\n", cacheHeader, stamp)
+
+	for _, section := range db.Resources {
+		candidates := slices.Clone(sections[section])
+		slices.SortFunc(candidates, func(a, b Candidate) int { return strings.Compare(a.Name, b.Name) })
+
+		for i := 0; i < len(candidates); {
+			key, _ := groupKey(candidates[i].Name)
+			offset := body.Len()
+			for ; i < len(candidates); i++ {
+				if k, _ := groupKey(candidates[i].Name); k != key {
+					break
+				}
+				desc := strings.Join(strings.Fields(candidates[i].Description), " ")
+				fmt.Fprintf(&body, "%s\t%s\n", candidates[i].Name, desc)
+			}
+			fmt.Fprintf(&index, "%s\t%s\t%d\t%d\n", section, key, offset, body.Len()-offset)
+		}
+	}
+	index.WriteByte('\n')
+
+	if err := os.MkdirAll(filepath.Dir(path), constants.DefaultDirPermissions); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write completion cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(append(index.Bytes(), body.Bytes()...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write completion cache: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// filterPrefix returns the candidates whose name starts with word
+func filterPrefix(candidates []Candidate, word string) []Candidate {
+	var matches []Candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(c.Name, word) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,104 @@
+package completion
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kborovik/gcp-iam/db"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	dbPath := filepath.Join(dir, "gcp-iam.db")
+	database, err := db.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	for _, role := range []db.Role{
+		{Name: "storage.admin", Title: "Storage Admin"},
+		{Name: "storage.objectViewer", Title: "Storage Object Viewer"},
+		{Name: "storagetransfer.user", Title: "Storage Transfer User"},
+		{Name: "viewer", Title: "Viewer"},
+	} {
+		if err := database.InsertRole(&role); err != nil {
+			t.Fatalf("Failed to insert role: %v", err)
+		}
+	}
+	for _, perm := range []string{"storage.buckets.get", "storage.objects.get", "compute.instances.get"} {
+		if err := database.InsertPermission(&db.Permission{Permission: perm, Role: "storage.admin"}); err != nil {
+			t.Fatalf("Failed to insert permission: %v", err)
+		}
+	}
+
+	if _, err := LookupCache(dbPath, db.ResourceRoles, ""); !errors.Is(err, ErrStaleCache) {
+		t.Fatalf("Expected a missing cache to be stale, got %v", err)
+	}
+
+	if err := RebuildCache(context.Background(), database, dbPath); err != nil {
+		t.Fatalf("Failed to rebuild cache: %v", err)
+	}
+
+	tests := []struct {
+		section string
+		word    string
+		want    []string
+	}{
+		{db.ResourceRoles, "", []string{"storage.admin", "storage.objectViewer", "storagetransfer.user", "viewer"}},
+		{db.ResourceRoles, "stor", []string{"storage.admin", "storage.objectViewer", "storagetransfer.user"}},
+		{db.ResourceRoles, "storage.", []string{"storage.admin", "storage.objectViewer"}},
+		{db.ResourceRoles, "storage.o", []string{"storage.objectViewer"}},
+		{db.ResourceRoles, "x", nil},
+		{db.ResourcePermissions, "storage.b", []string{"storage.buckets.get"}},
+		{db.ResourcePermissions, "c", []string{"compute.instances.get"}},
+		{db.ResourceServices, "", nil},
+	}
+	for _, tt := range tests {
+		candidates, err := LookupCache(dbPath, tt.section, tt.word)
+		if err != nil {
+			t.Fatalf("Failed to look up %s '%s': %v", tt.section, tt.word, err)
+		}
+		var got []string
+		for _, c := range candidates {
+			got = append(got, c.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Lookup of %s '%s': expected %v, got %v", tt.section, tt.word, tt.want, got)
+		}
+	}
+
+	candidates, _ := LookupCache(dbPath, db.ResourceRoles, "viewer")
+	if len(candidates) != 1 || candidates[0].Description != "Viewer" {
+		t.Errorf("Expected role title as description, got %v", candidates)
+	}
+
+	// Any change to the database makes the cache stale until completion rebuilds it
+	if err := database.InsertRole(&db.Role{Name: "editor", Title: "Editor"}); err != nil {
+		t.Fatalf("Failed to insert role: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(dbPath, future, future); err != nil {
+		t.Fatalf("Failed to touch database: %v", err)
+	}
+	if _, err := LookupCache(dbPath, db.ResourceRoles, ""); !errors.Is(err, ErrStaleCache) {
+		t.Fatalf("Expected cache to be stale after a change, got %v", err)
+	}
+
+	open := func() (*db.DB, error) { return db.New(dbPath) }
+	candidates, err = Candidates(context.Background(), dbPath, open, db.ResourceRoles, "e")
+	if err != nil || len(candidates) != 1 || candidates[0].Name != "editor" {
+		t.Fatalf("Expected 'editor' from the database, got %v (%v)", candidates, err)
+	}
+	if _, err := LookupCache(dbPath, db.ResourceRoles, "e"); err != nil {
+		t.Errorf("Expected Candidates to rebuild the cache, got %v", err)
+	}
+}
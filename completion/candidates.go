@@ -0,0 +1,61 @@
+package completion
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WordEnv is the environment variable through which the scripts pass the word being
+// completed, which is not part of the re-run command line
+const WordEnv = "GCP_IAM_COMPLETE_WORD"
+
+// Candidate is a completion value with an optional description
+type Candidate struct {
+	Name        string
+	Description string
+}
+
+// Word returns the word being completed, empty when the shell did not provide it
+func Word() string {
+	return os.Getenv(WordEnv)
+}
+
+// Write prints candidates one per line in the format of the shell named by $SHELL.
+// zsh, fish and PowerShell show descriptions; bash only gets the names.
+func Write(w io.Writer, candidates []Candidate) {
+	shell := shellName(os.Getenv("SHELL"))
+	for _, c := range candidates {
+		fmt.Fprintln(w, format(shell, c))
+	}
+}
+
+// shellName maps $SHELL, which may be a path, to one of Shells
+func shellName(shell string) string {
+	name := strings.TrimSuffix(filepath.Base(shell), ".exe")
+	if name == "pwsh" {
+		return "powershell"
+	}
+	return name
+}
+
+func format(shell string, c Candidate) string {
+	desc := strings.Join(strings.Fields(c.Description), " ")
+	if desc == "" {
+		if shell == "zsh" {
+			return strings.ReplaceAll(c.Name, ":", `\:`)
+		}
+		return c.Name
+	}
+
+	switch shell {
+	case "zsh":
+		return strings.ReplaceAll(c.Name, ":", `\:`) + ":" + desc
+	case "fish", "powershell":
+		return c.Name + "\t" + desc
+	default:
+		return c.Name
+	}
+}
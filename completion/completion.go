@@ -0,0 +1,46 @@
+// Package completion generates shell completion scripts. The scripts ask the program for
+// candidates by re-running the command line with --generate-shell-completion, so every
+// subcommand, flag and dynamic name (roles, permissions, services) is completed without
+// changing the scripts when commands change. Candidates are printed with Write, which adds
+// descriptions for the shells that display them.
+package completion
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+)
+
+//go:embed scripts
+var scripts embed.FS
+
+// Shells lists the supported shells
+var Shells = []string{"bash", "zsh", "fish", "powershell"}
+
+var scriptFiles = map[string]string{
+	"bash":       "scripts/bash.sh",
+	"zsh":        "scripts/zsh.zsh",
+	"fish":       "scripts/fish.fish",
+	"powershell": "scripts/powershell.ps1",
+}
+
+// Script returns the completion script of shell for the program appName
+func Script(shell, appName string) (string, error) {
+	if shell == "pwsh" {
+		shell = "powershell"
+	}
+
+	file, ok := scriptFiles[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell '%s' (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+
+	tmpl, err := scripts.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	// Shell function names cannot contain '-'
+	funcName := strings.NewReplacer("-", "_", ".", "_").Replace(appName)
+	return fmt.Sprintf(string(tmpl), appName, funcName, WordEnv), nil
+}
@@ -0,0 +1,65 @@
+package completion
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	for _, shell := range append(Shells, "pwsh") {
+		script, err := Script(shell, "gcp-iam")
+		if err != nil {
+			t.Fatalf("Failed to generate %s script: %v", shell, err)
+		}
+		if strings.Contains(script, "%!") || strings.Contains(script, "%[") {
+			t.Errorf("%s script has unexpanded placeholders", shell)
+		}
+		if !strings.Contains(script, "--generate-shell-completion") {
+			t.Errorf("%s script does not request completions from the program", shell)
+		}
+		if shell != "powershell" && shell != "pwsh" && !strings.Contains(script, "__gcp_iam_complete") {
+			t.Errorf("%s script does not define a valid function name", shell)
+		}
+	}
+
+	if _, err := Script("tcsh", "gcp-iam"); err == nil {
+		t.Error("Expected unsupported shell to fail")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	role := Candidate{Name: "storage.admin", Description: "Storage\tAdmin"}
+	tests := []struct {
+		shell     string
+		candidate Candidate
+		want      string
+	}{
+		{"bash", role, "storage.admin"},
+		{"zsh", role, "storage.admin:Storage Admin"},
+		{"fish", role, "storage.admin\tStorage Admin"},
+		{"powershell", role, "storage.admin\tStorage Admin"},
+		{"zsh", Candidate{Name: "a:b"}, `a\:b`},
+		{"fish", Candidate{Name: "compute.instances.get"}, "compute.instances.get"},
+	}
+
+	for _, tt := range tests {
+		if got := format(tt.shell, tt.candidate); got != tt.want {
+			t.Errorf("format(%s, %v) = %q, want %q", tt.shell, tt.candidate, got, tt.want)
+		}
+	}
+}
+
+func TestShellName(t *testing.T) {
+	for shell, want := range map[string]string{
+		"/bin/bash":      "bash",
+		"/usr/bin/zsh":   "zsh",
+		"fish":           "fish",
+		"pwsh.exe":       "powershell",
+		"powershell":     "powershell",
+		"/usr/local/ksh": "ksh",
+	} {
+		if got := shellName(shell); got != want {
+			t.Errorf("shellName(%s) = %s, want %s", shell, got, want)
+		}
+	}
+}
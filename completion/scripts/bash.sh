@@ -0,0 +1,25 @@
+# bash completion for %[1]s, generated by '%[1]s completion bash'
+#
+# Add to ~/.bashrc:
+#   source <(%[1]s completion bash)
+
+# The program runs the command instead of completing when the line contains "--",
+# so a lone "--" being typed is sent as "-" and words after a "--" are not completed.
+__%[2]s_complete() {
+  local cur="${COMP_WORDS[COMP_CWORD]}"
+  local args=("${COMP_WORDS[@]:0:COMP_CWORD}")
+  local word
+  for word in "${args[@]}"; do
+    [[ "$word" == "--" ]] && return 0
+  done
+  if [[ "$cur" == "--" ]]; then
+    args+=("-")
+  elif [[ "$cur" == -* ]]; then
+    args+=("$cur")
+  fi
+
+  local IFS=$'\n'
+  COMPREPLY=($(compgen -W "$(%[3]s="$cur" SHELL=bash "${args[@]}" --generate-shell-completion 2>/dev/null)" -- "$cur"))
+}
+
+complete -o bashdefault -o default -F __%[2]s_complete %[1]s
@@ -0,0 +1,22 @@
+# fish completion for %[1]s, generated by '%[1]s completion fish'
+#
+# Install with:
+#   %[1]s completion fish > ~/.config/fish/completions/%[1]s.fish
+
+# The program runs the command instead of completing when the line contains "--",
+# so a lone "--" being typed is sent as "-" and words after a "--" are not completed.
+function __%[2]s_complete
+    set -l args (commandline -opc)
+    set -l cur (commandline -ct)
+    if contains -- -- $args
+        return
+    end
+    if test "$cur" = --
+        set -a args -
+    else if string match -q -- '-*' $cur
+        set -a args $cur
+    end
+    env SHELL=fish %[3]s=$cur $args --generate-shell-completion 2>/dev/null
+end
+
+complete -c %[1]s -f -a '(__%[2]s_complete)'
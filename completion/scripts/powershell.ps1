@@ -0,0 +1,43 @@
+# PowerShell completion for %[1]s, generated by '%[1]s completion powershell'
+#
+# Add to your PowerShell profile:
+#   %[1]s completion powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName '%[1]s' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    # Words before the one being completed; flags are completed by passing the partial flag.
+    # The program runs the command instead of completing when the line contains "--",
+    # so a lone "--" being typed is sent as "-" and words after a "--" are not completed.
+    $words = @($commandAst.CommandElements | Where-Object { $_.Extent.EndOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+    if ($words -contains '--') {
+        return
+    }
+    if ($wordToComplete -eq '--') {
+        $words += '-'
+    } elseif ($wordToComplete.StartsWith('-')) {
+        $words += $wordToComplete
+    }
+
+    $arguments = @()
+    if ($words.Count -gt 1) {
+        $arguments = $words[1..($words.Count - 1)]
+    }
+
+    # Candidates come as "name<TAB>description"
+    $shell, $word = $env:SHELL, $env:%[3]s
+    $env:SHELL, $env:%[3]s = 'powershell', $wordToComplete
+    try {
+        $candidates = & $words[0] @arguments --generate-shell-completion 2>$null
+    } finally {
+        $env:SHELL, $env:%[3]s = $shell, $word
+    }
+
+    $candidates |
+        Where-Object { $_ -like "$wordToComplete*" } |
+        ForEach-Object {
+            $name, $description = $_ -split "`t", 2
+            if (-not $description) { $description = $name }
+            [System.Management.Automation.CompletionResult]::new($name, $name, 'ParameterValue', $description)
+        }
+}
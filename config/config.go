@@ -4,56 +4,223 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kborovik/gcp-iam/internal/constants"
-	"gopkg.in/yaml.v3"
 )
 
+// Environment variables overriding the config file
+const (
+	EnvConfig   = "GCP_IAM_CONFIG"
+	EnvProfile  = "GCP_IAM_PROFILE"
+	EnvDatabase = "GCP_IAM_DB"
+	EnvReadOnly = "GCP_IAM_READ_ONLY"
+)
+
+// Config holds the effective settings. Settings are resolved in this order, later ones winning:
+//
+//  1. built-in defaults
+//  2. top-level settings in config.yaml
+//  3. the selected profile in config.yaml
+//  4. GCP_IAM_* environment variables
+//  5. command line flags (Options)
+//
+// The config file is chosen by --config, then GCP_IAM_CONFIG, then the default location
+// (see ConfigDir). The profile is chosen by --profile, then GCP_IAM_PROFILE, then the
+// 'profile' key of config.yaml.
 type Config struct {
-	DatabasePath string `yaml:"database_path" json:"database_path"`
+	DatabasePath string `yaml:"database_path" json:"database_path" desc:"SQLite database file, absolute or starting with ~/"`
+	// ReadOnly opens DatabasePath read-only, for a prebuilt database on a shared or read-only mount
+	ReadOnly bool `yaml:"read_only" json:"read_only" desc:"Open the database read-only, e.g. a prebuilt database on a shared mount"`
+	// Profile is the default profile in config.yaml and the active profile after Load
+	Profile  string             `yaml:"profile,omitempty" json:"profile,omitempty" desc:"Profile used when --profile and GCP_IAM_PROFILE are not set"`
+	Profiles map[string]Profile `yaml:"profiles,omitempty" json:"profiles,omitempty" desc:"Named settings overriding the top-level ones, e.g. one database per GCP organization"`
+	Lint     LintConfig         `yaml:"lint" json:"lint" desc:"Rules applied by gcp-iam lint"`
+	// StaleAfter is the data age after which queries warn, see ParseAge; 0 disables the warning
+	StaleAfter string `yaml:"stale_after" json:"stale_after" desc:"Warn on queries when data is older than this, e.g. 30d, 2w or 12h; 0 disables the warning"`
+
+	// Path is the config file the settings were loaded from; it need not exist
+	Path string `yaml:"-" json:"-"`
+	// Warnings lists the unknown keys and relative database paths Load tolerated in Path
+	Warnings ValidationErrors `yaml:"-" json:"-"`
 }
 
-func Load() (*Config, error) {
-	homeDir, err := os.UserHomeDir()
+// Profile overrides top-level settings, e.g. one database per GCP organization with custom roles
+type Profile struct {
+	DatabasePath string `yaml:"database_path,omitempty" json:"database_path,omitempty" desc:"SQLite database file, absolute or starting with ~/"`
+	ReadOnly     *bool  `yaml:"read_only,omitempty" json:"read_only,omitempty" desc:"Open the database read-only"`
+}
+
+// DefaultStaleAfter is the data age after which queries warn unless configured otherwise
+const DefaultStaleAfter = "30d"
+
+// ParseAge parses an age such as "7d", "2w" or "12h". Besides the units of
+// time.ParseDuration it accepts whole days (d) and weeks (w).
+func ParseAge(s string) (time.Duration, error) {
+	for unit, size := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, unit); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age '%s': expected e.g. 7d, 2w or 12h", s)
+			}
+			return time.Duration(count) * size, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age '%s': expected e.g. 7d, 2w or 12h", s)
+	}
+	return d, nil
+}
+
+// StaleThreshold returns the parsed StaleAfter; 0 means staleness is not reported
+func (cfg *Config) StaleThreshold() time.Duration {
+	d, err := ParseAge(cfg.StaleAfter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		return 0
 	}
+	return d
+}
+
+// Options holds command line overrides; empty fields are ignored
+type Options struct {
+	ConfigPath   string
+	DatabasePath string
+	Profile      string
+	// NoCreate leaves missing directories alone, for callers that only open an existing database
+	NoCreate bool
+}
+
+// LintConfig holds the rules applied by `gcp-iam lint`
+type LintConfig struct {
+	Rules []LintRule `yaml:"rules" json:"rules" desc:"Lint rules; without rules the defaults are applied"`
+}
 
-	configDir := filepath.Join(homeDir, constants.ConfigDirName)
+// LintRule configures a single policy lint rule.
+// Which fields apply depends on Type, see the lint package for details.
+type LintRule struct {
+	ID          string   `yaml:"id" json:"id" desc:"Rule identifier shown in findings, defaults to the type"`
+	Type        string   `yaml:"type" json:"type" desc:"Rule type" enum:"forbid-basic-roles,forbid-roles,forbid-stages,forbid-public-permissions,max-member-permissions"`
+	Severity    string   `yaml:"severity" json:"severity" desc:"Finding severity, defaults to error" enum:"error,warning,note"`
+	Description string   `yaml:"description" json:"description" desc:"Explanation shown in findings"`
+	Roles       []string `yaml:"roles" json:"roles" desc:"Roles forbidden by forbid-roles"`
+	Stages      []string `yaml:"stages" json:"stages" desc:"Role stages forbidden by forbid-stages"`
+	Members     []string `yaml:"members" json:"members" desc:"Members checked by forbid-public-permissions"`
+	Permissions []string `yaml:"permissions" json:"permissions" desc:"Permissions forbidden for public members"`
+	Max         int      `yaml:"max" json:"max" desc:"Maximum permissions per member for max-member-permissions"`
+}
+
+// Load loads the configuration honoring environment overrides
+func Load() (*Config, error) {
+	return LoadWith(Options{})
+}
+
+// LoadWith loads the configuration and applies environment and command line overrides
+func LoadWith(opts Options) (*Config, error) {
+	dataDir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
 
 	cfg := &Config{
-		DatabasePath: filepath.Join(configDir, "database.sqlite"),
+		DatabasePath: filepath.Join(dataDir, "database.sqlite"),
+		StaleAfter:   DefaultStaleAfter,
+	}
+
+	configPath, explicit, err := resolvePath(opts)
+	if err != nil {
+		return nil, err
+	}
+	if explicit {
+		if _, err := os.Stat(configPath); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
 	}
 
-	configPath := filepath.Join(configDir, "config.yaml")
-	if err := loadFromFile(cfg, configPath); err != nil {
+	warnings, err := loadFromFile(cfg, configPath)
+	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	cfg.Path = configPath
+	cfg.Warnings = warnings
+	cfg.DatabasePath = expandHome(cfg.DatabasePath)
+
+	if err := cfg.applyOverrides(opts); err != nil {
+		return nil, err
+	}
 
-	if err := cfg.ensureDirectories(); err != nil {
-		return nil, fmt.Errorf("failed to create directories: %w", err)
+	// A shared read-only database must not cause directories to be created next to it
+	if !cfg.ReadOnly && !opts.NoCreate {
+		if err := cfg.ensureDirectories(); err != nil {
+			return nil, fmt.Errorf("failed to create directories: %w", err)
+		}
 	}
 
 	return cfg, nil
 }
 
-func loadFromFile(cfg *Config, configPath string) error {
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil
+// ResolvePath returns the config file selected by opts, GCP_IAM_CONFIG or the default location
+func ResolvePath(opts Options) (string, error) {
+	path, _, err := resolvePath(opts)
+	return path, err
+}
+
+func resolvePath(opts Options) (path string, explicit bool, err error) {
+	if path := firstNonEmpty(opts.ConfigPath, os.Getenv(EnvConfig)); path != "" {
+		return expandHome(path), true, nil
+	}
+	path, err = GetDefaultConfigPath()
+	return path, false, err
+}
+
+// applyOverrides applies the selected profile, then environment variables, then opts
+func (cfg *Config) applyOverrides(opts Options) error {
+	profile := firstNonEmpty(opts.Profile, os.Getenv(EnvProfile), cfg.Profile)
+	if profile != "" {
+		p, ok := cfg.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("profile '%s' is not defined in %s", profile, cfg.Path)
+		}
+		if p.DatabasePath != "" {
+			cfg.DatabasePath = expandHome(p.DatabasePath)
+		}
+		if p.ReadOnly != nil {
+			cfg.ReadOnly = *p.ReadOnly
+		}
 	}
+	cfg.Profile = profile
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+	if value := os.Getenv(EnvReadOnly); value != "" {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value '%s': expected true or false", EnvReadOnly, value)
+		}
+		cfg.ReadOnly = readOnly
 	}
 
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+	if path := firstNonEmpty(opts.DatabasePath, os.Getenv(EnvDatabase)); path != "" {
+		cfg.DatabasePath = expandHome(path)
 	}
 
 	return nil
 }
 
+func loadFromFile(cfg *Config, configPath string) (ValidationErrors, error) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return parseFile(cfg, configPath, data)
+}
+
 func (cfg *Config) ensureDirectories() error {
 	dir := filepath.Dir(cfg.DatabasePath)
 	if err := os.MkdirAll(dir, constants.DefaultDirPermissions); err != nil {
@@ -62,11 +229,71 @@ func (cfg *Config) ensureDirectories() error {
 	return nil
 }
 
+// GetDefaultConfigPath returns config.yaml in ConfigDir
 func GetDefaultConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// ConfigDir returns the directory holding config.yaml: ~/.gcp-iam if it exists,
+// otherwise $XDG_CONFIG_HOME/gcp-iam if XDG_CONFIG_HOME is set, otherwise ~/.gcp-iam
+func ConfigDir() (string, error) {
+	return baseDir("XDG_CONFIG_HOME")
+}
+
+// DataDir returns the directory holding the default database and the shell history:
+// ~/.gcp-iam if it exists, otherwise $XDG_DATA_HOME/gcp-iam if XDG_DATA_HOME is set,
+// otherwise ~/.gcp-iam
+func DataDir() (string, error) {
+	return baseDir("XDG_DATA_HOME")
+}
+
+// CacheDir returns the directory holding rebuildable caches: ~/.gcp-iam if it exists,
+// otherwise $XDG_CACHE_HOME/gcp-iam if XDG_CACHE_HOME is set, otherwise ~/.gcp-iam
+func CacheDir() (string, error) {
+	return baseDir("XDG_CACHE_HOME")
+}
+
+// baseDir keeps existing ~/.gcp-iam installations working and follows the
+// XDG base directory variable xdgEnv for new ones
+func baseDir(xdgEnv string) (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	return filepath.Join(homeDir, constants.ConfigDirName, "config.yaml"), nil
+	legacy := filepath.Join(homeDir, constants.ConfigDirName)
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy, nil
+	}
+
+	if xdg := os.Getenv(xdgEnv); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, constants.AppName), nil
+	}
+
+	return legacy, nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[1:])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadDefaultConfig(t *testing.T) {
@@ -85,3 +89,306 @@ func TestGetDefaultConfigPath(t *testing.T) {
 		t.Error("Config path should be absolute")
 	}
 }
+
+func TestLoadPrecedence(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(EnvDatabase, "")
+	t.Setenv(EnvProfile, "")
+	t.Setenv(EnvReadOnly, "")
+
+	configFile := filepath.Join(tmpDir, "custom.yaml")
+	dataDir := filepath.Join(tmpDir, "data")
+	acmePath := filepath.Join(dataDir, "acme.sqlite")
+	envPath := filepath.Join(dataDir, "env.sqlite")
+	flagPath := filepath.Join(dataDir, "flag.sqlite")
+	configContent := fmt.Sprintf(`database_path: %s/default.sqlite
+profile: acme
+profiles:
+  acme:
+    database_path: %s
+  globex:
+    database_path: ~/globex.sqlite
+    read_only: true
+`, dataDir, acmePath)
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		env          map[string]string
+		opts         Options
+		wantPath     string
+		wantProfile  string
+		wantReadOnly bool
+	}{
+		{name: "default profile from file", wantPath: acmePath, wantProfile: "acme"},
+		{name: "profile from env", env: map[string]string{EnvProfile: "globex"}, wantPath: filepath.Join(tmpDir, "globex.sqlite"), wantProfile: "globex", wantReadOnly: true},
+		{name: "profile flag beats env", env: map[string]string{EnvProfile: "globex"}, opts: Options{Profile: "acme"}, wantPath: acmePath, wantProfile: "acme"},
+		{name: "env database beats profile", env: map[string]string{EnvDatabase: envPath, EnvReadOnly: "true"}, wantPath: envPath, wantProfile: "acme", wantReadOnly: true},
+		{name: "db flag beats env", env: map[string]string{EnvDatabase: envPath}, opts: Options{DatabasePath: flagPath}, wantPath: flagPath, wantProfile: "acme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			tt.opts.ConfigPath = configFile
+
+			cfg, err := LoadWith(tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if cfg.DatabasePath != tt.wantPath || cfg.Profile != tt.wantProfile || cfg.ReadOnly != tt.wantReadOnly {
+				t.Errorf("Got path=%s profile=%s read_only=%t, want %s %s %t",
+					cfg.DatabasePath, cfg.Profile, cfg.ReadOnly, tt.wantPath, tt.wantProfile, tt.wantReadOnly)
+			}
+			if cfg.Path != configFile {
+				t.Errorf("Expected Path '%s', got '%s'", configFile, cfg.Path)
+			}
+		})
+	}
+
+	if _, err := LoadWith(Options{ConfigPath: configFile, Profile: "missing"}); err == nil {
+		t.Error("Expected an undefined profile to fail")
+	}
+	if _, err := LoadWith(Options{ConfigPath: filepath.Join(tmpDir, "missing.yaml")}); err == nil {
+		t.Error("Expected a missing explicit config file to fail")
+	}
+}
+
+func TestXDGDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmpDir, "home"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, "xdg-config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "xdg-data"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "xdg-cache"))
+
+	path, err := GetDefaultConfigPath()
+	if err != nil {
+		t.Fatalf("Failed to get config path: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "xdg-config", "gcp-iam", "config.yaml"); path != want {
+		t.Errorf("Expected XDG config path '%s', got '%s'", want, path)
+	}
+
+	dataDir, err := DataDir()
+	if err != nil {
+		t.Fatalf("Failed to get data dir: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "xdg-data", "gcp-iam"); dataDir != want {
+		t.Errorf("Expected XDG data dir '%s', got '%s'", want, dataDir)
+	}
+
+	cacheDir, err := CacheDir()
+	if err != nil {
+		t.Fatalf("Failed to get cache dir: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "xdg-cache", "gcp-iam"); cacheDir != want {
+		t.Errorf("Expected XDG cache dir '%s', got '%s'", want, cacheDir)
+	}
+
+	// An existing ~/.gcp-iam keeps precedence so current installations keep working
+	legacy := filepath.Join(tmpDir, "home", ".gcp-iam")
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatalf("Failed to create legacy directory: %v", err)
+	}
+	if dataDir, _ := DataDir(); dataDir != legacy {
+		t.Errorf("Expected legacy data dir '%s', got '%s'", legacy, dataDir)
+	}
+}
+
+func TestSetAndValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	acmePath := filepath.Join(tmpDir, "data", "acme.sqlite")
+	configContent := `# shared team settings
+database_path: default.sqlite
+lint:
+  rules:
+    - id: no-basic-roles
+      type: forbid-basic-roles
+`
+	if err := os.WriteFile(configFile, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if err := Set(configFile, "profiles.acme.database_path", acmePath); err != nil {
+		t.Fatalf("Failed to set profile database: %v", err)
+	}
+	if err := Set(configFile, "profiles.acme.read_only", "yes"); err == nil {
+		t.Error("Expected invalid boolean to fail")
+	}
+	if err := Set(configFile, "log_level", "debug"); err == nil {
+		t.Error("Expected unknown key to fail")
+	}
+	if err := Set(configFile, "profile", "acme"); err != nil {
+		t.Fatalf("Failed to set profile: %v", err)
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	if !strings.Contains(string(data), "# shared team settings") || !strings.Contains(string(data), "no-basic-roles") {
+		t.Errorf("Expected comments and other settings to be kept, got:\n%s", data)
+	}
+
+	cfg, err := LoadWith(Options{ConfigPath: configFile})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.DatabasePath != acmePath {
+		t.Errorf("Expected profile database, got '%s'", cfg.DatabasePath)
+	}
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0].Line != 2 {
+		t.Errorf("Expected a warning for the relative database path on line 2, got %v", cfg.Warnings)
+	}
+	if problems := cfg.Validate(); len(problems) != 1 {
+		t.Errorf("Expected relative database path to be reported, got %v", problems)
+	}
+
+	if err := os.WriteFile(configFile, append(data, "log_level: debug\n"...), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if problems := cfg.Validate(); len(problems) != 2 {
+		t.Errorf("Expected unknown key to be reported, got %v", problems)
+	}
+
+	cfg.Profiles["globex"] = Profile{}
+	if problems := cfg.Validate(); len(problems) != 3 {
+		t.Errorf("Expected profile without database to be reported, got %v", problems)
+	}
+
+	for _, value := range []string{"relative.sqlite", tmpDir} {
+		if err := Set(configFile, "database_path", value); err == nil {
+			t.Errorf("Expected database_path '%s' to be refused", value)
+		}
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "config.yaml")
+	configContent := `databse_path: /tmp/db.sqlite
+read_only: yes please
+profile: missing
+profiles:
+  acme:
+    database_path: relative.sqlite
+    colour: blue
+lint:
+  rules:
+    - type: forbid-everything
+      max: many
+`
+	warnings, err := parseFile(&Config{}, configFile, []byte(configContent))
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+
+	checkProblems := func(kind string, got ValidationErrors, want []string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d %s, got %d:\n%v", len(want), kind, len(got), got)
+		}
+		for i, w := range want {
+			if !strings.Contains(got[i].Error(), configFile+":"+w) {
+				t.Errorf("%s %d: expected '%s', got '%s'", kind, i, w, got[i].Error())
+			}
+		}
+	}
+	checkProblems("errors", verrs, []string{
+		"2:12: read_only must be true or false, got 'yes please'",
+		"10:13: invalid value 'forbid-everything' for lint.rules[0].type",
+		"11:12: lint.rules[0].max must be an integer, got 'many'",
+	})
+	checkProblems("warnings", warnings, []string{
+		"1:1: unknown key 'databse_path' (did you mean 'database_path'?)",
+		"7:5: unknown key 'colour' in profiles.acme",
+	})
+
+	// Semantic checks run once the file is well-formed
+	configContent = `database_path: relative.sqlite
+profile: missing
+profiles:
+  acme:
+    database_path: ` + tmpDir + `
+`
+	warnings, err = parseFile(&Config{}, configFile, []byte(configContent))
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	checkProblems("errors", verrs, []string{
+		"5:20: database_path '" + tmpDir + "' is a directory",
+		"2:10: profile 'missing' is not defined",
+	})
+	checkProblems("warnings", warnings, []string{
+		"1:16: database_path 'relative.sqlite' must be absolute",
+	})
+
+	// Load tolerates what only warrants a warning
+	if err := os.WriteFile(configFile, []byte("database_path: relative.sqlite\nlog_level: debug\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := LoadWith(Options{ConfigPath: configFile})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.DatabasePath != "relative.sqlite" || len(cfg.Warnings) != 2 {
+		t.Errorf("Expected relative database with 2 warnings, got '%s' with %v", cfg.DatabasePath, cfg.Warnings)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+
+	var schema struct {
+		Properties map[string]struct {
+			Type                 string          `json:"type"`
+			AdditionalProperties json.RawMessage `json:"additionalProperties"`
+		} `json:"properties"`
+		AdditionalProperties bool `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+
+	if schema.AdditionalProperties {
+		t.Error("Expected unknown top-level keys to be rejected")
+	}
+	for key, typ := range map[string]string{"database_path": "string", "read_only": "boolean", "profiles": "object", "lint": "object"} {
+		if got := schema.Properties[key].Type; got != typ {
+			t.Errorf("Expected %s to be %s, got '%s'", key, typ, got)
+		}
+	}
+	if _, ok := schema.Properties["Path"]; ok {
+		t.Error("Expected internal fields to be omitted")
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"0":   0,
+	}
+	for input, want := range tests {
+		if got, err := ParseAge(input); err != nil || got != want {
+			t.Errorf("ParseAge(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "d", "-1d", "1.5d", "soon"} {
+		if _, err := ParseAge(input); err == nil {
+			t.Errorf("Expected ParseAge(%q) to fail", input)
+		}
+	}
+}
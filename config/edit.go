@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/internal/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// SettableKeys lists the keys accepted by Set; <name> stands for a profile name
+var SettableKeys = []string{
+	"database_path",
+	"read_only",
+	"profile",
+	"profiles.<name>.database_path",
+	"profiles.<name>.read_only",
+}
+
+// Set stores key = value in the config file at path, creating the file if needed.
+// Other settings and comments in the file are kept.
+func Set(path, key, value string) error {
+	keys := strings.Split(key, ".")
+	field := keys[len(keys)-1]
+
+	switch {
+	case len(keys) == 1 && (field == "database_path" || field == "read_only" || field == "profile"):
+	case len(keys) == 3 && keys[0] == "profiles" && keys[1] != "" && (field == "database_path" || field == "read_only"):
+	default:
+		return fmt.Errorf("unknown key '%s': expected one of %s", key, strings.Join(SettableKeys, ", "))
+	}
+
+	tag := "!!str"
+	if field == "read_only" {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for %s: expected true or false", value, key)
+		}
+		tag, value = "!!bool", strconv.FormatBool(readOnly)
+	}
+	if field == "database_path" {
+		if err := checkDatabasePath(value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	for _, k := range keys[:len(keys)-1] {
+		if node, err = mappingValue(node, k); err != nil {
+			return fmt.Errorf("cannot set %s: %w", key, err)
+		}
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("cannot set %s: parent is not a mapping", key)
+	}
+
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	if i := mappingIndex(node, field); i >= 0 {
+		node.Content[i+1] = scalar
+	} else {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field}, scalar)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), constants.DefaultDirPermissions); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// mappingIndex returns the index of key in the mapping node, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns the mapping stored under key, adding an empty one if key is missing
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, errors.New("parent is not a mapping")
+	}
+	if i := mappingIndex(node, key); i >= 0 {
+		value := node.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			value.Kind, value.Tag, value.Value = yaml.MappingNode, "", ""
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("'%s' is not a mapping", key)
+		}
+		return value, nil
+	}
+
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value, nil
+}
+
+// Validate reports problems that Load accepts: unknown keys and relative database paths
+// in the config file as it is now, profiles without a database and a read-only database
+// that does not exist. Other mistakes in the file fail Load.
+func (cfg *Config) Validate() []error {
+	var problems []error
+
+	if data, err := os.ReadFile(cfg.Path); err == nil {
+		warnings, err := parseFile(&Config{}, cfg.Path, data)
+		for _, w := range warnings {
+			problems = append(problems, w)
+		}
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		if cfg.Profiles[name].DatabasePath == "" {
+			problems = append(problems, fmt.Errorf("profile '%s' has no database_path and shares the default database", name))
+		}
+	}
+
+	if cfg.ReadOnly {
+		if _, err := os.Stat(cfg.DatabasePath); err != nil {
+			problems = append(problems, fmt.Errorf("read-only database is not available: %w", err))
+		}
+	}
+
+	return problems
+}
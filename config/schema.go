@@ -0,0 +1,348 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The config file is validated against the yaml tags of Config and the types it contains,
+// so new settings are checked and exported to the JSON Schema without further changes.
+// A field may carry a `desc` tag with its documentation and an `enum` tag with its
+// comma-separated allowed values.
+
+// ValidationError is a problem at a position in the config file
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// ValidationErrors lists every problem found in a config file
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// validator walks a parsed config file and collects problems. Problems Load can work
+// around, such as unknown keys, are collected as warnings instead of errors.
+type validator struct {
+	file     string
+	errs     ValidationErrors
+	warnings ValidationErrors
+}
+
+func (v *validator) addf(node *yaml.Node, format string, args ...any) {
+	v.errs = append(v.errs, v.problem(node, format, args...))
+}
+
+func (v *validator) warnf(node *yaml.Node, format string, args ...any) {
+	v.warnings = append(v.warnings, v.problem(node, format, args...))
+}
+
+func (v *validator) problem(node *yaml.Node, format string, args ...any) *ValidationError {
+	return &ValidationError{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// parseFile decodes data into cfg. Values of the wrong type or outside their enum,
+// directory database paths, bad ages and an undefined default profile are errors.
+// Unknown keys and relative database paths are returned as warnings: they are ignored
+// and used as given respectively, and only `config validate` rejects them.
+func parseFile(cfg *Config, file string, data []byte) (ValidationErrors, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	v := &validator{file: file}
+	root := doc.Content[0]
+	v.check(root, reflect.TypeOf(cfg).Elem(), "")
+	if len(v.errs) > 0 {
+		return v.warnings, v.errs
+	}
+
+	if err := root.Decode(cfg); err != nil {
+		return v.warnings, fmt.Errorf("failed to parse config file %s: %w", file, err)
+	}
+
+	if node := mappingNode(root, "database_path"); node != nil {
+		v.checkPath(node)
+	}
+	if profiles := mappingNode(root, "profiles"); profiles != nil {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			if node := mappingNode(profiles.Content[i], "database_path"); node != nil {
+				v.checkPath(node)
+			}
+		}
+	}
+	if node := mappingNode(root, "stale_after"); node != nil && node.Value != "" {
+		if _, err := ParseAge(node.Value); err != nil {
+			v.addf(node, "stale_after: %v", err)
+		}
+	}
+	if node := mappingNode(root, "profile"); node != nil && node.Value != "" {
+		if _, ok := cfg.Profiles[node.Value]; !ok {
+			v.addf(node, "profile '%s' is not defined under 'profiles'", node.Value)
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.warnings, v.errs
+	}
+	return v.warnings, nil
+}
+
+// check validates node against the Go type t; path names the key for messages
+func (v *validator) check(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.addf(node, "%s must be a mapping", describe(path))
+			return
+		}
+		fields := schemaFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			f, ok := findField(fields, key.Value)
+			if !ok {
+				v.warnf(key, "unknown key '%s'%s%s", key.Value, inPath(path), suggest(key.Value, fields))
+				continue
+			}
+			v.check(value, f.typ, joinPath(path, f.name))
+			if len(f.enum) > 0 && value.Kind == yaml.ScalarNode && value.Value != "" && !slices.Contains(f.enum, value.Value) {
+				v.addf(value, "invalid value '%s' for %s (valid: %s)", value.Value, joinPath(path, f.name), strings.Join(f.enum, ", "))
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.addf(node, "%s must be a mapping", describe(path))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.check(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.addf(node, "%s must be a list", describe(path))
+			return
+		}
+		for i, item := range node.Content {
+			v.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			v.addf(node, "%s must be true or false, got '%s'", describe(path), node.Value)
+		}
+	case reflect.Int:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.addf(node, "%s must be an integer, got '%s'", describe(path), node.Value)
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(node, "%s must be a string", describe(path))
+		}
+	}
+}
+
+// errRelativePath marks a database path that depends on the working directory
+var errRelativePath = errors.New("must be absolute or start with ~/")
+
+// checkPath warns about a relative database path and reports one pointing to a directory
+func (v *validator) checkPath(node *yaml.Node) {
+	err := checkDatabasePath(node.Value)
+	switch {
+	case errors.Is(err, errRelativePath):
+		v.warnf(node, "%v", err)
+	case err != nil:
+		v.addf(node, "%v", err)
+	}
+}
+
+// checkDatabasePath reports a database path that is relative or points to a directory
+func checkDatabasePath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if path != "~" && !strings.HasPrefix(path, "~/") && !filepath.IsAbs(path) {
+		return fmt.Errorf("database_path '%s' %w", path, errRelativePath)
+	}
+	if info, err := os.Stat(expandHome(path)); err == nil && info.IsDir() {
+		return fmt.Errorf("database_path '%s' is a directory, expected a file", path)
+	}
+	return nil
+}
+
+// schemaField is a config key derived from a yaml struct tag
+type schemaField struct {
+	name string
+	typ  reflect.Type
+	desc string
+	enum []string
+}
+
+func schemaFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		f := schemaField{name: name, typ: sf.Type, desc: sf.Tag.Get("desc")}
+		if enum := sf.Tag.Get("enum"); enum != "" {
+			f.enum = strings.Split(enum, ",")
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func findField(fields []schemaField, name string) (schemaField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return schemaField{}, false
+}
+
+// suggest proposes the known key closest to a misspelled one
+func suggest(key string, fields []schemaField) string {
+	best, bestDist := "", 3
+	for _, f := range fields {
+		if d := editDistance(key, f.name); d < bestDist {
+			best, bestDist = f.name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean '%s'?)", best)
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func mappingNode(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	if i := mappingIndex(node, key); i >= 0 {
+		return node.Content[i+1]
+	}
+	return nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func inPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " in " + path
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "the config file"
+	}
+	return path
+}
+
+// Schema returns a JSON Schema describing config.yaml, for editor completion and validation
+func Schema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "gcp-iam configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func schemaFor(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]any{}
+		for _, f := range schemaFields(t) {
+			prop := schemaFor(f.typ)
+			if f.desc != "" {
+				prop["description"] = f.desc
+			}
+			if len(f.enum) > 0 {
+				prop["enum"] = f.enum
+			}
+			properties[f.name] = prop
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int:
+		return map[string]any{"type": "integer"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
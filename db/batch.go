@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const (
+	insertRoleQuery = `
+		INSERT INTO roles (name, title, description, stage, deleted)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			title = excluded.title,
+			description = excluded.description,
+			stage = excluded.stage,
+			deleted = excluded.deleted,
+			updated_at = CURRENT_TIMESTAMP
+	`
+
+	insertPermissionQuery = `
+		INSERT OR IGNORE INTO permissions (permission, role)
+		VALUES (?, ?)
+	`
+
+	insertServiceQuery = `
+		INSERT INTO services (name, title)
+		VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			title = excluded.title,
+			updated_at = CURRENT_TIMESTAMP
+	`
+)
+
+// withTx runs fn in a transaction, committing if fn succeeds and rolling back otherwise.
+// A cancelled ctx rolls the transaction back, so interrupted batches leave no partial writes.
+func (db *DB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UpsertRoles inserts or updates roles in a single transaction using a prepared statement
+func (db *DB) UpsertRoles(roles []Role) error {
+	return db.UpsertRolesContext(context.Background(), roles)
+}
+
+// UpsertRolesContext is UpsertRoles honoring cancellation of ctx: either all roles are stored or none
+func (db *DB) UpsertRolesContext(ctx context.Context, roles []Role) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, insertRoleQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, role := range roles {
+			if _, err := stmt.ExecContext(ctx, role.Name, role.Title, role.Description, role.Stage, role.Deleted); err != nil {
+				return fmt.Errorf("failed to insert role %s: %w", role.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ReplaceRolePermissions atomically replaces the permission set of a role:
+// permissions no longer granted are removed and new ones are added in one transaction
+func (db *DB) ReplaceRolePermissions(roleName string, permissions []string) error {
+	return db.ReplaceRolePermissionsContext(context.Background(), roleName, permissions)
+}
+
+// ReplaceRolePermissionsContext is ReplaceRolePermissions honoring cancellation of ctx.
+// A cancelled replace leaves the previous permission set untouched.
+func (db *DB) ReplaceRolePermissionsContext(ctx context.Context, roleName string, permissions []string) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM permissions WHERE role = ?`, roleName); err != nil {
+			return fmt.Errorf("failed to delete permissions of role %s: %w", roleName, err)
+		}
+
+		stmt, err := tx.PrepareContext(ctx, insertPermissionQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, permission := range permissions {
+			if _, err := stmt.ExecContext(ctx, permission, roleName); err != nil {
+				return fmt.Errorf("failed to insert permission %s: %w", permission, err)
+			}
+		}
+		return nil
+	})
+}
+
+// UpsertServices inserts or updates services in a single transaction using a prepared statement
+func (db *DB) UpsertServices(services []Service) error {
+	return db.UpsertServicesContext(context.Background(), services)
+}
+
+// UpsertServicesContext is UpsertServices honoring cancellation of ctx: either all services are stored or none
+func (db *DB) UpsertServicesContext(ctx context.Context, services []Service) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, insertServiceQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, service := range services {
+			if _, err := stmt.ExecContext(ctx, service.Name, service.Title); err != nil {
+				return fmt.Errorf("failed to insert service %s: %w", service.Name, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CheckReport lists the problems found by Check. Foreign keys are declared in the schema but
+// not enforced by SQLite, so interrupted or old updates can leave rows that violate them.
+type CheckReport struct {
+	// Integrity holds the messages of PRAGMA integrity_check; empty when the file is sound
+	Integrity []string
+	// OrphanedPermissions counts permission rows whose role does not exist
+	OrphanedPermissions int
+	// PrefixedRoles counts role names in roles or permissions still carrying the legacy "roles/" prefix
+	PrefixedRoles int
+	// EmptyRoles lists active roles that have no permissions stored
+	EmptyRoles []string
+}
+
+// OK reports whether the check found no problems
+func (r *CheckReport) OK() bool {
+	return len(r.Integrity) == 0 && r.OrphanedPermissions == 0 && r.PrefixedRoles == 0 && len(r.EmptyRoles) == 0
+}
+
+// RepairResult summarizes the changes made by Repair
+type RepairResult struct {
+	Reindexed          bool
+	RenamedRoles       int64
+	DeletedDuplicates  int64
+	DeletedPermissions int64
+}
+
+// Check verifies the database file and the consistency between roles and permissions
+func (db *DB) Check() (*CheckReport, error) {
+	return db.CheckContext(context.Background())
+}
+
+// CheckContext is Check honoring cancellation of ctx
+func (db *DB) CheckContext(ctx context.Context) (*CheckReport, error) {
+	report := &CheckReport{}
+
+	rows, err := db.conn.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		if msg != "ok" {
+			report.Integrity = append(report.Integrity, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// foreign_key_check reports violations even while foreign key enforcement is off
+	fkRows, err := db.conn.QueryContext(ctx, `PRAGMA foreign_key_check(permissions)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check foreign keys: %w", err)
+	}
+	defer fkRows.Close()
+	for fkRows.Next() {
+		report.OrphanedPermissions++
+	}
+	if err := fkRows.Err(); err != nil {
+		return nil, err
+	}
+
+	prefixedQuery := `
+		SELECT (SELECT COUNT(*) FROM roles WHERE name LIKE 'roles/%')
+		     + (SELECT COUNT(DISTINCT role) FROM permissions WHERE role LIKE 'roles/%')
+	`
+	if err := db.conn.QueryRowContext(ctx, prefixedQuery).Scan(&report.PrefixedRoles); err != nil {
+		return nil, fmt.Errorf("failed to count prefixed roles: %w", err)
+	}
+
+	// Select only names so rows with NULL columns from damaged updates are still reported
+	emptyRows, err := db.conn.QueryContext(ctx, `
+		SELECT name FROM roles
+		WHERE deleted IS NOT TRUE
+		AND NOT EXISTS (SELECT 1 FROM permissions WHERE role = roles.name)
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find roles without permissions: %w", err)
+	}
+	defer emptyRows.Close()
+	for emptyRows.Next() {
+		var name string
+		if err := emptyRows.Scan(&name); err != nil {
+			return nil, err
+		}
+		report.EmptyRoles = append(report.EmptyRoles, name)
+	}
+	if err := emptyRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Repair fixes the problems Check can resolve locally: it rebuilds indexes, strips legacy
+// "roles/" prefixes (dropping prefixed duplicates of existing roles) and deletes orphaned
+// permissions. Roles without permissions need fresh data and are left for the updater.
+func (db *DB) Repair() (*RepairResult, error) {
+	return db.RepairContext(context.Background())
+}
+
+// RepairContext is Repair honoring cancellation of ctx
+func (db *DB) RepairContext(ctx context.Context) (*RepairResult, error) {
+	if err := db.writable(); err != nil {
+		return nil, err
+	}
+
+	result := &RepairResult{}
+
+	report, err := db.CheckContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Integrity) > 0 {
+		if _, err := db.conn.ExecContext(ctx, `REINDEX`); err != nil {
+			return nil, fmt.Errorf("failed to rebuild indexes: %w", err)
+		}
+		result.Reindexed = true
+	}
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM roles
+			WHERE name LIKE 'roles/%'
+			AND SUBSTR(name, 7) IN (SELECT name FROM roles)
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to delete duplicate roles: %w", err)
+		}
+		result.DeletedDuplicates, _ = res.RowsAffected()
+
+		res, err = tx.ExecContext(ctx, `UPDATE roles SET name = SUBSTR(name, 7) WHERE name LIKE 'roles/%'`)
+		if err != nil {
+			return fmt.Errorf("failed to update role names: %w", err)
+		}
+		result.RenamedRoles, _ = res.RowsAffected()
+
+		// Rows whose unprefixed twin already exists are dropped by the orphan cleanup below
+		if _, err := tx.ExecContext(ctx, `UPDATE OR IGNORE permissions SET role = SUBSTR(role, 7) WHERE role LIKE 'roles/%'`); err != nil {
+			return fmt.Errorf("failed to update permission role names: %w", err)
+		}
+
+		res, err = tx.ExecContext(ctx, `DELETE FROM permissions WHERE NOT EXISTS (SELECT 1 FROM roles WHERE name = permissions.role)`)
+		if err != nil {
+			return fmt.Errorf("failed to delete orphaned permissions: %w", err)
+		}
+		result.DeletedPermissions, _ = res.RowsAffected()
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
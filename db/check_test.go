@@ -0,0 +1,75 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckAndRepair(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	report, err := db.Check()
+	if err != nil {
+		t.Fatalf("Failed to check empty database: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected empty database to be OK, got %+v", report)
+	}
+
+	// Simulate an old, interrupted update: prefixed names, a prefixed duplicate,
+	// permissions of a role that was never stored and a role without permissions
+	broken := `
+		INSERT INTO roles (name) VALUES ('roles/storage.admin'), ('compute.viewer'), ('roles/compute.viewer'), ('pubsub.viewer');
+		INSERT INTO permissions (permission, role) VALUES
+			('storage.buckets.get', 'roles/storage.admin'),
+			('compute.instances.get', 'compute.viewer'),
+			('compute.instances.list', 'roles/compute.viewer'),
+			('iam.roles.get', 'iam.missing');
+	`
+	if _, err := db.conn.Exec(broken); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	report, err = db.Check()
+	if err != nil {
+		t.Fatalf("Failed to check database: %v", err)
+	}
+	if report.OrphanedPermissions != 1 {
+		t.Errorf("Expected 1 orphaned permission, got %d", report.OrphanedPermissions)
+	}
+	if report.PrefixedRoles != 4 {
+		t.Errorf("Expected 4 prefixed role names, got %d", report.PrefixedRoles)
+	}
+	if len(report.EmptyRoles) != 1 || report.EmptyRoles[0] != "pubsub.viewer" {
+		t.Errorf("Expected pubsub.viewer without permissions, got %v", report.EmptyRoles)
+	}
+
+	result, err := db.Repair()
+	if err != nil {
+		t.Fatalf("Failed to repair database: %v", err)
+	}
+	if result.RenamedRoles != 1 || result.DeletedDuplicates != 1 || result.DeletedPermissions != 1 {
+		t.Errorf("Unexpected repair result: %+v", result)
+	}
+
+	report, err = db.Check()
+	if err != nil {
+		t.Fatalf("Failed to check repaired database: %v", err)
+	}
+	if report.OrphanedPermissions != 0 || report.PrefixedRoles != 0 || len(report.Integrity) != 0 {
+		t.Errorf("Expected repaired database to be consistent, got %+v", report)
+	}
+
+	perms, err := db.GetRolePermissions("compute.viewer")
+	if err != nil || len(perms) != 2 {
+		t.Errorf("Expected prefixed duplicate permissions to be merged, got %v (%v)", perms, err)
+	}
+	perms, err = db.GetRolePermissions("storage.admin")
+	if err != nil || len(perms) != 1 {
+		t.Errorf("Expected storage.admin permissions to be kept, got %v (%v)", perms, err)
+	}
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 
@@ -10,11 +12,38 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// ErrReadOnly is returned by write methods of a database opened with WithReadOnly
+var ErrReadOnly = errors.New("database is opened read-only")
+
+// DB is the local IAM database. Every query method has a ...Context variant that honors
+// cancellation; the plain methods use context.Background().
 type DB struct {
-	conn *sql.DB
+	conn     *sql.DB
+	readOnly bool
 }
 
-func New(dbPath string) (*DB, error) {
+// Option configures New
+type Option func(*DB)
+
+// WithReadOnly opens an existing database read-only and immutable, e.g. a prebuilt
+// database shared on an NFS or read-only mount. The schema is not created and
+// write methods fail with ErrReadOnly.
+func WithReadOnly() Option {
+	return func(db *DB) {
+		db.readOnly = true
+	}
+}
+
+func New(dbPath string, opts ...Option) (*DB, error) {
+	db := &DB{}
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	if db.readOnly {
+		return db.openReadOnly(dbPath)
+	}
+
 	if err := ensureDir(dbPath); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
@@ -24,7 +53,7 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db.conn = conn
 	if err := db.createTables(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to create tables: %w", err)
@@ -33,6 +62,41 @@ func New(dbPath string) (*DB, error) {
 	return db, nil
 }
 
+// openReadOnly opens dbPath with mode=ro and immutable=1, so SQLite neither writes
+// nor takes locks, which is unreliable on network file systems
+func (db *DB) openReadOnly(dbPath string) (*DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("read-only database %s is not available: %w", dbPath, err)
+	}
+
+	dsn := "file:" + (&url.URL{Path: dbPath}).EscapedPath() + "?mode=ro&immutable=1"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open read-only database %s: %w", dbPath, err)
+	}
+
+	db.conn = conn
+	return db, nil
+}
+
+// ReadOnly reports whether the database was opened with WithReadOnly
+func (db *DB) ReadOnly() bool {
+	return db.readOnly
+}
+
+// writable returns ErrReadOnly if the database must not be modified
+func (db *DB) writable() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
@@ -69,6 +133,11 @@ func (db *DB) createTables() error {
 
 	CREATE INDEX IF NOT EXISTS idx_services_name ON services(name);
 	CREATE INDEX IF NOT EXISTS idx_services_title ON services(title);
+
+	CREATE TABLE IF NOT EXISTS metadata (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
 	`
 
 	_, err := db.conn.Exec(schema)
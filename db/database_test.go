@@ -1,9 +1,13 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestDatabaseCreation(t *testing.T) {
@@ -420,3 +424,198 @@ func TestSearchPermissions(t *testing.T) {
 		t.Errorf("Expected 2 results, got %d", len(results))
 	}
 }
+
+func TestContextCancellation(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.SearchRolesContext(ctx, "storage"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	roles := []Role{{Name: "storage.admin"}, {Name: "storage.objectViewer"}}
+	if err := db.UpsertRolesContext(ctx, roles); err == nil {
+		t.Error("Expected cancelled batch insert to fail")
+	}
+
+	count, err := db.CountRoles()
+	if err != nil {
+		t.Fatalf("Failed to count roles: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected cancelled batch to store no roles, got %d", count)
+	}
+}
+
+func TestBatchInserts(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	roles := []Role{{Name: "storage.admin", Title: "Storage Admin"}, {Name: "storage.objectViewer"}}
+	if err := db.UpsertRolesContext(ctx, roles); err != nil {
+		t.Fatalf("Failed to insert roles: %v", err)
+	}
+
+	permissions := []string{"storage.buckets.get", "storage.objects.get"}
+	if err := db.ReplaceRolePermissionsContext(ctx, "storage.admin", permissions); err != nil {
+		t.Fatalf("Failed to insert permissions: %v", err)
+	}
+
+	services := []Service{{Name: "storage.googleapis.com", Title: "Cloud Storage"}}
+	if err := db.UpsertServicesContext(ctx, services); err != nil {
+		t.Fatalf("Failed to insert services: %v", err)
+	}
+
+	stored, err := db.GetRolePermissionsContext(ctx, "storage.admin")
+	if err != nil || len(stored) != 2 {
+		t.Errorf("Expected 2 permissions, got %v (%v)", stored, err)
+	}
+
+	needing, err := db.GetRolesNeedingPermissionUpdateContext(ctx)
+	if err != nil || len(needing) != 1 || needing[0].Name != "storage.objectViewer" {
+		t.Errorf("Expected storage.objectViewer to need permissions, got %v (%v)", needing, err)
+	}
+
+	if count, _ := db.CountServicesContext(ctx); count != 1 {
+		t.Errorf("Expected 1 service, got %d", count)
+	}
+}
+
+func TestReplaceRolePermissions(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UpsertRoles([]Role{{Name: "storage.admin"}}); err != nil {
+		t.Fatalf("Failed to insert roles: %v", err)
+	}
+	if err := db.ReplaceRolePermissions("storage.admin", []string{"storage.buckets.get", "storage.buckets.delete"}); err != nil {
+		t.Fatalf("Failed to store permissions: %v", err)
+	}
+
+	// A new set drops permissions that are no longer granted
+	if err := db.ReplaceRolePermissions("storage.admin", []string{"storage.buckets.get", "storage.objects.get"}); err != nil {
+		t.Fatalf("Failed to replace permissions: %v", err)
+	}
+	stored, err := db.GetRolePermissions("storage.admin")
+	if err != nil {
+		t.Fatalf("Failed to get permissions: %v", err)
+	}
+	if len(stored) != 2 || slices.ContainsFunc(stored, func(p Permission) bool { return p.Permission == "storage.buckets.delete" }) {
+		t.Errorf("Expected stale permission to be removed, got %v", stored)
+	}
+
+	// A cancelled replace keeps the previous set intact
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.ReplaceRolePermissionsContext(ctx, "storage.admin", []string{"storage.objects.list"}); err == nil {
+		t.Error("Expected cancelled replace to fail")
+	}
+	stored, err = db.GetRolePermissions("storage.admin")
+	if err != nil || len(stored) != 2 {
+		t.Errorf("Expected previous permissions to survive, got %v (%v)", stored, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "shared db.sqlite")
+
+	if _, err := New(dbPath, WithReadOnly()); err == nil {
+		t.Error("Expected opening a missing read-only database to fail")
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Error("Expected read-only mode not to create the database file")
+	}
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := db.UpsertRoles([]Role{{Name: "storage.admin", Title: "Storage Admin"}}); err != nil {
+		t.Fatalf("Failed to insert roles: %v", err)
+	}
+	if err := db.ReplaceRolePermissions("storage.admin", []string{"storage.buckets.get"}); err != nil {
+		t.Fatalf("Failed to insert permissions: %v", err)
+	}
+	db.Close()
+
+	ro, err := New(dbPath, WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to open read-only database: %v", err)
+	}
+	defer ro.Close()
+
+	if !ro.ReadOnly() {
+		t.Error("Expected ReadOnly to report true")
+	}
+	if role, err := ro.GetRoleByName("storage.admin"); err != nil || role.Title != "Storage Admin" {
+		t.Errorf("Expected to read storage.admin, got %v (%v)", role, err)
+	}
+
+	if err := ro.UpsertRoles([]Role{{Name: "storage.viewer"}}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from batch write, got %v", err)
+	}
+	if err := ro.InsertRole(&Role{Name: "storage.viewer"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from single write, got %v", err)
+	}
+	if _, err := ro.Repair(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from repair, got %v", err)
+	}
+}
+
+func TestLastUpdate(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if last, err := db.LastUpdate(ResourceServices); err != nil || !last.IsZero() {
+		t.Errorf("Expected no update time for an empty database, got %v (%v)", last, err)
+	}
+
+	// Without a recorded time the newest row is used
+	if err := db.UpsertServices([]Service{{Name: "storage.googleapis.com"}}); err != nil {
+		t.Fatalf("Failed to insert services: %v", err)
+	}
+	if last, err := db.LastUpdate(ResourceServices); err != nil || time.Since(last) > time.Hour {
+		t.Errorf("Expected fallback to the newest service, got %v (%v)", last, err)
+	}
+
+	recorded := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := db.SetLastUpdate(ResourceServices, recorded); err != nil {
+		t.Fatalf("Failed to set last update: %v", err)
+	}
+	if last, err := db.LastUpdate(ResourceServices); err != nil || !last.Equal(recorded) {
+		t.Errorf("Expected %v, got %v (%v)", recorded, last, err)
+	}
+
+	// Read-only databases built before the metadata table existed still report an age
+	if _, err := db.conn.Exec(`DROP TABLE metadata`); err != nil {
+		t.Fatalf("Failed to drop metadata: %v", err)
+	}
+	ro, err := New(dbPath, WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to open read-only database: %v", err)
+	}
+	defer ro.Close()
+	if last, err := ro.LastUpdate(ResourceServices); err != nil || last.IsZero() {
+		t.Errorf("Expected fallback without metadata table, got %v (%v)", last, err)
+	}
+	if err := ro.SetLastUpdate(ResourceServices, recorded); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
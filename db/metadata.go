@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Resource types whose last successful update is recorded in the metadata table
+const (
+	ResourceRoles       = "roles"
+	ResourcePermissions = "permissions"
+	ResourceServices    = "services"
+)
+
+// Resources lists the resource types in display order
+var Resources = []string{ResourceRoles, ResourcePermissions, ResourceServices}
+
+// lastUpdateKey is the metadata key holding the last update time of a resource type
+func lastUpdateKey(resource string) string {
+	return "last_update." + resource
+}
+
+// fallbackUpdateQueries estimate the last update of databases filled before update times
+// were recorded, from the newest row timestamp
+var fallbackUpdateQueries = map[string]string{
+	ResourceRoles:       `SELECT MAX(updated_at) FROM roles`,
+	ResourcePermissions: `SELECT MAX(created_at) FROM permissions`,
+	ResourceServices:    `SELECT MAX(updated_at) FROM services`,
+}
+
+// SetLastUpdate records t as the last successful update of resource
+func (db *DB) SetLastUpdate(resource string, t time.Time) error {
+	return db.SetLastUpdateContext(context.Background(), resource, t)
+}
+
+// SetLastUpdateContext is SetLastUpdate honoring cancellation of ctx
+func (db *DB) SetLastUpdateContext(ctx context.Context, resource string, t time.Time) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO metadata (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`
+	_, err := db.conn.ExecContext(ctx, query, lastUpdateKey(resource), t.UTC().Format(time.RFC3339))
+	return err
+}
+
+// LastUpdate returns when resource was last updated successfully, or the zero time if it
+// never was. Databases filled before update times were recorded fall back to the newest
+// row of the resource.
+func (db *DB) LastUpdate(resource string) (time.Time, error) {
+	return db.LastUpdateContext(context.Background(), resource)
+}
+
+// LastUpdateContext is LastUpdate honoring cancellation of ctx
+func (db *DB) LastUpdateContext(ctx context.Context, resource string) (time.Time, error) {
+	var value string
+	err := db.conn.QueryRowContext(ctx, `SELECT value FROM metadata WHERE key = ?`, lastUpdateKey(resource)).Scan(&value)
+	if err == nil {
+		return time.Parse(time.RFC3339, value)
+	}
+	// read-only databases built before the metadata table existed lack it
+	if !errors.Is(err, sql.ErrNoRows) && !strings.Contains(err.Error(), "no such table") {
+		return time.Time{}, err
+	}
+
+	query, ok := fallbackUpdateQueries[resource]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown resource type '%s'", resource)
+	}
+
+	var newest any
+	if err := db.conn.QueryRowContext(ctx, query).Scan(&newest); err != nil {
+		return time.Time{}, err
+	}
+	return parseTimestamp(newest)
+}
+
+// parseTimestamp converts a timestamp returned by an aggregate, which SQLite gives
+// without the column type, into a time
+func parseTimestamp(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range []string{time.DateTime, time.RFC3339Nano} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s'", v)
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %v", v)
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -30,36 +31,42 @@ type Service struct {
 }
 
 func (db *DB) InsertRole(role *Role) error {
-	query := `
-		INSERT INTO roles (name, title, description, stage, deleted)
-		VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(name) DO UPDATE SET
-			title = excluded.title,
-			description = excluded.description,
-			stage = excluded.stage,
-			deleted = excluded.deleted,
-			updated_at = CURRENT_TIMESTAMP
-	`
-	_, err := db.conn.Exec(query, role.Name, role.Title, role.Description, role.Stage, role.Deleted)
+	return db.InsertRoleContext(context.Background(), role)
+}
+
+func (db *DB) InsertRoleContext(ctx context.Context, role *Role) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	_, err := db.conn.ExecContext(ctx, insertRoleQuery, role.Name, role.Title, role.Description, role.Stage, role.Deleted)
 	return err
 }
 
 func (db *DB) InsertPermission(perm *Permission) error {
-	query := `
-		INSERT OR IGNORE INTO permissions (permission, role)
-		VALUES (?, ?)
-	`
-	_, err := db.conn.Exec(query, perm.Permission, perm.Role)
+	return db.InsertPermissionContext(context.Background(), perm)
+}
+
+func (db *DB) InsertPermissionContext(ctx context.Context, perm *Permission) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	_, err := db.conn.ExecContext(ctx, insertPermissionQuery, perm.Permission, perm.Role)
 	return err
 }
 
 func (db *DB) GetRoleByName(name string) (*Role, error) {
+	return db.GetRoleByNameContext(context.Background(), name)
+}
+
+func (db *DB) GetRoleByNameContext(ctx context.Context, name string) (*Role, error) {
 	query := `
 		SELECT name, title, description, stage, deleted, created_at, updated_at
 		FROM roles
 		WHERE name = ? AND deleted = FALSE
 	`
-	row := db.conn.QueryRow(query, name)
+	row := db.conn.QueryRowContext(ctx, query, name)
 
 	var role Role
 	err := row.Scan(&role.Name, &role.Title, &role.Description, &role.Stage, &role.Deleted, &role.CreatedAt, &role.UpdatedAt)
@@ -74,13 +81,17 @@ func (db *DB) GetRoleByName(name string) (*Role, error) {
 }
 
 func (db *DB) GetPermissionByName(name string) (*Permission, error) {
+	return db.GetPermissionByNameContext(context.Background(), name)
+}
+
+func (db *DB) GetPermissionByNameContext(ctx context.Context, name string) (*Permission, error) {
 	query := `
 		SELECT permission, role, created_at
 		FROM permissions
 		WHERE permission = ?
 		LIMIT 1
 	`
-	row := db.conn.QueryRow(query, name)
+	row := db.conn.QueryRowContext(ctx, query, name)
 
 	var perm Permission
 	err := row.Scan(&perm.Permission, &perm.Role, &perm.CreatedAt)
@@ -95,13 +106,17 @@ func (db *DB) GetPermissionByName(name string) (*Permission, error) {
 }
 
 func (db *DB) GetRolePermissions(roleName string) ([]Permission, error) {
+	return db.GetRolePermissionsContext(context.Background(), roleName)
+}
+
+func (db *DB) GetRolePermissionsContext(ctx context.Context, roleName string) ([]Permission, error) {
 	query := `
 		SELECT permission, role, created_at
 		FROM permissions
 		WHERE role = ?
 		ORDER BY permission
 	`
-	rows, err := db.conn.Query(query, roleName)
+	rows, err := db.conn.QueryContext(ctx, query, roleName)
 	if err != nil {
 		return nil, err
 	}
@@ -120,14 +135,50 @@ func (db *DB) GetRolePermissions(roleName string) ([]Permission, error) {
 	return permissions, rows.Err()
 }
 
+// GetRolePermissionNames returns the sorted names of the permissions of a role, an empty
+// list if it has none
+func (db *DB) GetRolePermissionNames(roleName string) ([]string, error) {
+	return db.GetRolePermissionNamesContext(context.Background(), roleName)
+}
+
+func (db *DB) GetRolePermissionNamesContext(ctx context.Context, roleName string) ([]string, error) {
+	query := `
+		SELECT permission
+		FROM permissions
+		WHERE role = ?
+		ORDER BY permission
+	`
+	rows, err := db.conn.QueryContext(ctx, query, roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissionNames := []string{}
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		permissionNames = append(permissionNames, name)
+	}
+
+	return permissionNames, rows.Err()
+}
+
 func (db *DB) GetAllRoles() ([]Role, error) {
+	return db.GetAllRolesContext(context.Background())
+}
+
+func (db *DB) GetAllRolesContext(ctx context.Context) ([]Role, error) {
 	sqlQuery := `
 		SELECT name, title, description, stage, deleted, created_at, updated_at
 		FROM roles
 		WHERE deleted = FALSE
 		ORDER BY name
 	`
-	rows, err := db.conn.Query(sqlQuery)
+	rows, err := db.conn.QueryContext(ctx, sqlQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -147,6 +198,10 @@ func (db *DB) GetAllRoles() ([]Role, error) {
 }
 
 func (db *DB) SearchRoles(query string) ([]Role, error) {
+	return db.SearchRolesContext(context.Background(), query)
+}
+
+func (db *DB) SearchRolesContext(ctx context.Context, query string) ([]Role, error) {
 	sqlQuery := `
 		SELECT name, title, description, stage, deleted, created_at, updated_at
 		FROM roles
@@ -154,7 +209,7 @@ func (db *DB) SearchRoles(query string) ([]Role, error) {
 		ORDER BY name
 	`
 	pattern := "%" + query + "%"
-	rows, err := db.conn.Query(sqlQuery, pattern, pattern, pattern)
+	rows, err := db.conn.QueryContext(ctx, sqlQuery, pattern, pattern, pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -174,6 +229,10 @@ func (db *DB) SearchRoles(query string) ([]Role, error) {
 }
 
 func (db *DB) SearchPermissions(query string) ([]Permission, error) {
+	return db.SearchPermissionsContext(context.Background(), query)
+}
+
+func (db *DB) SearchPermissionsContext(ctx context.Context, query string) ([]Permission, error) {
 	sqlQuery := `
 		SELECT DISTINCT permission
 		FROM permissions
@@ -181,7 +240,7 @@ func (db *DB) SearchPermissions(query string) ([]Permission, error) {
 		ORDER BY permission
 	`
 	pattern := "%" + query + "%"
-	rows, err := db.conn.Query(sqlQuery, pattern)
+	rows, err := db.conn.QueryContext(ctx, sqlQuery, pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -201,6 +260,10 @@ func (db *DB) SearchPermissions(query string) ([]Permission, error) {
 }
 
 func (db *DB) GetRolesWithPermission(permissionName string) ([]Role, error) {
+	return db.GetRolesWithPermissionContext(context.Background(), permissionName)
+}
+
+func (db *DB) GetRolesWithPermissionContext(ctx context.Context, permissionName string) ([]Role, error) {
 	query := `
 		SELECT r.name, r.title, r.description, r.stage, r.deleted, r.created_at, r.updated_at
 		FROM roles r
@@ -208,7 +271,7 @@ func (db *DB) GetRolesWithPermission(permissionName string) ([]Role, error) {
 		WHERE p.permission = ? AND r.deleted = FALSE
 		ORDER BY r.name
 	`
-	rows, err := db.conn.Query(query, permissionName)
+	rows, err := db.conn.QueryContext(ctx, query, permissionName)
 	if err != nil {
 		return nil, err
 	}
@@ -228,6 +291,10 @@ func (db *DB) GetRolesWithPermission(permissionName string) ([]Role, error) {
 }
 
 func (db *DB) GetRolesNeedingPermissionUpdate() ([]Role, error) {
+	return db.GetRolesNeedingPermissionUpdateContext(context.Background())
+}
+
+func (db *DB) GetRolesNeedingPermissionUpdateContext(ctx context.Context) ([]Role, error) {
 	query := `
 		SELECT name, title, description, stage, deleted, created_at, updated_at
 		FROM roles
@@ -237,7 +304,7 @@ func (db *DB) GetRolesNeedingPermissionUpdate() ([]Role, error) {
 		)
 		ORDER BY name
 	`
-	rows, err := db.conn.Query(query)
+	rows, err := db.conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -257,13 +324,17 @@ func (db *DB) GetRolesNeedingPermissionUpdate() ([]Role, error) {
 }
 
 func (db *DB) HasPermissions(roleName string) (bool, error) {
+	return db.HasPermissionsContext(context.Background(), roleName)
+}
+
+func (db *DB) HasPermissionsContext(ctx context.Context, roleName string) (bool, error) {
 	query := `
 		SELECT COUNT(*)
 		FROM permissions
 		WHERE role = ?
 	`
 	var count int
-	err := db.conn.QueryRow(query, roleName).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query, roleName).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -271,28 +342,41 @@ func (db *DB) HasPermissions(roleName string) (bool, error) {
 }
 
 func (db *DB) CountRoles() (int, error) {
+	return db.CountRolesContext(context.Background())
+}
+
+func (db *DB) CountRolesContext(ctx context.Context) (int, error) {
 	query := `SELECT COUNT(*) FROM roles WHERE deleted = FALSE`
 	var count int
-	err := db.conn.QueryRow(query).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 func (db *DB) CountPermissions() (int, error) {
+	return db.CountPermissionsContext(context.Background())
+}
+
+func (db *DB) CountPermissionsContext(ctx context.Context) (int, error) {
 	query := `SELECT COUNT(DISTINCT permission) FROM permissions`
 	var count int
-	err := db.conn.QueryRow(query).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 // GetRoleNames returns a list of all role names for completion
 func (db *DB) GetRoleNames() ([]string, error) {
+	return db.GetRoleNamesContext(context.Background())
+}
+
+// GetRoleNamesContext is GetRoleNames honoring cancellation of ctx
+func (db *DB) GetRoleNamesContext(ctx context.Context) ([]string, error) {
 	query := `
 		SELECT name
 		FROM roles
 		WHERE deleted = FALSE
 		ORDER BY name
 	`
-	rows, err := db.conn.Query(query)
+	rows, err := db.conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -313,12 +397,17 @@ func (db *DB) GetRoleNames() ([]string, error) {
 
 // GetPermissionNames returns a list of all unique permission names for completion
 func (db *DB) GetPermissionNames() ([]string, error) {
+	return db.GetPermissionNamesContext(context.Background())
+}
+
+// GetPermissionNamesContext is GetPermissionNames honoring cancellation of ctx
+func (db *DB) GetPermissionNamesContext(ctx context.Context) ([]string, error) {
 	query := `
 		SELECT DISTINCT permission
 		FROM permissions
 		ORDER BY permission
 	`
-	rows, err := db.conn.Query(query)
+	rows, err := db.conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -340,24 +429,29 @@ func (db *DB) GetPermissionNames() ([]string, error) {
 // Service-related methods
 
 func (db *DB) InsertService(service *Service) error {
-	query := `
-		INSERT INTO services (name, title)
-		VALUES (?, ?)
-		ON CONFLICT(name) DO UPDATE SET
-			title = excluded.title,
-			updated_at = CURRENT_TIMESTAMP
-	`
-	_, err := db.conn.Exec(query, service.Name, service.Title)
+	return db.InsertServiceContext(context.Background(), service)
+}
+
+func (db *DB) InsertServiceContext(ctx context.Context, service *Service) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	_, err := db.conn.ExecContext(ctx, insertServiceQuery, service.Name, service.Title)
 	return err
 }
 
 func (db *DB) GetServiceByName(name string) (*Service, error) {
+	return db.GetServiceByNameContext(context.Background(), name)
+}
+
+func (db *DB) GetServiceByNameContext(ctx context.Context, name string) (*Service, error) {
 	query := `
 		SELECT name, title, created_at, updated_at
 		FROM services
 		WHERE name = ?
 	`
-	row := db.conn.QueryRow(query, name)
+	row := db.conn.QueryRowContext(ctx, query, name)
 
 	var service Service
 	err := row.Scan(&service.Name, &service.Title, &service.CreatedAt, &service.UpdatedAt)
@@ -372,6 +466,10 @@ func (db *DB) GetServiceByName(name string) (*Service, error) {
 }
 
 func (db *DB) SearchServices(query string) ([]Service, error) {
+	return db.SearchServicesContext(context.Background(), query)
+}
+
+func (db *DB) SearchServicesContext(ctx context.Context, query string) ([]Service, error) {
 	sqlQuery := `
 		SELECT name, title, created_at, updated_at
 		FROM services
@@ -379,7 +477,7 @@ func (db *DB) SearchServices(query string) ([]Service, error) {
 		ORDER BY name
 	`
 	pattern := "%" + query + "%"
-	rows, err := db.conn.Query(sqlQuery, pattern, pattern)
+	rows, err := db.conn.QueryContext(ctx, sqlQuery, pattern, pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -399,12 +497,16 @@ func (db *DB) SearchServices(query string) ([]Service, error) {
 }
 
 func (db *DB) GetAllServices() ([]Service, error) {
+	return db.GetAllServicesContext(context.Background())
+}
+
+func (db *DB) GetAllServicesContext(ctx context.Context) ([]Service, error) {
 	sqlQuery := `
 		SELECT name, title, created_at, updated_at
 		FROM services
 		ORDER BY name
 	`
-	rows, err := db.conn.Query(sqlQuery)
+	rows, err := db.conn.QueryContext(ctx, sqlQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -424,12 +526,16 @@ func (db *DB) GetAllServices() ([]Service, error) {
 }
 
 func (db *DB) GetServiceNames() ([]string, error) {
+	return db.GetServiceNamesContext(context.Background())
+}
+
+func (db *DB) GetServiceNamesContext(ctx context.Context) ([]string, error) {
 	query := `
 		SELECT name
 		FROM services
 		ORDER BY name
 	`
-	rows, err := db.conn.Query(query)
+	rows, err := db.conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -449,35 +555,44 @@ func (db *DB) GetServiceNames() ([]string, error) {
 }
 
 func (db *DB) CountServices() (int, error) {
+	return db.CountServicesContext(context.Background())
+}
+
+func (db *DB) CountServicesContext(ctx context.Context) (int, error) {
 	query := `SELECT COUNT(*) FROM services`
 	var count int
-	err := db.conn.QueryRow(query).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 // MigrateRoleNames removes "roles/" prefix from existing role names in database
 func (db *DB) MigrateRoleNames() error {
-	// Update roles table
-	updateRolesQuery := `
-		UPDATE roles 
-		SET name = SUBSTR(name, 7)
-		WHERE name LIKE 'roles/%'
-	`
-	_, err := db.conn.Exec(updateRolesQuery)
-	if err != nil {
-		return fmt.Errorf("failed to update role names: %w", err)
-	}
+	return db.MigrateRoleNamesContext(context.Background())
+}
 
-	// Update permissions table
-	updatePermissionsQuery := `
-		UPDATE permissions 
-		SET role = SUBSTR(role, 7)
-		WHERE role LIKE 'roles/%'
-	`
-	_, err = db.conn.Exec(updatePermissionsQuery)
-	if err != nil {
-		return fmt.Errorf("failed to update permission role names: %w", err)
-	}
+// MigrateRoleNamesContext is MigrateRoleNames honoring cancellation of ctx
+func (db *DB) MigrateRoleNamesContext(ctx context.Context) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		// Update roles table
+		updateRolesQuery := `
+			UPDATE roles
+			SET name = SUBSTR(name, 7)
+			WHERE name LIKE 'roles/%'
+		`
+		if _, err := tx.ExecContext(ctx, updateRolesQuery); err != nil {
+			return fmt.Errorf("failed to update role names: %w", err)
+		}
+
+		// Update permissions table
+		updatePermissionsQuery := `
+			UPDATE permissions
+			SET role = SUBSTR(role, 7)
+			WHERE role LIKE 'roles/%'
+		`
+		if _, err := tx.ExecContext(ctx, updatePermissionsQuery); err != nil {
+			return fmt.Errorf("failed to update permission role names: %w", err)
+		}
 
-	return nil
+		return nil
+	})
 }
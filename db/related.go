@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"sort"
+)
+
+// RelatedPermission is a permission granted by roles that also grant another permission
+type RelatedPermission struct {
+	Permission string `json:"permission"`
+	// Count is the number of roles granting both permissions
+	Count int `json:"count"`
+	// Confidence is the share of the roles granting the other permission that grant this one too
+	Confidence float64 `json:"confidence"`
+	// Lift is how many times more often the two permissions are granted together than if
+	// roles picked them independently; above 1 they go together, below 1 they avoid each other
+	Lift float64 `json:"lift"`
+}
+
+// RelatedPermissions ranks the permissions granted alongside permission by the roles,
+// most frequently co-granted first. Ties go to the higher lift. Deleted roles are ignored.
+func (db *DB) RelatedPermissions(permission string) ([]RelatedPermission, error) {
+	return db.RelatedPermissionsContext(context.Background(), permission)
+}
+
+// RelatedPermissionsContext is RelatedPermissions honoring cancellation of ctx
+func (db *DB) RelatedPermissionsContext(ctx context.Context, permission string) ([]RelatedPermission, error) {
+	query := `
+		WITH
+		granted AS (
+			SELECT p.role, p.permission
+			FROM permissions p JOIN roles r ON r.name = p.role
+			WHERE r.deleted IS NOT TRUE
+		),
+		holders AS (
+			SELECT role FROM granted WHERE permission = ?
+		),
+		together AS (
+			SELECT g.permission, COUNT(*) AS together
+			FROM granted g JOIN holders h ON h.role = g.role
+			WHERE g.permission != ?
+			GROUP BY g.permission
+		),
+		totals AS (
+			SELECT permission, COUNT(*) AS total
+			FROM granted
+			WHERE permission IN (SELECT permission FROM together)
+			GROUP BY permission
+		)
+		SELECT t.permission, t.together, n.total,
+		       (SELECT COUNT(*) FROM holders), (SELECT COUNT(DISTINCT role) FROM granted)
+		FROM together t
+		JOIN totals n ON n.permission = t.permission
+	`
+	rows, err := db.conn.QueryContext(ctx, query, permission, permission)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var related []RelatedPermission
+	for rows.Next() {
+		var (
+			r                     RelatedPermission
+			total, holders, roles int
+		)
+		if err := rows.Scan(&r.Permission, &r.Count, &total, &holders, &roles); err != nil {
+			return nil, err
+		}
+
+		r.Confidence = float64(r.Count) / float64(holders)
+		r.Lift = float64(r.Count) * float64(roles) / (float64(holders) * float64(total))
+		related = append(related, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(related, func(i, j int) bool {
+		a, b := related[i], related[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Lift != b.Lift {
+			return a.Lift > b.Lift
+		}
+		return a.Permission < b.Permission
+	})
+	return related, nil
+}
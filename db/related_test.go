@@ -0,0 +1,76 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRelatedPermissions(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	grants := map[string][]string{
+		"storage.admin":        {"storage.buckets.create", "storage.objects.create", "storage.objects.get", "storage.objects.list", "resourcemanager.projects.get"},
+		"storage.objectUser":   {"storage.objects.create", "storage.objects.get", "storage.objects.list", "resourcemanager.projects.get"},
+		"storage.objectViewer": {"storage.objects.get", "storage.objects.list", "resourcemanager.projects.get"},
+		"browser":              {"resourcemanager.projects.get"},
+		"compute.viewer":       {"compute.instances.get", "resourcemanager.projects.get"},
+		"pubsub.viewer":        {"pubsub.topics.get"},
+	}
+	for role, permissions := range grants {
+		if err := db.InsertRole(&Role{Name: role, Title: role}); err != nil {
+			t.Fatalf("Failed to insert role: %v", err)
+		}
+		if err := db.ReplaceRolePermissions(role, permissions); err != nil {
+			t.Fatalf("Failed to insert permissions: %v", err)
+		}
+	}
+
+	// A deleted role counts neither as a holder nor towards the totals
+	if err := db.InsertRole(&Role{Name: "storage.legacyAdmin", Title: "storage.legacyAdmin", Deleted: true}); err != nil {
+		t.Fatalf("Failed to insert role: %v", err)
+	}
+	if err := db.ReplaceRolePermissions("storage.legacyAdmin", []string{"storage.objects.get", "storage.legacy.get"}); err != nil {
+		t.Fatalf("Failed to insert permissions: %v", err)
+	}
+
+	related, err := db.RelatedPermissions("storage.objects.get")
+	if err != nil {
+		t.Fatalf("Failed to find related permissions: %v", err)
+	}
+
+	// Three of the six roles grant storage.objects.get. resourcemanager.projects.get is
+	// granted by all three but also by most other roles, so its lift is lower.
+	expected := []RelatedPermission{
+		{Permission: "storage.objects.list", Count: 3, Confidence: 1, Lift: 2},
+		{Permission: "resourcemanager.projects.get", Count: 3, Confidence: 1, Lift: 1.2},
+		{Permission: "storage.objects.create", Count: 2, Confidence: 2.0 / 3, Lift: 2},
+		{Permission: "storage.buckets.create", Count: 1, Confidence: 1.0 / 3, Lift: 2},
+	}
+	if len(related) != len(expected) {
+		t.Fatalf("Expected %d related permissions, got %+v", len(expected), related)
+	}
+	for i, r := range related {
+		want := expected[i]
+		if r.Permission != want.Permission || r.Count != want.Count {
+			t.Errorf("Rank %d: expected %+v, got %+v", i+1, want, r)
+		}
+		if diff := r.Confidence - want.Confidence; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Rank %d: expected confidence %f, got %f", i+1, want.Confidence, r.Confidence)
+		}
+		if diff := r.Lift - want.Lift; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Rank %d: expected lift %f, got %f", i+1, want.Lift, r.Lift)
+		}
+	}
+
+	related, err = db.RelatedPermissions("unknown.permission.get")
+	if err != nil {
+		t.Fatalf("Failed to find related permissions: %v", err)
+	}
+	if len(related) != 0 {
+		t.Errorf("Expected no related permissions for an unknown permission, got %+v", related)
+	}
+}
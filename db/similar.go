@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Similarity metrics accepted by SimilarRoles
+const (
+	// SimilarityJaccard divides the permissions two roles share by the permissions of either
+	SimilarityJaccard = "jaccard"
+	// SimilarityWeighted is the Jaccard similarity with every permission weighted by its
+	// rarity, 1 + ln(roles / roles granting it), so sharing a permission few roles grant
+	// counts more than sharing one almost every role grants
+	SimilarityWeighted = "weighted"
+)
+
+// SimilarityMetrics lists the metrics accepted by SimilarRoles
+var SimilarityMetrics = []string{SimilarityJaccard, SimilarityWeighted}
+
+// SimilarRole is a role ranked by the similarity of its permissions to another role
+type SimilarRole struct {
+	Role       Role    `json:"role"`
+	Similarity float64 `json:"similarity"`
+	// Shared counts the permissions both roles grant
+	Shared int `json:"shared"`
+	// Missing counts the permissions of the other role this role lacks
+	Missing int `json:"missing"`
+	// Extra counts the permissions this role grants beyond the other role
+	Extra int `json:"extra"`
+}
+
+// The queries of SimilarRoles count, for the target role and every role sharing a
+// permission with it, the permissions (and their weights) of the role and the shared ones;
+// the union follows from them. Weighing every grant is slow, so Jaccard leaves it out.
+// Weights only count roles that are not deleted, whose grants are the only ones ranked.
+const (
+	jaccardCTEs = `
+		WITH
+		target AS (
+			SELECT permission, 0.0 AS weight FROM permissions WHERE role = ?
+		),
+		shared AS (
+			SELECT p.role, COUNT(*) AS shared, 0.0 AS shared_weight
+			FROM permissions p JOIN target t ON t.permission = p.permission
+			WHERE p.role != ?
+			GROUP BY p.role
+		),
+		totals AS (
+			SELECT role, COUNT(*) AS total, 0.0 AS total_weight
+			FROM permissions
+			WHERE role IN (SELECT role FROM shared)
+			GROUP BY role
+		)`
+	weightedCTEs = `
+		WITH
+		granted AS (
+			SELECT p.role, p.permission
+			FROM permissions p JOIN roles r ON r.name = p.role
+			WHERE r.deleted IS NOT TRUE
+		),
+		weights AS MATERIALIZED (
+			SELECT permission, 1 + ln((SELECT COUNT(DISTINCT role) FROM granted) * 1.0 / COUNT(*)) AS weight
+			FROM granted
+			GROUP BY permission
+		),
+		target AS (
+			-- a deleted target role may grant permissions no other role grants; weigh them as if it did
+			SELECT p.permission, COALESCE(w.weight, 1 + ln((SELECT COUNT(DISTINCT role) FROM granted) + 1.0)) AS weight
+			FROM permissions p LEFT JOIN weights w ON w.permission = p.permission
+			WHERE p.role = ?
+		),
+		shared AS (
+			SELECT g.role, COUNT(*) AS shared, SUM(t.weight) AS shared_weight
+			FROM granted g JOIN target t ON t.permission = g.permission
+			WHERE g.role != ?
+			GROUP BY g.role
+		),
+		totals AS (
+			SELECT g.role, COUNT(*) AS total, SUM(w.weight) AS total_weight
+			FROM granted g JOIN weights w ON w.permission = g.permission
+			WHERE g.role IN (SELECT role FROM shared)
+			GROUP BY g.role
+		)`
+)
+
+// SimilarRoles ranks the active roles sharing at least one permission with roleName by
+// metric, most similar first. Ties go to the role with fewer extra permissions.
+func (db *DB) SimilarRoles(roleName, metric string) ([]SimilarRole, error) {
+	return db.SimilarRolesContext(context.Background(), roleName, metric)
+}
+
+// SimilarRolesContext is SimilarRoles honoring cancellation of ctx
+func (db *DB) SimilarRolesContext(ctx context.Context, roleName, metric string) ([]SimilarRole, error) {
+	if metric != SimilarityJaccard && metric != SimilarityWeighted {
+		return nil, fmt.Errorf("unknown similarity metric '%s'", metric)
+	}
+
+	ctes := jaccardCTEs
+	if metric == SimilarityWeighted {
+		ctes = weightedCTEs
+	}
+	query := ctes + `
+		SELECT r.name, COALESCE(r.title, ''), COALESCE(r.description, ''), COALESCE(r.stage, ''),
+		       s.shared, s.shared_weight, t.total, t.total_weight,
+		       (SELECT COUNT(*) FROM target), (SELECT COALESCE(SUM(weight), 0) FROM target)
+		FROM shared s
+		JOIN totals t ON t.role = s.role
+		JOIN roles r ON r.name = s.role
+		WHERE r.deleted IS NOT TRUE
+	`
+	rows, err := db.conn.QueryContext(ctx, query, roleName, roleName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var similar []SimilarRole
+	for rows.Next() {
+		var (
+			s                                       SimilarRole
+			sharedWeight, totalWeight, targetWeight float64
+			total, targetTotal                      int
+		)
+		err := rows.Scan(&s.Role.Name, &s.Role.Title, &s.Role.Description, &s.Role.Stage,
+			&s.Shared, &sharedWeight, &total, &totalWeight, &targetTotal, &targetWeight)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Missing = targetTotal - s.Shared
+		s.Extra = total - s.Shared
+		if metric == SimilarityWeighted {
+			s.Similarity = sharedWeight / (targetWeight + totalWeight - sharedWeight)
+		} else {
+			s.Similarity = float64(s.Shared) / float64(targetTotal+total-s.Shared)
+		}
+		similar = append(similar, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		a, b := similar[i], similar[j]
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		if a.Extra != b.Extra {
+			return a.Extra < b.Extra
+		}
+		return a.Role.Name < b.Role.Name
+	})
+	return similar, nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSimilarRoles(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	grants := map[string][]string{
+		"storage.admin":        {"storage.buckets.create", "storage.objects.create", "storage.objects.get", "storage.objects.list", "resourcemanager.projects.get"},
+		"storage.objectUser":   {"storage.objects.create", "storage.objects.get", "storage.objects.list", "resourcemanager.projects.get"},
+		"storage.objectViewer": {"storage.objects.get", "storage.objects.list", "resourcemanager.projects.get"},
+		"browser":              {"resourcemanager.projects.get"},
+		"compute.viewer":       {"compute.instances.get", "resourcemanager.projects.get"},
+		"pubsub.viewer":        {"pubsub.topics.get"},
+	}
+	for role, permissions := range grants {
+		if err := db.InsertRole(&Role{Name: role, Title: role}); err != nil {
+			t.Fatalf("Failed to insert role: %v", err)
+		}
+		if err := db.ReplaceRolePermissions(role, permissions); err != nil {
+			t.Fatalf("Failed to insert permissions: %v", err)
+		}
+	}
+
+	similar, err := db.SimilarRoles("storage.admin", SimilarityJaccard)
+	if err != nil {
+		t.Fatalf("Failed to find similar roles: %v", err)
+	}
+
+	// pubsub.viewer shares nothing and storage.admin itself is left out
+	expected := []SimilarRole{
+		{Similarity: 0.8, Shared: 4, Missing: 1, Extra: 0},
+		{Similarity: 0.6, Shared: 3, Missing: 2, Extra: 0},
+		{Similarity: 0.2, Shared: 1, Missing: 4, Extra: 0},
+		{Similarity: 1.0 / 6, Shared: 1, Missing: 4, Extra: 1},
+	}
+	names := []string{"storage.objectUser", "storage.objectViewer", "browser", "compute.viewer"}
+	if len(similar) != len(expected) {
+		t.Fatalf("Expected %d similar roles, got %+v", len(expected), similar)
+	}
+	for i, s := range similar {
+		want := expected[i]
+		if s.Role.Name != names[i] || s.Shared != want.Shared || s.Missing != want.Missing || s.Extra != want.Extra {
+			t.Errorf("Rank %d: expected %s %+v, got %s %+v", i+1, names[i], want, s.Role.Name, s)
+		}
+		if diff := s.Similarity - want.Similarity; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Rank %d: expected similarity %f, got %f", i+1, want.Similarity, s.Similarity)
+		}
+	}
+
+	// resourcemanager.projects.get is granted by almost every role, so sharing only it
+	// weighs less than its share of the permission count
+	weighted, err := db.SimilarRoles("storage.admin", SimilarityWeighted)
+	if err != nil {
+		t.Fatalf("Failed to find weighted similar roles: %v", err)
+	}
+	for _, s := range weighted {
+		if s.Role.Name == "browser" && s.Similarity >= 0.2 {
+			t.Errorf("Expected weighted similarity of browser below 0.2, got %f", s.Similarity)
+		}
+	}
+
+	// A deleted role sharing permissions changes neither the weights nor the ranking
+	if err := db.InsertRole(&Role{Name: "storage.legacyAdmin", Title: "storage.legacyAdmin", Deleted: true}); err != nil {
+		t.Fatalf("Failed to insert role: %v", err)
+	}
+	if err := db.ReplaceRolePermissions("storage.legacyAdmin", []string{"storage.buckets.create", "storage.objects.get"}); err != nil {
+		t.Fatalf("Failed to insert permissions: %v", err)
+	}
+	withDeleted, err := db.SimilarRoles("storage.admin", SimilarityWeighted)
+	if err != nil {
+		t.Fatalf("Failed to find weighted similar roles: %v", err)
+	}
+	if len(withDeleted) != len(weighted) {
+		t.Fatalf("Expected %d weighted similar roles with a deleted role, got %+v", len(weighted), withDeleted)
+	}
+	for i, s := range withDeleted {
+		if s.Role.Name != weighted[i].Role.Name || s.Similarity != weighted[i].Similarity {
+			t.Errorf("Rank %d: expected %s %f, got %s %f", i+1, weighted[i].Role.Name, weighted[i].Similarity, s.Role.Name, s.Similarity)
+		}
+	}
+
+	if _, err := db.SimilarRoles("storage.admin", "cosine"); err == nil {
+		t.Error("Expected unknown metric to fail")
+	}
+}
@@ -3,6 +3,9 @@ package constants
 // RolePrefix is the prefix for GCP IAM role names
 const RolePrefix = "roles/"
 
+// AppName names the application's directories under XDG base directories
+const AppName = "gcp-iam"
+
 // ConfigDirName is the name of the configuration directory in the user's home
 const ConfigDirName = ".gcp-iam"
 
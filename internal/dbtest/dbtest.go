@@ -0,0 +1,46 @@
+// Package dbtest creates small IAM databases for tests
+package dbtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/db"
+)
+
+// New opens a database created by File, closed when the test ends
+func New(t testing.TB, grants map[string][]string) *db.DB {
+	t.Helper()
+
+	database, err := db.New(File(t, grants))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// File creates a database in a temporary directory holding a GA role for every key of
+// grants, titled with its name, that grants the listed permissions. It returns the path
+// of the closed database for code that opens it itself.
+func File(t testing.TB, grants map[string][]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	database, err := db.New(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	for role, permissions := range grants {
+		if err := database.InsertRole(&db.Role{Name: role, Title: role, Stage: "GA"}); err != nil {
+			t.Fatalf("Failed to insert role: %v", err)
+		}
+		if err := database.ReplaceRolePermissions(role, permissions); err != nil {
+			t.Fatalf("Failed to insert permissions: %v", err)
+		}
+	}
+
+	return path
+}
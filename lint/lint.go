@@ -0,0 +1,338 @@
+package lint
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/policy"
+)
+
+// Rule types supported in the `lint.rules` section of config.yaml
+const (
+	RuleForbidBasicRoles        = "forbid-basic-roles"
+	RuleForbidRoles             = "forbid-roles"
+	RuleForbidStages            = "forbid-stages"
+	RuleForbidPublicPermissions = "forbid-public-permissions"
+	RuleMaxMemberPermissions    = "max-member-permissions"
+)
+
+// Severity levels, named after SARIF result levels
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// BasicRoles are the legacy primitive roles granting broad access across all services
+var BasicRoles = []string{"owner", "editor", "viewer"}
+
+// PublicMembers are the special members that make a resource publicly accessible
+var PublicMembers = []string{"allUsers", "allAuthenticatedUsers"}
+
+// DefaultRules returns the rules applied when config.yaml has no lint section
+func DefaultRules() []config.LintRule {
+	return []config.LintRule{
+		{ID: "no-basic-roles", Type: RuleForbidBasicRoles, Severity: SeverityError},
+		{ID: "no-unstable-roles", Type: RuleForbidStages, Severity: SeverityWarning, Stages: []string{"DEPRECATED", "ALPHA"}},
+		{ID: "no-public-access", Type: RuleForbidPublicPermissions, Severity: SeverityError},
+	}
+}
+
+// Finding is a single rule violation
+type Finding struct {
+	RuleID   string `json:"rule_id"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	File     string `json:"file"`
+	Resource string `json:"resource,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Member   string `json:"member,omitempty"`
+}
+
+// Linter evaluates IAM policies against a set of rules using the local role database
+type Linter struct {
+	db    *db.DB
+	roles *policy.RoleCache
+	rules []config.LintRule
+}
+
+// New creates a Linter, falling back to DefaultRules when no rules are given
+func New(database *db.DB, rules []config.LintRule) (*Linter, error) {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+
+	normalized := make([]config.LintRule, 0, len(rules))
+	for i, rule := range rules {
+		rule, err := normalizeRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("lint rule %d: %w", i+1, err)
+		}
+		normalized = append(normalized, rule)
+	}
+
+	return &Linter{
+		db:    database,
+		roles: policy.NewRoleCache(database),
+		rules: normalized,
+	}, nil
+}
+
+// Rules returns the rules the linter applies, with defaults filled in
+func (l *Linter) Rules() []config.LintRule {
+	return l.rules
+}
+
+// Lint checks all bindings of the given policies, which were loaded from file
+func (l *Linter) Lint(file string, policies []policy.Policy) ([]Finding, error) {
+	var findings []Finding
+
+	for _, rule := range l.rules {
+		var ruleFindings []Finding
+		var err error
+
+		if rule.Type == RuleMaxMemberPermissions {
+			ruleFindings, err = l.checkMemberPermissions(rule, policies)
+		} else {
+			for _, p := range policies {
+				for _, binding := range p.Bindings {
+					found, err := l.checkBinding(rule, binding)
+					if err != nil {
+						return nil, err
+					}
+					for _, f := range found {
+						f.Resource = p.Resource
+						ruleFindings = append(ruleFindings, f)
+					}
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range ruleFindings {
+			f.RuleID = rule.ID
+			f.Severity = rule.Severity
+			f.File = file
+			findings = append(findings, f)
+		}
+	}
+
+	return findings, nil
+}
+
+// ValidRuleTypes lists all supported rule types
+func ValidRuleTypes() []string {
+	return []string{
+		RuleForbidBasicRoles,
+		RuleForbidRoles,
+		RuleForbidStages,
+		RuleForbidPublicPermissions,
+		RuleMaxMemberPermissions,
+	}
+}
+
+// normalizeRule validates a rule and fills in defaults
+func normalizeRule(rule config.LintRule) (config.LintRule, error) {
+	if !slices.Contains(ValidRuleTypes(), rule.Type) {
+		return rule, fmt.Errorf("unknown rule type '%s' (valid: %s)", rule.Type, strings.Join(ValidRuleTypes(), ", "))
+	}
+
+	if rule.ID == "" {
+		rule.ID = rule.Type
+	}
+
+	switch rule.Severity {
+	case "":
+		rule.Severity = SeverityError
+	case SeverityError, SeverityWarning, SeverityNote:
+	default:
+		return rule, fmt.Errorf("rule '%s': invalid severity '%s' (valid: error, warning, note)", rule.ID, rule.Severity)
+	}
+
+	switch rule.Type {
+	case RuleForbidRoles:
+		if len(rule.Roles) == 0 {
+			return rule, fmt.Errorf("rule '%s': 'roles' must not be empty", rule.ID)
+		}
+		// Copy before normalizing so the caller's config keeps its role names
+		roles := make([]string, len(rule.Roles))
+		for i, role := range rule.Roles {
+			roles[i], _ = policy.RoleName(role)
+		}
+		rule.Roles = roles
+	case RuleForbidStages:
+		if len(rule.Stages) == 0 {
+			rule.Stages = []string{"DEPRECATED", "ALPHA"}
+		}
+	case RuleForbidPublicPermissions:
+		if len(rule.Members) == 0 {
+			rule.Members = PublicMembers
+		}
+	case RuleMaxMemberPermissions:
+		if rule.Max <= 0 {
+			return rule, fmt.Errorf("rule '%s': 'max' must be greater than 0", rule.ID)
+		}
+	}
+
+	return rule, nil
+}
+
+// checkBinding applies a per-binding rule to a single binding
+func (l *Linter) checkBinding(rule config.LintRule, binding policy.Binding) ([]Finding, error) {
+	roleName, predefined := policy.RoleName(binding.Role)
+	members := strings.Join(binding.Members, ", ")
+
+	switch rule.Type {
+	case RuleForbidBasicRoles:
+		if predefined && slices.Contains(BasicRoles, roleName) {
+			return []Finding{{
+				Role:    binding.Role,
+				Message: fmt.Sprintf("basic role '%s' granted to %s", roleName, members),
+			}}, nil
+		}
+
+	case RuleForbidRoles:
+		if slices.Contains(rule.Roles, roleName) {
+			return []Finding{{
+				Role:    binding.Role,
+				Message: fmt.Sprintf("forbidden role '%s' granted to %s", roleName, members),
+			}}, nil
+		}
+
+	case RuleForbidStages:
+		if !predefined {
+			return nil, nil
+		}
+		role, err := l.db.GetRoleByName(roleName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role '%s': %w", roleName, err)
+		}
+		if role != nil && slices.Contains(rule.Stages, role.Stage) {
+			return []Finding{{
+				Role:    binding.Role,
+				Message: fmt.Sprintf("role '%s' is in %s stage, granted to %s", roleName, role.Stage, members),
+			}}, nil
+		}
+
+	case RuleForbidPublicPermissions:
+		var findings []Finding
+		for _, member := range binding.Members {
+			if !slices.Contains(rule.Members, member) {
+				continue
+			}
+
+			known, err := l.knownRole(binding.Role)
+			if err != nil {
+				return nil, err
+			}
+			// Without known permissions the binding may grant anything, so it is reported
+			// rather than let a public custom or unknown role pass unnoticed
+			if !known {
+				findings = append(findings, Finding{
+					Role:    binding.Role,
+					Member:  member,
+					Message: fmt.Sprintf("role '%s' with unknown permissions granted to %s", roleName, member),
+				})
+				continue
+			}
+
+			perms, err := l.roles.Permissions(binding.Role)
+			if err != nil {
+				return nil, err
+			}
+
+			msg := fmt.Sprintf("role '%s' grants %d permissions to %s", roleName, len(perms), member)
+			if len(rule.Permissions) > 0 {
+				matched := matchPermissions(perms, rule.Permissions)
+				if len(matched) == 0 {
+					continue
+				}
+				msg = fmt.Sprintf("role '%s' grants forbidden permissions to %s: %s", roleName, member, strings.Join(matched, ", "))
+			}
+			findings = append(findings, Finding{Role: binding.Role, Member: member, Message: msg})
+		}
+		return findings, nil
+	}
+
+	return nil, nil
+}
+
+// knownRole reports whether the permissions of role are known: it is a predefined role
+// in the local database. Custom roles are not stored locally.
+func (l *Linter) knownRole(role string) (bool, error) {
+	roleName, predefined := policy.RoleName(role)
+	if !predefined {
+		return false, nil
+	}
+	r, err := l.db.GetRoleByName(roleName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get role '%s': %w", roleName, err)
+	}
+	return r != nil, nil
+}
+
+// checkMemberPermissions caps the number of distinct permissions each member receives across all policies
+func (l *Linter) checkMemberPermissions(rule config.LintRule, policies []policy.Policy) ([]Finding, error) {
+	memberPerms := make(map[string]map[string]bool)
+
+	for _, p := range policies {
+		for _, binding := range p.Bindings {
+			perms, err := l.roles.Permissions(binding.Role)
+			if err != nil {
+				return nil, err
+			}
+			for _, member := range binding.Members {
+				if memberPerms[member] == nil {
+					memberPerms[member] = make(map[string]bool)
+				}
+				for _, perm := range perms {
+					memberPerms[member][perm] = true
+				}
+			}
+		}
+	}
+
+	members := make([]string, 0, len(memberPerms))
+	for member := range memberPerms {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	var findings []Finding
+	for _, member := range members {
+		if count := len(memberPerms[member]); count > rule.Max {
+			findings = append(findings, Finding{
+				Member:  member,
+				Message: fmt.Sprintf("%s is granted %d permissions (max %d)", member, count, rule.Max),
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// matchPermissions returns the permissions matching any of the patterns, or all permissions if there are no patterns.
+// Patterns may use shell-style wildcards, e.g. "storage.objects.*".
+func matchPermissions(perms, patterns []string) []string {
+	if len(patterns) == 0 {
+		return perms
+	}
+
+	var matched []string
+	for _, perm := range perms {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, perm); ok {
+				matched = append(matched, perm)
+				break
+			}
+		}
+	}
+	return matched
+}
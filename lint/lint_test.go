@@ -0,0 +1,285 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+	"github.com/kborovik/gcp-iam/policy"
+)
+
+// testGrants are the roles the tests look up; editor is known but has no permissions
+var testGrants = map[string][]string{
+	"editor":               nil,
+	"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+	"storage.objectAdmin":  {"storage.objects.get", "storage.objects.list", "storage.objects.delete", "storage.objects.create"},
+}
+
+// newTestDB adds an ALPHA role to testGrants for the stage rules
+func newTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database := dbtest.New(t, testGrants)
+	if err := database.InsertRole(&db.Role{Name: "beta.tester", Title: "Beta Tester", Stage: "ALPHA"}); err != nil {
+		t.Fatalf("Failed to insert role: %v", err)
+	}
+	return database
+}
+
+func testPolicy() []policy.Policy {
+	return []policy.Policy{{
+		Resource: "projects/demo",
+		Bindings: []policy.Binding{
+			{Role: "roles/editor", Members: []string{"user:a@example.com"}},
+			{Role: "roles/beta.tester", Members: []string{"user:b@example.com"}},
+			{Role: "roles/storage.objectViewer", Members: []string{"allUsers"}},
+			{Role: "roles/storage.objectAdmin", Members: []string{"allAuthenticatedUsers", "user:b@example.com"}},
+			{Role: "projects/demo/roles/custom", Members: []string{"allUsers"}},
+		},
+	}}
+}
+
+func findingsByRule(findings []Finding) map[string][]Finding {
+	byRule := make(map[string][]Finding)
+	for _, f := range findings {
+		byRule[f.RuleID] = append(byRule[f.RuleID], f)
+	}
+	return byRule
+}
+
+func TestDefaultRules(t *testing.T) {
+	linter, err := New(newTestDB(t), nil)
+	if err != nil {
+		t.Fatalf("Failed to create linter: %v", err)
+	}
+
+	findings, err := linter.Lint("policy.json", testPolicy())
+	if err != nil {
+		t.Fatalf("Failed to lint policy: %v", err)
+	}
+
+	byRule := findingsByRule(findings)
+
+	if len(byRule["no-basic-roles"]) != 1 {
+		t.Errorf("Expected 1 basic role finding, got %d", len(byRule["no-basic-roles"]))
+	}
+
+	if len(byRule["no-unstable-roles"]) != 1 {
+		t.Errorf("Expected 1 unstable role finding, got %d", len(byRule["no-unstable-roles"]))
+	} else if byRule["no-unstable-roles"][0].Severity != SeverityWarning {
+		t.Errorf("Expected warning severity, got %s", byRule["no-unstable-roles"][0].Severity)
+	}
+
+	// Every public binding is reported, including the one of a custom role
+	if len(byRule["no-public-access"]) != 3 {
+		t.Errorf("Expected 3 public access findings, got %d", len(byRule["no-public-access"]))
+	}
+
+	for _, f := range findings {
+		if f.File != "policy.json" || f.Resource != "projects/demo" {
+			t.Errorf("Expected file and resource to be set, got %q %q", f.File, f.Resource)
+		}
+	}
+}
+
+func TestForbidPublicPermissions(t *testing.T) {
+	rules := []config.LintRule{
+		{ID: "no-public-delete", Type: RuleForbidPublicPermissions, Permissions: []string{"storage.objects.delete"}},
+	}
+
+	linter, err := New(newTestDB(t), rules)
+	if err != nil {
+		t.Fatalf("Failed to create linter: %v", err)
+	}
+
+	findings, err := linter.Lint("policy.json", testPolicy())
+	if err != nil {
+		t.Fatalf("Failed to lint policy: %v", err)
+	}
+
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d", len(findings))
+	}
+
+	if findings[0].Member != "allAuthenticatedUsers" {
+		t.Errorf("Expected finding for allAuthenticatedUsers, got %s", findings[0].Member)
+	}
+
+	if !strings.Contains(findings[0].Message, "storage.objects.delete") {
+		t.Errorf("Expected message to name the permission, got %s", findings[0].Message)
+	}
+
+	// The permissions of the public custom role are unknown, so it may grant the forbidden ones
+	if findings[1].Role != "projects/demo/roles/custom" || !strings.Contains(findings[1].Message, "unknown permissions") {
+		t.Errorf("Expected finding for the public custom role, got %+v", findings[1])
+	}
+}
+
+func TestForbidPublicPermissionsUnknownRoles(t *testing.T) {
+	rules := []config.LintRule{
+		{ID: "no-public-delete", Type: RuleForbidPublicPermissions, Permissions: []string{"storage.objects.delete"}},
+	}
+	linter, err := New(newTestDB(t), rules)
+	if err != nil {
+		t.Fatalf("Failed to create linter: %v", err)
+	}
+
+	policies := []policy.Policy{{
+		Bindings: []policy.Binding{
+			{Role: "organizations/123/roles/publisher", Members: []string{"allAuthenticatedUsers"}},
+			{Role: "roles/storage.unknownRole", Members: []string{"allUsers"}},
+			{Role: "projects/demo/roles/internal", Members: []string{"user:a@example.com"}},
+		},
+	}}
+	findings, err := linter.Lint("policy.json", policies)
+	if err != nil {
+		t.Fatalf("Failed to lint policy: %v", err)
+	}
+
+	if len(findings) != 2 {
+		t.Fatalf("Expected findings for the two public bindings, got %+v", findings)
+	}
+	for _, f := range findings {
+		if !strings.Contains(f.Message, "unknown permissions") {
+			t.Errorf("Expected unknown permissions to be reported, got %s", f.Message)
+		}
+	}
+}
+
+func TestMaxMemberPermissions(t *testing.T) {
+	rules := []config.LintRule{
+		{Type: RuleMaxMemberPermissions, Max: 3, Severity: SeverityWarning},
+	}
+
+	linter, err := New(newTestDB(t), rules)
+	if err != nil {
+		t.Fatalf("Failed to create linter: %v", err)
+	}
+
+	findings, err := linter.Lint("policy.json", testPolicy())
+	if err != nil {
+		t.Fatalf("Failed to lint policy: %v", err)
+	}
+
+	// allAuthenticatedUsers and user:b@example.com receive 4 permissions from storage.objectAdmin
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d", len(findings))
+	}
+
+	if findings[0].RuleID != RuleMaxMemberPermissions {
+		t.Errorf("Expected rule ID to default to type, got %s", findings[0].RuleID)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	tests := []config.LintRule{
+		{Type: "no-such-rule"},
+		{Type: RuleForbidBasicRoles, Severity: "fatal"},
+		{Type: RuleForbidRoles},
+		{Type: RuleMaxMemberPermissions},
+	}
+
+	for _, rule := range tests {
+		if _, err := New(nil, []config.LintRule{rule}); err == nil {
+			t.Errorf("Expected error for rule %+v", rule)
+		}
+	}
+}
+
+func TestNewKeepsRules(t *testing.T) {
+	roles := []string{"roles/editor", "roles/owner"}
+	linter, err := New(nil, []config.LintRule{{Type: RuleForbidRoles, Roles: roles}})
+	if err != nil {
+		t.Fatalf("Failed to create linter: %v", err)
+	}
+
+	if got := linter.Rules()[0].Roles; !slices.Equal(got, []string{"editor", "owner"}) {
+		t.Errorf("Expected normalized role names, got %v", got)
+	}
+	if !slices.Equal(roles, []string{"roles/editor", "roles/owner"}) {
+		t.Errorf("Expected the configured roles to be left unchanged, got %v", roles)
+	}
+}
+
+// TestConfigSchemaEnums keeps the allowed values validated in config.yaml in sync with the linter
+func TestConfigSchemaEnums(t *testing.T) {
+	ruleType, _ := reflect.TypeOf(config.LintRule{}).FieldByName("Type")
+	if got := strings.Split(ruleType.Tag.Get("enum"), ","); !slices.Equal(got, ValidRuleTypes()) {
+		t.Errorf("config.LintRule.Type enum %v does not match ValidRuleTypes %v", got, ValidRuleTypes())
+	}
+
+	severity, _ := reflect.TypeOf(config.LintRule{}).FieldByName("Severity")
+	want := []string{SeverityError, SeverityWarning, SeverityNote}
+	if got := strings.Split(severity.Tag.Get("enum"), ","); !slices.Equal(got, want) {
+		t.Errorf("config.LintRule.Severity enum %v does not match %v", got, want)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	linter, err := New(newTestDB(t), nil)
+	if err != nil {
+		t.Fatalf("Failed to create linter: %v", err)
+	}
+
+	findings, err := linter.Lint("policy.json", testPolicy())
+	if err != nil {
+		t.Fatalf("Failed to lint policy: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, linter.Rules(), findings, "v0.0.0"); err != nil {
+		t.Fatalf("Failed to write SARIF: %v", err)
+	}
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID string `json:"ruleId"`
+				Level  string `json:"level"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("Failed to decode SARIF: %v", err)
+	}
+
+	if log.Version != "2.1.0" {
+		t.Errorf("Expected SARIF version 2.1.0, got %s", log.Version)
+	}
+
+	if len(log.Runs[0].Tool.Driver.Rules) != len(DefaultRules()) {
+		t.Errorf("Expected %d rules, got %d", len(DefaultRules()), len(log.Runs[0].Tool.Driver.Rules))
+	}
+
+	if len(log.Runs[0].Results) != len(findings) {
+		t.Errorf("Expected %d results, got %d", len(findings), len(log.Runs[0].Results))
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	WriteText(&buf, nil)
+	if !strings.Contains(buf.String(), "No issues found") {
+		t.Errorf("Expected no issues message, got %s", buf.String())
+	}
+
+	buf.Reset()
+	WriteText(&buf, []Finding{{RuleID: "r", Severity: SeverityError, Message: "bad", File: "p.json"}})
+	if !strings.Contains(buf.String(), "p.json: error [r] bad") {
+		t.Errorf("Expected finding line, got %s", buf.String())
+	}
+}
@@ -0,0 +1,144 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/kborovik/gcp-iam/config"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "gcp-iam"
+	toolURI      = "https://github.com/kborovik/gcp-iam"
+)
+
+// WriteText prints findings in a human readable format
+func WriteText(w io.Writer, findings []Finding) {
+	errors, warnings := 0, 0
+	for _, f := range findings {
+		location := f.File
+		if f.Resource != "" {
+			location = fmt.Sprintf("%s (%s)", f.File, f.Resource)
+		}
+		fmt.Fprintf(w, "%s: %s [%s] %s\n", location, f.Severity, f.RuleID, f.Message)
+
+		switch f.Severity {
+		case SeverityError:
+			errors++
+		case SeverityWarning:
+			warnings++
+		}
+	}
+
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "No issues found")
+		return
+	}
+
+	fmt.Fprintf(w, "\nFound %d issues (%d errors, %d warnings)\n", len(findings), errors, warnings)
+}
+
+// WriteSARIF prints findings as a SARIF 2.1.0 log for code scanning tools
+func WriteSARIF(w io.Writer, rules []config.LintRule, findings []Finding, version string) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		Name             string  `json:"name"`
+		ShortDescription message `json:"shortDescription"`
+		DefaultConfig    struct {
+			Level string `json:"level"`
+		} `json:"defaultConfiguration"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+		} `json:"physicalLocation"`
+		LogicalLocations []struct {
+			FullyQualifiedName string `json:"fullyQualifiedName"`
+		} `json:"logicalLocations,omitempty"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	sarifRules := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		sr := rule{ID: r.ID, Name: r.Type, ShortDescription: message{Text: ruleDescription(r)}}
+		sr.DefaultConfig.Level = r.Severity
+		sarifRules = append(sarifRules, sr)
+	}
+
+	results := make([]result, 0, len(findings))
+	for _, f := range findings {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = f.File
+		if f.Resource != "" {
+			loc.LogicalLocations = append(loc.LogicalLocations, struct {
+				FullyQualifiedName string `json:"fullyQualifiedName"`
+			}{FullyQualifiedName: f.Resource})
+		}
+		results = append(results, result{
+			RuleID:    f.RuleID,
+			Level:     f.Severity,
+			Message:   message{Text: f.Message},
+			Locations: []location{loc},
+		})
+	}
+
+	log := map[string]any{
+		"version": sarifVersion,
+		"$schema": sarifSchema,
+		"runs": []any{
+			map[string]any{
+				"tool": map[string]any{
+					"driver": map[string]any{
+						"name":           toolName,
+						"version":        version,
+						"informationUri": toolURI,
+						"rules":          sarifRules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+// ruleDescription returns the configured description or a generated one
+func ruleDescription(r config.LintRule) string {
+	if r.Description != "" {
+		return r.Description
+	}
+
+	switch r.Type {
+	case RuleForbidBasicRoles:
+		return "Basic roles (owner, editor, viewer) must not be granted"
+	case RuleForbidRoles:
+		return fmt.Sprintf("Roles %v must not be granted", r.Roles)
+	case RuleForbidStages:
+		return fmt.Sprintf("Roles in stages %v must not be granted", r.Stages)
+	case RuleForbidPublicPermissions:
+		if len(r.Permissions) == 0 {
+			return fmt.Sprintf("No permissions may be granted to %v", r.Members)
+		}
+		return fmt.Sprintf("Permissions %v must not be granted to %v", r.Permissions, r.Members)
+	case RuleMaxMemberPermissions:
+		return fmt.Sprintf("Members must not be granted more than %d permissions", r.Max)
+	}
+
+	return r.Type
+}
@@ -1,18 +1,37 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/kborovik/gcp-iam/cmd"
+	"github.com/kborovik/gcp-iam/compare"
+	"github.com/kborovik/gcp-iam/completion"
 	"github.com/kborovik/gcp-iam/config"
 	"github.com/kborovik/gcp-iam/db"
 	"github.com/kborovik/gcp-iam/internal/constants"
+	"github.com/kborovik/gcp-iam/lint"
+	"github.com/kborovik/gcp-iam/mcp"
+	"github.com/kborovik/gcp-iam/policy"
+	"github.com/kborovik/gcp-iam/server"
+	"github.com/kborovik/gcp-iam/shell"
+	"github.com/kborovik/gcp-iam/solver"
+	"github.com/kborovik/gcp-iam/tui"
 	"github.com/kborovik/gcp-iam/update"
 	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 const Version = "v1.2.0"
@@ -25,594 +44,1854 @@ func normalizeRoleName(roleName string) string {
 	return roleName
 }
 
-// completeNames provides generic completion for names using a database fetch function
-func completeNames(cmd *cli.Command, fetchNames func(*db.DB) ([]string, error)) {
-	// Check if this is being called for completion
-	if os.Getenv("COMP_LINE") == "" {
-		return
+// colorFlag returns the flag choosing when output is colored
+func colorFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "color",
+		Usage: "Color output: auto, always or never (auto colors terminals unless NO_COLOR is set)",
+		Value: "auto",
 	}
+}
 
-	cfg, err := config.Load()
-	if err != nil {
-		return
+// useColor resolves a colorFlag value for standard output
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd())), nil
+	default:
+		return false, fmt.Errorf("invalid color mode '%s': expected auto, always or never", mode)
 	}
+}
+
+// argSource names the kind of name completed for a positional argument
+type argSource struct {
+	// section is the completion cache section holding the names, one of db.Resources
+	section string
+	// prefix is an optional prefix accepted in front of names, like "roles/"
+	prefix string
+}
 
-	database, err := db.New(cfg.DatabasePath)
+var (
+	roleArg       = argSource{section: db.ResourceRoles, prefix: constants.RolePrefix}
+	permissionArg = argSource{section: db.ResourcePermissions}
+	serviceArg    = argSource{section: db.ResourceServices}
+)
+
+// completeArgs completes each positional argument from the source at its position;
+// arguments past the last source are not completed
+func completeArgs(sources ...argSource) cli.ShellCompleteFunc {
+	return func(ctx context.Context, c *cli.Command) {
+		if pos := c.Args().Len(); pos < len(sources) {
+			completeArg(ctx, c, sources[pos])
+		}
+	}
+}
+
+// completeEach completes every positional argument from source, for commands taking a list
+func completeEach(source argSource) cli.ShellCompleteFunc {
+	return func(ctx context.Context, c *cli.Command) {
+		completeArg(ctx, c, source)
+	}
+}
+
+// completeArg prints the candidates of source matching the word being completed, leaving
+// out names already given as arguments. The prefix of source is kept when it was typed.
+func completeArg(ctx context.Context, c *cli.Command, source argSource) {
+	word := completion.Word()
+	prefix := ""
+	if source.prefix != "" && strings.HasPrefix(word, source.prefix) {
+		prefix = source.prefix
+	}
+
+	candidates, err := cachedCandidates(ctx, c, source.section, strings.TrimPrefix(word, prefix))
 	if err != nil {
 		return
 	}
-	defer database.Close()
 
-	names, err := fetchNames(database)
+	typed := map[string]bool{}
+	for _, arg := range c.Args().Slice() {
+		typed[strings.TrimPrefix(arg, source.prefix)] = true
+	}
+
+	matches := candidates[:0]
+	for _, candidate := range candidates {
+		if !typed[candidate.Name] {
+			candidate.Name = prefix + candidate.Name
+			matches = append(matches, candidate)
+		}
+	}
+	completion.Write(c.Root().Writer, matches)
+}
+
+// cachedCandidates returns the names of section starting with word from the completion
+// cache, which spares completions from opening the database until it changes
+func cachedCandidates(ctx context.Context, c *cli.Command, section, word string) ([]completion.Candidate, error) {
+	cfg, err := config.LoadWith(cmd.LoadOptions(c))
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	return completion.Candidates(ctx, cfg.DatabasePath, func() (*db.DB, error) {
+		return cmd.OpenDB(cfg)
+	}, section, word)
+}
+
+// printNames returns an action listing every name of section, for completion scripts
+// of older releases
+func printNames(section string) cli.ActionFunc {
+	return func(ctx context.Context, c *cli.Command) error {
+		candidates, err := cachedCandidates(ctx, c, section, "")
+		if err != nil {
+			return fmt.Errorf("failed to get %s names: %w", section, err)
+		}
+
+		for _, candidate := range candidates {
+			fmt.Println(candidate.Name)
+		}
+		return nil
 	}
+}
 
-	// Filter based on current input if available
-	currentArg := ""
-	if args := cmd.Args(); args.Len() > 0 {
-		currentArg = args.First()
+// setShellComplete makes every command complete a partially typed flag before falling
+// back to its own completion, subcommands and flags otherwise
+func setShellComplete(c *cli.Command) {
+	complete := c.ShellComplete
+	if complete == nil {
+		complete = cli.DefaultCompleteWithFlags
+	}
+	c.ShellComplete = func(ctx context.Context, c *cli.Command) {
+		if !completeFlags(c) {
+			complete(ctx, c)
+		}
 	}
 
-	for _, name := range names {
-		if currentArg == "" || strings.HasPrefix(name, currentArg) {
-			fmt.Println(name)
+	for _, sub := range c.Commands {
+		setShellComplete(sub)
+	}
+}
+
+// completeFlags prints the flags of c matching a partially typed flag and reports whether
+// one was typed. urfave/cli drops an unknown partial flag from the arguments of
+// subcommands, so it is read from os.Args, which ends with the completion flag.
+func completeFlags(c *cli.Command) bool {
+	n := len(os.Args)
+	if n < 2 || !strings.HasPrefix(os.Args[n-2], "-") {
+		return false
+	}
+
+	partial := strings.TrimLeft(os.Args[n-2], "-")
+	var candidates []completion.Candidate
+	for _, flag := range c.VisibleFlags() {
+		name := flag.Names()[0]
+		if !strings.HasPrefix(name, partial) {
+			continue
 		}
+
+		candidate := completion.Candidate{Name: "--" + name}
+		if len(name) == 1 {
+			candidate.Name = "-" + name
+		}
+		if doc, ok := flag.(cli.DocGenerationFlag); ok {
+			candidate.Description = doc.GetUsage()
+		}
+		candidates = append(candidates, candidate)
 	}
+	completion.Write(c.Root().Writer, candidates)
+	return true
 }
 
-// completeRoleNames provides completion for role names
-func completeRoleNames(cmd *cli.Command) {
-	completeNames(cmd, (*db.DB).GetRoleNames)
+// requestFlags returns the flags describing the request context IAM conditions are evaluated against
+func requestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "resource-name",
+			Usage: "Resource name for condition evaluation (e.g. projects/_/buckets/data)",
+		},
+		&cli.StringFlag{
+			Name:  "resource-type",
+			Usage: "Resource type for condition evaluation (e.g. storage.googleapis.com/Bucket)",
+		},
+		&cli.StringFlag{
+			Name:  "resource-service",
+			Usage: "Resource service for condition evaluation (e.g. storage.googleapis.com)",
+		},
+		&cli.StringFlag{
+			Name:  "time",
+			Usage: "Request time for condition evaluation in RFC 3339 format (default: now)",
+		},
+	}
 }
 
-// completePermissionNames provides completion for permission names
-func completePermissionNames(cmd *cli.Command) {
-	completeNames(cmd, (*db.DB).GetPermissionNames)
+// requestFromFlags builds a condition request context from the requestFlags values
+func requestFromFlags(c *cli.Command) (policy.Request, error) {
+	req := policy.Request{
+		ResourceName:    c.String("resource-name"),
+		ResourceType:    c.String("resource-type"),
+		ResourceService: c.String("resource-service"),
+		Time:            time.Now().UTC(),
+	}
+
+	if value := c.String("time"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return req, fmt.Errorf("invalid time '%s': expected RFC 3339 format (e.g. 2025-01-31T12:00:00Z)", value)
+		}
+		req.Time = t
+	}
+
+	return req, nil
 }
 
-// completeServiceNames provides completion for service names
-func completeServiceNames(cmd *cli.Command) {
-	completeNames(cmd, (*db.DB).GetServiceNames)
+// printMemberAccess prints the roles, deny rules and permissions of a member.
+// When resource is set, grants show whether they are direct or inherited.
+func printMemberAccess(access policy.MemberAccess, resource string, listPermissions bool) {
+	conditionStatus := func(status policy.ConditionStatus, condition *policy.Expr) string {
+		if condition != nil && condition.Title != "" {
+			return fmt.Sprintf("%s (%s)", status, condition.Title)
+		}
+		return string(status)
+	}
+
+	fmt.Printf("  Roles (%d):\n", len(access.Grants))
+	for _, grant := range access.Grants {
+		status := conditionStatus(grant.Status, grant.Condition)
+		if resource != "" {
+			source := grant.Resource
+			if grant.Resource == resource {
+				source = "direct"
+			}
+			if grant.Member != access.Member {
+				source = fmt.Sprintf("%s via %s", source, grant.Member)
+			}
+			status = fmt.Sprintf("%s, %s", source, status)
+		}
+		fmt.Printf("    - %-40s %s\n", normalizeRoleName(grant.Role), status)
+		if grant.Err != nil {
+			fmt.Printf("      %v\n", grant.Err)
+		}
+	}
+
+	if len(access.Denials) > 0 {
+		fmt.Printf("  Deny rules (%d):\n", len(access.Denials))
+		for _, denial := range access.Denials {
+			name := denial.Policy
+			if name == "" {
+				name = denial.Resource
+			}
+			fmt.Printf("    - %-40s %s\n", name, conditionStatus(denial.Status, denial.Rule.DenialCondition))
+			if denial.Err != nil {
+				fmt.Printf("      %v\n", denial.Err)
+			}
+		}
+	}
+
+	printPermissions := func(label, marker string, perms []string) {
+		fmt.Printf("  %s: %d\n", label, len(perms))
+		if listPermissions {
+			for _, perm := range perms {
+				fmt.Printf("    %s %s\n", marker, perm)
+			}
+		}
+	}
+
+	printPermissions("Effective permissions", "-", access.Permissions)
+	if len(access.Conditional) > 0 {
+		printPermissions("Conditional permissions", "?", access.Conditional)
+	}
+	if len(access.Denied) > 0 {
+		printPermissions("Denied permissions", "x", access.Denied)
+	}
 }
 
-var app = &cli.Command{
-	Name:                  "gcp-iam",
-	Usage:                 "Query Google Cloud IAM Roles and Permissions",
-	Version:               Version,
-	Suggest:               true,
-	EnableShellCompletion: true,
-	HideHelpCommand:       true,
-	Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-		return cli.ShowAppHelp(c)
-	}),
-	Commands: []*cli.Command{
-		{
-			Name:  "role",
-			Usage: "Query IAM Roles",
-			CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
-				cli.ShowAppHelp(cmd)
+// newApp builds the command tree. The shell builds a fresh tree for every line because
+// urfave/cli keeps parsed flag values on the commands.
+func newApp() *cli.Command {
+	app := &cli.Command{
+		Name:                  "gcp-iam",
+		Usage:                 "Query Google Cloud IAM Roles and Permissions",
+		Version:               Version,
+		Suggest:               true,
+		EnableShellCompletion: true,
+		ConfigureShellCompletionCommand: func(c *cli.Command) {
+			c.Hidden = false
+			c.Usage = "Generate a shell completion script for bash, zsh, fish or powershell"
+			c.ArgsUsage = "<" + strings.Join(completion.Shells, "|") + ">"
+			c.Description = "Print a completion script covering all commands, flags and the role,\n" +
+				"permission and service names in the local database.\n\n" +
+				"Setup:\n" +
+				"  bash:       source <(gcp-iam completion bash)                # in ~/.bashrc\n" +
+				"  zsh:        source <(gcp-iam completion zsh)                 # in ~/.zshrc, after compinit\n" +
+				"  fish:       gcp-iam completion fish > ~/.config/fish/completions/gcp-iam.fish\n" +
+				"  powershell: gcp-iam completion powershell | Out-String | Invoke-Expression   # in $PROFILE"
+			c.Metadata = map[string]any{cmd.SkipStaleCheck: true}
+			c.ShellComplete = func(ctx context.Context, c *cli.Command) {
+				for _, shell := range completion.Shells {
+					fmt.Fprintln(c.Root().Writer, shell)
+				}
+			}
+			c.Action = func(ctx context.Context, c *cli.Command) error {
+				if c.Args().Len() != 1 {
+					return cli.ShowSubcommandHelp(c)
+				}
+
+				script, err := completion.Script(c.Args().First(), c.Root().Name)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(c.Root().Writer, script)
+				return nil
+			}
+		},
+		HideHelpCommand: true,
+		Metadata:        map[string]any{cmd.SkipStaleCheck: true},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "Config file (overrides " + config.EnvConfig + ")",
 			},
-			Commands: []*cli.Command{
-				{
-					Name:      "show",
-					Usage:     "Show IAM role permissions",
-					ArgsUsage: "<role-name>",
-					Description: "Display detailed information about a specific IAM role including its permissions.\n\n" +
-						"Examples:\n" +
-						"  gcp-iam role show viewer\n" +
-						"  gcp-iam role show compute.instanceAdmin.v1",
-					ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-						completeRoleNames(cmd)
+			&cli.StringFlag{
+				Name:  "db",
+				Usage: "Database file (overrides " + config.EnvDatabase + " and config.yaml)",
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "Profile from config.yaml (overrides " + config.EnvProfile + ")",
+			},
+		},
+		Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+			return cli.ShowAppHelp(c)
+		}),
+		Commands: []*cli.Command{
+			{
+				Name:  "role",
+				Usage: "Query IAM Roles",
+				CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
+					cli.ShowAppHelp(cmd)
+				},
+				Commands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "Show IAM role permissions",
+						ArgsUsage: "<role-name>",
+						Description: "Display detailed information about a specific IAM role including its permissions.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam role show viewer\n" +
+							"  gcp-iam role show compute.instanceAdmin.v1",
+						ShellComplete: completeArgs(roleArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							roleName := c.Args().First()
+							if roleName == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
+
+							// Normalize role name (strip roles/ prefix if present)
+							roleName = normalizeRoleName(roleName)
+
+							role, err := database.GetRoleByNameContext(ctx, roleName)
+							if err != nil {
+								return fmt.Errorf("failed to get role: %w", err)
+							}
+
+							if role == nil {
+								fmt.Printf("Role '%s' not found\n", roleName)
+								return nil
+							}
+
+							fmt.Printf("Role: %s\n", role.Name)
+							fmt.Printf("Title: %s\n", role.Title)
+							fmt.Printf("Description: %s\n", role.Description)
+							fmt.Printf("Stage: %s\n", role.Stage)
+
+							permissions, err := database.GetRolePermissionNamesContext(ctx, role.Name)
+							if err != nil {
+								return fmt.Errorf("failed to get permissions: %w", err)
+							}
+
+							fmt.Printf("Permissions (%d):\n", len(permissions))
+							for _, perm := range permissions {
+								fmt.Printf("  - %s\n", perm)
+							}
+							cmd.Record(ctx, permissions)
+
+							return nil
+						}),
 					},
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						roleName := c.Args().First()
-						if roleName == "" {
-							return cli.ShowSubcommandHelp(c)
-						}
+					{
+						Name:      "search",
+						Usage:     "Search IAM roles",
+						ArgsUsage: "<search-query>",
+						Description: "Search for IAM roles by name or title using a query string.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam role search storage\n" +
+							"  gcp-iam role search admin\n" +
+							"  gcp-iam role search compute",
+						ShellComplete: completeArgs(roleArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							query := c.Args().First()
+							if query == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-						// Normalize role name (strip roles/ prefix if present)
-						roleName = normalizeRoleName(roleName)
+							roles, err := database.SearchRolesContext(ctx, query)
+							if err != nil {
+								return fmt.Errorf("failed to search roles: %w", err)
+							}
 
-						role, err := database.GetRoleByName(roleName)
-						if err != nil {
-							return fmt.Errorf("failed to get role: %w", err)
-						}
+							fmt.Printf("Found %d roles matching '%s':\n", len(roles), query)
+							names := make([]string, 0, len(roles))
+							for _, role := range roles {
+								fmt.Printf("  - %-40s %s\n", role.Name, role.Title)
+								names = append(names, role.Name)
+							}
+							cmd.Record(ctx, names)
 
-						if role == nil {
-							fmt.Printf("Role '%s' not found\n", roleName)
 							return nil
-						}
+						}),
+					},
+					{
+						Name:      "compare",
+						Usage:     "Compare permissions of 2 or more IAM roles",
+						ArgsUsage: "<role1> <role2> [role...]",
+						Description: "Compare the permissions of two or more IAM roles, showing common permissions, permissions\n" +
+							"unique to each role and the Jaccard similarity of every pair of roles.\n\n" +
+							"Formats:\n" +
+							"  text    Common and unique permissions, similarity matrix and summary (default)\n" +
+							"  matrix  Table of every permission against every role\n" +
+							"  csv     The permission × role matrix as CSV, 1 where a role grants a permission\n" +
+							"  json    Everything above as JSON\n\n" +
+							"--diff prints a unified diff from the first role to the others. --only-added, --only-removed\n" +
+							"and --common keep only the permissions the other roles add to the first role, the permissions\n" +
+							"of the first role some other role lacks, or the permissions of every role; in the text format\n" +
+							"they print a plain list. --group-by groups permissions by service or resource.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam role compare viewer editor\n" +
+							"  gcp-iam role compare storage.admin storage.objectAdmin\n" +
+							"  gcp-iam role compare roles/compute.admin compute.instanceAdmin\n" +
+							"  gcp-iam role compare storage.objectViewer storage.objectCreator storage.objectUser storage.objectAdmin storage.admin\n" +
+							"  gcp-iam role compare --format csv storage.objectViewer storage.objectUser storage.admin > storage.csv\n" +
+							"  gcp-iam role compare --diff --group-by resource viewer editor\n" +
+							"  gcp-iam role compare --only-added viewer editor | grep compute",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "format",
+								Usage: "Output format: " + strings.Join(compare.Formats, ", "),
+								Value: "text",
+							},
+							&cli.BoolFlag{
+								Name:  "only-added",
+								Usage: "Only show permissions the first role lacks and another role grants",
+							},
+							&cli.BoolFlag{
+								Name:  "only-removed",
+								Usage: "Only show permissions of the first role that another role lacks",
+							},
+							&cli.BoolFlag{
+								Name:  "common",
+								Usage: "Only show permissions granted by every role",
+							},
+							&cli.BoolFlag{
+								Name:  "diff",
+								Usage: "Show a unified diff from the first role to the others",
+							},
+							&cli.StringFlag{
+								Name:  "group-by",
+								Usage: "Group permissions by " + strings.Join(compare.GroupBy, " or "),
+							},
+							colorFlag(),
+						},
+						ShellComplete: completeEach(roleArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							args := c.Args().Slice()
+							if len(args) < 2 {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-						fmt.Printf("Role: %s\n", role.Name)
-						fmt.Printf("Title: %s\n", role.Title)
-						fmt.Printf("Description: %s\n", role.Description)
-						fmt.Printf("Stage: %s\n", role.Stage)
+							color, err := useColor(c.String("color"))
+							if err != nil {
+								return err
+							}
 
-						permissions, err := database.GetRolePermissions(role.Name)
-						if err != nil {
-							return fmt.Errorf("failed to get permissions: %w", err)
-						}
+							format := c.String("format")
+							opts := compare.Options{
+								GroupBy: c.String("group-by"),
+								Diff:    c.Bool("diff"),
+								Color:   color,
+							}
+							if c.Bool("only-added") {
+								opts.Changes = append(opts.Changes, compare.ChangeAdded)
+							}
+							if c.Bool("only-removed") {
+								opts.Changes = append(opts.Changes, compare.ChangeRemoved)
+							}
+							if c.Bool("common") {
+								opts.Changes = append(opts.Changes, compare.ChangeCommon)
+							}
+							if err := opts.Check(format); err != nil {
+								return err
+							}
 
-						fmt.Printf("Permissions (%d):\n", len(permissions))
-						for _, perm := range permissions {
-							fmt.Printf("  - %s\n", perm.Permission)
-						}
+							roles := make([]compare.RolePermissions, 0, len(args))
+							titles := make(map[string]string, len(args))
+							for _, arg := range args {
+								roleName := normalizeRoleName(arg)
+								role, err := database.GetRoleByNameContext(ctx, roleName)
+								if err != nil {
+									return fmt.Errorf("failed to get role '%s': %w", roleName, err)
+								}
+								if role == nil {
+									return fmt.Errorf("role '%s' not found", roleName)
+								}
+
+								permissions, err := database.GetRolePermissionNamesContext(ctx, role.Name)
+								if err != nil {
+									return fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+								}
+								roles = append(roles, compare.RolePermissions{Role: role.Name, Permissions: permissions})
+								titles[role.Name] = role.Title
+							}
 
-						return nil
-					}),
-				},
-				{
-					Name:      "search",
-					Usage:     "Search IAM roles",
-					ArgsUsage: "<search-query>",
-					Description: "Search for IAM roles by name or title using a query string.\n\n" +
-						"Examples:\n" +
-						"  gcp-iam role search storage\n" +
-						"  gcp-iam role search admin\n" +
-						"  gcp-iam role search compute",
-					ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-						completeRoleNames(cmd)
+							opts.Titles = titles
+							return compare.Write(os.Stdout, format, compare.NewReport(roles), opts)
+						}),
 					},
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						query := c.Args().First()
-						if query == "" {
-							return cli.ShowSubcommandHelp(c)
-						}
+					{
+						Name:      "expr",
+						Usage:     "Evaluate a set expression over role permissions",
+						ArgsUsage: "<expression>",
+						Description: "List the permissions selected by a set-algebra expression over roles.\n\n" +
+							"Operators:\n" +
+							"  a & b   permissions granted by both roles\n" +
+							"  a | b   permissions granted by either role (also a + b)\n" +
+							"  a - b   permissions granted by a but not by b\n\n" +
+							"& binds tighter than | and -, which apply from left to right. Use parentheses to group,\n" +
+							"and quote the expression so the shell does not interpret the operators.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam role expr \"editor - viewer\"\n" +
+							"  gcp-iam role expr \"editor - viewer & compute.admin\"      # editor - (viewer & compute.admin)\n" +
+							"  gcp-iam role expr \"(editor - viewer) & compute.admin\"\n" +
+							"  gcp-iam role expr --group-by resource \"storage.admin - storage.objectAdmin\"",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "group-by",
+								Usage: "Group permissions by " + strings.Join(compare.GroupBy, " or "),
+							},
+						},
+						ShellComplete: completeEach(roleArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							if c.Args().Len() == 0 {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-						roles, err := database.SearchRoles(query)
-						if err != nil {
-							return fmt.Errorf("failed to search roles: %w", err)
-						}
+							groupBy := c.String("group-by")
+							if err := (compare.Options{GroupBy: groupBy}).Check("text"); err != nil {
+								return err
+							}
 
-						fmt.Printf("Found %d roles matching '%s':\n", len(roles), query)
-						for _, role := range roles {
-							fmt.Printf("  - %-40s %s\n", role.Name, role.Title)
-						}
+							// Unquoted expressions arrive as several arguments, and arguments after a
+							// lone "-" are dropped while parsing flags
+							expr, err := compare.ParseExpr(strings.Join(c.Args().Slice(), " "))
+							if err != nil && c.Args().Len() > 1 {
+								return fmt.Errorf("invalid expression: %w (quote the whole expression)", err)
+							}
+							if err != nil {
+								return fmt.Errorf("invalid expression: %w", err)
+							}
 
-						return nil
-					}),
-				},
-				{
-					Name:      "compare",
-					Usage:     "Compare permissions of 2 IAM roles",
-					ArgsUsage: "<role1> <role2>",
-					Description: "Compare the permissions between two IAM roles, showing common permissions and differences.\n\n" +
-						"Examples:\n" +
-						"  gcp-iam role compare viewer editor\n" +
-						"  gcp-iam role compare storage.admin storage.objectAdmin\n" +
-						"  gcp-iam role compare roles/compute.admin compute.instanceAdmin",
-					ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-						completeRoleNames(cmd)
+							permissions := make(map[string][]string, len(expr.Roles()))
+							for _, name := range expr.Roles() {
+								roleName := normalizeRoleName(name)
+								role, err := database.GetRoleByNameContext(ctx, roleName)
+								if err != nil {
+									return fmt.Errorf("failed to get role '%s': %w", roleName, err)
+								}
+								if role == nil {
+									return fmt.Errorf("role '%s' not found", roleName)
+								}
+
+								perms, err := database.GetRolePermissionNamesContext(ctx, role.Name)
+								if err != nil {
+									return fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+								}
+								permissions[name] = perms
+							}
+
+							compare.WriteList(os.Stdout, expr.Eval(permissions), groupBy)
+							return nil
+						}),
 					},
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						args := c.Args().Slice()
-						if len(args) < 2 {
-							return cli.ShowSubcommandHelp(c)
-						}
+					{
+						Name:      "similar",
+						Usage:     "Rank roles by the similarity of their permissions to a role",
+						ArgsUsage: "<role-name>",
+						Description: "Rank the roles sharing permissions with a role, most similar first, with the number of\n" +
+							"permissions of the role each one lacks (missing) and grants beyond it (extra).\n\n" +
+							"Metrics:\n" +
+							"  jaccard   shared permissions divided by the permissions of either role (default)\n" +
+							"  weighted  the same with rare permissions counting more than ones most roles grant\n\n" +
+							"--narrower keeps roles granting only permissions of the role, to find least-privilege\n" +
+							"alternatives to a broad role.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam role similar storage.admin\n" +
+							"  gcp-iam role similar --narrower editor\n" +
+							"  gcp-iam role similar --metric weighted --limit 5 compute.admin",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "metric",
+								Usage: "Similarity metric: " + strings.Join(db.SimilarityMetrics, " or "),
+								Value: db.SimilarityJaccard,
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Usage: "Maximum number of roles to show, 0 for all",
+								Value: 20,
+							},
+							&cli.BoolFlag{
+								Name:  "narrower",
+								Usage: "Only show roles whose permissions are a subset of the role's",
+							},
+						},
+						ShellComplete: completeArgs(roleArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							if c.Args().Len() == 0 {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-						role1Name := normalizeRoleName(args[0])
-						role2Name := normalizeRoleName(args[1])
+							metric := c.String("metric")
+							if !slices.Contains(db.SimilarityMetrics, metric) {
+								return fmt.Errorf("invalid metric '%s': expected one of %s", metric, strings.Join(db.SimilarityMetrics, ", "))
+							}
 
-						// Get both roles
-						role1, err := database.GetRoleByName(role1Name)
-						if err != nil {
-							return fmt.Errorf("failed to get role '%s': %w", role1Name, err)
-						}
-						if role1 == nil {
-							return fmt.Errorf("role '%s' not found", role1Name)
-						}
+							roleName := normalizeRoleName(c.Args().First())
+							role, err := database.GetRoleByNameContext(ctx, roleName)
+							if err != nil {
+								return fmt.Errorf("failed to get role '%s': %w", roleName, err)
+							}
+							if role == nil {
+								return fmt.Errorf("role '%s' not found", roleName)
+							}
 
-						role2, err := database.GetRoleByName(role2Name)
-						if err != nil {
-							return fmt.Errorf("failed to get role '%s': %w", role2Name, err)
-						}
-						if role2 == nil {
-							return fmt.Errorf("role '%s' not found", role2Name)
-						}
+							permissions, err := database.GetRolePermissionNamesContext(ctx, role.Name)
+							if err != nil {
+								return fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+							}
 
-						// Get permissions for both roles
-						perms1, err := database.GetRolePermissions(role1.Name)
-						if err != nil {
-							return fmt.Errorf("failed to get permissions for role '%s': %w", role1.Name, err)
-						}
+							similar, err := database.SimilarRolesContext(ctx, role.Name, metric)
+							if err != nil {
+								return fmt.Errorf("failed to find roles similar to '%s': %w", role.Name, err)
+							}
 
-						perms2, err := database.GetRolePermissions(role2.Name)
-						if err != nil {
-							return fmt.Errorf("failed to get permissions for role '%s': %w", role2.Name, err)
-						}
+							if c.Bool("narrower") {
+								similar = slices.DeleteFunc(similar, func(s db.SimilarRole) bool { return s.Extra > 0 })
+							}
+							if limit := int(c.Int("limit")); limit > 0 && len(similar) > limit {
+								similar = similar[:limit]
+							}
 
-						// Create maps for easier comparison
-						perms1Map := make(map[string]bool)
-						for _, perm := range perms1 {
-							perms1Map[perm.Permission] = true
-						}
+							fmt.Printf("Roles similar to '%s' (%s, %d permissions) by %s similarity:\n\n", role.Name, role.Title, len(permissions), metric)
+							if len(similar) == 0 {
+								fmt.Println("No roles found")
+								return nil
+							}
 
-						perms2Map := make(map[string]bool)
-						for _, perm := range perms2 {
-							perms2Map[perm.Permission] = true
-						}
+							tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+							fmt.Fprintln(tw, "SIMILARITY\tSHARED\tMISSING\tEXTRA\tROLE")
+							for _, s := range similar {
+								fmt.Fprintf(tw, "%.2f\t%d\t%d\t%d\t%s (%s)\n", s.Similarity, s.Shared, s.Missing, s.Extra, s.Role.Name, s.Role.Title)
+							}
+							return tw.Flush()
+						}),
+					},
+					{
+						Name:      "solve",
+						Usage:     "Find the smallest set of roles granting permissions",
+						ArgsUsage: "<permission>...",
+						Description: "Find a minimal set of predefined IAM roles that together grant all the given permissions.\n" +
+							"When several roles cover the same permissions, the role with fewer total permissions is preferred.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam role solve storage.objects.get storage.objects.list\n" +
+							"  gcp-iam role solve compute.instances.get storage.buckets.get",
+						ShellComplete: completeEach(permissionArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							permissions := c.Args().Slice()
+							if len(permissions) == 0 {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-						// Find permissions unique to each role and common permissions
-						var onlyInRole1, onlyInRole2, common []string
+							result, err := solver.MinimalRoles(ctx, database, permissions)
+							if err != nil {
+								return err
+							}
 
-						for perm := range perms1Map {
-							if perms2Map[perm] {
-								common = append(common, perm)
-							} else {
-								onlyInRole1 = append(onlyInRole1, perm)
+							fmt.Printf("Roles granting %d permissions (%d):\n", len(permissions), len(result.Roles))
+							names := make([]string, 0, len(result.Roles))
+							for _, rc := range result.Roles {
+								fmt.Printf("  - %-40s %d of %d permissions\n", rc.Role.Name, len(rc.Covers), rc.TotalPermissions)
+								names = append(names, rc.Role.Name)
+								for _, perm := range rc.Covers {
+									fmt.Printf("      ✓ %s\n", perm)
+								}
 							}
-						}
 
-						for perm := range perms2Map {
-							if !perms1Map[perm] {
-								onlyInRole2 = append(onlyInRole2, perm)
+							cmd.Record(ctx, names)
+
+							if len(result.Uncovered) > 0 {
+								fmt.Printf("\nPermissions not granted by any role (%d):\n", len(result.Uncovered))
+								for _, perm := range result.Uncovered {
+									fmt.Printf("  x %s\n", perm)
+								}
 							}
-						}
 
-						// Display comparison results
-						fmt.Printf("Comparing roles:\n")
-						fmt.Printf("  Role 1: %s (%s)\n", role1.Name, role1.Title)
-						fmt.Printf("  Role 2: %s (%s)\n\n", role2.Name, role2.Title)
+							return nil
+						}),
+					},
+				},
+			},
+			{
+				Name:  "permission",
+				Usage: "Query IAM Permissions",
+				CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
+					cli.ShowAppHelp(cmd)
+				},
+				Commands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "Show IAM roles with permission",
+						ArgsUsage: "<permission-name>",
+						Description: "Display all IAM roles that include a specific permission.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam permission show storage.objects.get\n" +
+							"  gcp-iam permission show compute.instances.create\n" +
+							"  gcp-iam permission show iam.serviceAccounts.actAs\n" +
+							"  gcp-iam permission show storage.googleapis.com/objects.delete  # deny policy format",
+						ShellComplete: completeArgs(permissionArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							permissionName := c.Args().First()
+							if permissionName == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-						fmt.Printf("Common permissions (%d):\n", len(common))
-						for _, perm := range common {
-							fmt.Printf("  ✓ %s\n", perm)
-						}
+							// Accept deny policy (v2) permission names such as storage.googleapis.com/objects.get
+							if strings.Contains(permissionName, "/") {
+								v1, err := policy.PermissionToV1(permissionName)
+								if err != nil {
+									return err
+								}
+								permissionName = v1
+							}
 
-						fmt.Printf("\nPermissions only in '%s' (%d):\n", role1.Name, len(onlyInRole1))
-						for _, perm := range onlyInRole1 {
-							fmt.Printf("  - %s\n", perm)
-						}
+							permission, err := database.GetPermissionByNameContext(ctx, permissionName)
+							if err != nil {
+								return fmt.Errorf("failed to get permission: %w", err)
+							}
 
-						fmt.Printf("\nPermissions only in '%s' (%d):\n", role2.Name, len(onlyInRole2))
-						for _, perm := range onlyInRole2 {
-							fmt.Printf("  + %s\n", perm)
-						}
+							if permission == nil {
+								fmt.Printf("Permission '%s' not found\n", permissionName)
+								return nil
+							}
 
-						fmt.Printf("\nSummary:\n")
-						fmt.Printf("  Total permissions in '%s': %d\n", role1.Name, len(perms1))
-						fmt.Printf("  Total permissions in '%s': %d\n", role2.Name, len(perms2))
-						fmt.Printf("  Common permissions: %d\n", len(common))
-						fmt.Printf("  Unique to '%s': %d\n", role1.Name, len(onlyInRole1))
-						fmt.Printf("  Unique to '%s': %d\n", role2.Name, len(onlyInRole2))
+							fmt.Printf("Permission: %s\n", permission.Permission)
+							if v2, err := policy.PermissionToV2(permission.Permission); err == nil {
+								fmt.Printf("Deny policy name: %s\n", v2)
+							}
+
+							roles, err := database.GetRolesWithPermissionContext(ctx, permission.Permission)
+							if err != nil {
+								return fmt.Errorf("failed to get roles with permission: %w", err)
+							}
 
-						return nil
-					}),
+							fmt.Printf("Roles with this permission (%d):\n", len(roles))
+							names := make([]string, 0, len(roles))
+							for _, role := range roles {
+								fmt.Printf("  - %-40s %s\n", role.Name, role.Title)
+								names = append(names, role.Name)
+							}
+							cmd.Record(ctx, names)
+
+							return nil
+						}),
+					},
+					{
+						Name:      "search",
+						Usage:     "Search IAM permissions",
+						ArgsUsage: "<search-query>",
+						Description: "Search for IAM permissions by name using a query string.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam permission search storage\n" +
+							"  gcp-iam permission search create\n" +
+							"  gcp-iam permission search compute.instances",
+						ShellComplete: completeArgs(permissionArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							query := c.Args().First()
+							if query == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
+
+							permissions, err := database.SearchPermissionsContext(ctx, query)
+							if err != nil {
+								return fmt.Errorf("failed to search permissions: %w", err)
+							}
+
+							fmt.Printf("Found %d permissions matching '%s':\n", len(permissions), query)
+							names := make([]string, 0, len(permissions))
+							for _, perm := range permissions {
+								fmt.Printf("  - %s\n", perm.Permission)
+								names = append(names, perm.Permission)
+							}
+							cmd.Record(ctx, names)
+
+							return nil
+						}),
+					},
+					{
+						Name:      "related",
+						Usage:     "List permissions most often granted alongside a permission",
+						ArgsUsage: "<permission-name>",
+						Description: "List the permissions granted by the predefined roles that grant a permission, most\n" +
+							"frequently co-granted first, to find companion permissions a custom role needs.\n\n" +
+							"Columns:\n" +
+							"  COUNT       roles granting both permissions\n" +
+							"  CONFIDENCE  share of the roles granting the permission that grant this one too\n" +
+							"  LIFT        how many times more often both are granted than by chance; permissions\n" +
+							"              most roles grant, such as resourcemanager.projects.get, stay near 1\n\n" +
+							"Sorting by lift favors permissions specific to the permission's roles; use --min-count\n" +
+							"to leave out ones granted together by a single role.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam permission related storage.objects.get\n" +
+							"  gcp-iam permission related --sort lift --min-count 3 compute.instances.create\n" +
+							"  gcp-iam permission related --limit 0 iam.serviceAccounts.actAs",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "sort",
+								Usage: "Sort by: count or lift",
+								Value: "count",
+							},
+							&cli.IntFlag{
+								Name:  "min-count",
+								Usage: "Only show permissions granted together by at least this many roles",
+								Value: 1,
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Usage: "Maximum number of permissions to show, 0 for all",
+								Value: 20,
+							},
+						},
+						ShellComplete: completeArgs(permissionArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							permissionName := c.Args().First()
+							if permissionName == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
+
+							sortBy := c.String("sort")
+							if sortBy != "count" && sortBy != "lift" {
+								return fmt.Errorf("invalid sort '%s': expected count or lift", sortBy)
+							}
+
+							// Accept deny policy (v2) permission names such as storage.googleapis.com/objects.get
+							if strings.Contains(permissionName, "/") {
+								v1, err := policy.PermissionToV1(permissionName)
+								if err != nil {
+									return err
+								}
+								permissionName = v1
+							}
+
+							roles, err := database.GetRolesWithPermissionContext(ctx, permissionName)
+							if err != nil {
+								return fmt.Errorf("failed to get roles with permission: %w", err)
+							}
+							if len(roles) == 0 {
+								return fmt.Errorf("permission '%s' not found", permissionName)
+							}
+
+							related, err := database.RelatedPermissionsContext(ctx, permissionName)
+							if err != nil {
+								return fmt.Errorf("failed to find permissions related to '%s': %w", permissionName, err)
+							}
+
+							minCount := int(c.Int("min-count"))
+							related = slices.DeleteFunc(related, func(r db.RelatedPermission) bool { return r.Count < minCount })
+							if sortBy == "lift" {
+								slices.SortStableFunc(related, func(a, b db.RelatedPermission) int { return cmp.Compare(b.Lift, a.Lift) })
+							}
+							if limit := int(c.Int("limit")); limit > 0 && len(related) > limit {
+								related = related[:limit]
+							}
+
+							fmt.Printf("Permissions granted alongside '%s' by its %d roles:\n\n", permissionName, len(roles))
+							if len(related) == 0 {
+								fmt.Println("No permissions found")
+								return nil
+							}
+
+							tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+							fmt.Fprintln(tw, "COUNT\tCONFIDENCE\tLIFT\tPERMISSION")
+							names := make([]string, 0, len(related))
+							for _, r := range related {
+								fmt.Fprintf(tw, "%d\t%.0f%%\t%.2f\t%s\n", r.Count, r.Confidence*100, r.Lift, r.Permission)
+								names = append(names, r.Permission)
+							}
+							cmd.Record(ctx, names)
+							return tw.Flush()
+						}),
+					},
 				},
 			},
-		},
-		{
-			Name:  "permission",
-			Usage: "Query IAM Permissions",
-			CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
-				cli.ShowAppHelp(cmd)
+			{
+				Name:  "service",
+				Usage: "Query Google Cloud Services",
+				CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
+					cli.ShowAppHelp(cmd)
+				},
+				Commands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "Show service details",
+						ArgsUsage: "<service-name>",
+						Description: "Display detailed information about a specific Google Cloud service.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam service show storage.googleapis.com\n" +
+							"  gcp-iam service show compute.googleapis.com",
+						ShellComplete: completeArgs(serviceArg),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							serviceName := c.Args().First()
+							if serviceName == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
+
+							service, err := database.GetServiceByNameContext(ctx, serviceName)
+							if err != nil {
+								return fmt.Errorf("failed to get service: %w", err)
+							}
+
+							if service == nil {
+								fmt.Printf("Service '%s' not found\n", serviceName)
+								return nil
+							}
+
+							fmt.Printf("Service: %s\n", service.Name)
+							fmt.Printf("Title: %s\n", service.Title)
+
+							return nil
+						}),
+					},
+					{
+						Name:      "search",
+						Usage:     "Search for services",
+						ArgsUsage: "<query>",
+						Description: "Search for Google Cloud services by name or title.\n\n" +
+							"The search is case-insensitive and matches partial strings in:\n" +
+							"  • Service name (e.g., 'storage.googleapis.com')\n" +
+							"  • Service title (e.g., 'Cloud Storage')\n\n" +
+							"Examples:\n" +
+							"  gcp-iam service search storage\n" +
+							"  gcp-iam service search compute\n" +
+							"  gcp-iam service search 'cloud sql'",
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							query := strings.Join(c.Args().Slice(), " ")
+							if query == "" {
+								return cli.ShowSubcommandHelp(c)
+							}
+
+							services, err := database.SearchServicesContext(ctx, query)
+							if err != nil {
+								return fmt.Errorf("failed to search services: %w", err)
+							}
+
+							if len(services) == 0 {
+								fmt.Printf("No services found matching '%s'\n", query)
+								return nil
+							}
+
+							fmt.Printf("Found %d services matching '%s':\n", len(services), query)
+							names := make([]string, 0, len(services))
+							for _, service := range services {
+								fmt.Printf("  - %-40s %s\n", service.Name, service.Title)
+								names = append(names, service.Name)
+							}
+							cmd.Record(ctx, names)
+
+							return nil
+						}),
+					},
+				},
 			},
-			Commands: []*cli.Command{
-				{
-					Name:      "show",
-					Usage:     "Show IAM roles with permission",
-					ArgsUsage: "<permission-name>",
-					Description: "Display all IAM roles that include a specific permission.\n\n" +
-						"Examples:\n" +
-						"  gcp-iam permission show storage.objects.get\n" +
-						"  gcp-iam permission show compute.instances.create\n" +
-						"  gcp-iam permission show iam.serviceAccounts.actAs",
-					ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-						completePermissionNames(cmd)
+			{
+				Name:  "policy",
+				Usage: "Analyze IAM policy files",
+				CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
+					cli.ShowAppHelp(cmd)
+				},
+				Commands: []*cli.Command{
+					{
+						Name:      "analyze",
+						Usage:     "Show effective permissions granted by IAM policies",
+						ArgsUsage: "<policy.json|plan.json>...",
+						Description: "Resolve the roles granted to each member of IAM policy files into effective permissions.\n\n" +
+							"Bindings with IAM conditions are evaluated against the request context given by\n" +
+							"--resource-name, --resource-type, --resource-service and --time. Conditions that\n" +
+							"reference attributes not supplied (or unsupported functions) cannot be evaluated;\n" +
+							"permissions granted only through them are reported as conditional.\n\n" +
+							"Deny policies (--deny) take precedence over allow policies: denied permissions are\n" +
+							"removed from the effective permissions and reported separately.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam policy analyze policy.json\n" +
+							"  gcp-iam policy analyze --deny deny.json policy.json\n" +
+							"  gcp-iam policy analyze --member user:alice@example.com --permissions policy.json\n" +
+							"  gcp-iam policy analyze --resource-name projects/_/buckets/logs --time 2025-06-01T00:00:00Z policy.json",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "member",
+								Usage: "Only show access for this member (e.g. user:alice@example.com)",
+							},
+							&cli.BoolFlag{
+								Name:  "permissions",
+								Usage: "List effective permissions instead of counts",
+							},
+							&cli.StringSliceFlag{
+								Name:  "deny",
+								Usage: "IAM deny policy file to apply (can be repeated)",
+							},
+						}, requestFlags()...),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							files := c.Args().Slice()
+							if len(files) == 0 {
+								return cli.ShowSubcommandHelp(c)
+							}
+
+							req, err := requestFromFlags(c)
+							if err != nil {
+								return err
+							}
+
+							var policies []policy.Policy
+							for _, file := range files {
+								loaded, err := policy.Load(file)
+								if err != nil {
+									return err
+								}
+								policies = append(policies, loaded...)
+							}
+
+							analyzer, err := policy.NewAnalyzer(database)
+							if err != nil {
+								return err
+							}
+
+							var denies []policy.DenyPolicy
+							for _, file := range c.StringSlice("deny") {
+								loaded, err := policy.LoadDeny(file)
+								if err != nil {
+									return err
+								}
+								denies = append(denies, loaded...)
+							}
+
+							access, err := analyzer.Analyze(policies, denies, req)
+							if err != nil {
+								return fmt.Errorf("failed to analyze policies: %w", err)
+							}
+
+							member := c.String("member")
+							found := false
+							for _, ma := range access {
+								if member != "" && ma.Member != member {
+									continue
+								}
+								found = true
+
+								fmt.Printf("Member: %s\n", ma.Member)
+								printMemberAccess(ma, "", c.Bool("permissions"))
+							}
+
+							switch {
+							case !found && member != "":
+								fmt.Printf("Member '%s' not found in policies\n", member)
+							case !found:
+								fmt.Println("No bindings found")
+							}
+
+							return nil
+						}),
 					},
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						permissionName := c.Args().First()
-						if permissionName == "" {
-							return cli.ShowSubcommandHelp(c)
-						}
+					{
+						Name:  "effective",
+						Usage: "Show effective permissions of a member on a resource, including inherited policies",
+						Description: "Simulate IAM policy inheritance through the resource hierarchy.\n\n" +
+							"The hierarchy file (YAML) lists resources with their parents, and optionally a policy file\n" +
+							"and resource type. Policies default to <policies-dir>/<resource-name>.json and deny policies\n" +
+							"to <policies-dir>/<resource-name>.deny.json (or set 'deny' on the node). Group membership\n" +
+							"can be declared in the 'groups' section, since it cannot be resolved offline:\n\n" +
+							"  nodes:\n" +
+							"    - name: organizations/123\n" +
+							"    - name: folders/456\n" +
+							"      parent: organizations/123\n" +
+							"    - name: projects/demo\n" +
+							"      parent: folders/456\n" +
+							"      type: cloudresourcemanager.googleapis.com/Project\n" +
+							"      policy: demo-policy.json\n" +
+							"  groups:\n" +
+							"    group:ops@example.com: [user:alice@example.com]\n\n" +
+							"Examples:\n" +
+							"  gcp-iam policy effective --policies ./policies --resource projects/demo --member user:alice@example.com\n" +
+							"  gcp-iam policy effective --hierarchy org.yaml --resource projects/demo --member user:alice@example.com --permissions",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "policies",
+								Usage: "Directory containing the IAM policy files (default: directory of the hierarchy file)",
+							},
+							&cli.StringFlag{
+								Name:  "hierarchy",
+								Usage: "Resource hierarchy description (default: <policies>/hierarchy.yaml)",
+							},
+							&cli.StringFlag{
+								Name:     "resource",
+								Usage:    "Resource to evaluate (e.g. projects/demo)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "member",
+								Usage:    "Member to evaluate (e.g. user:alice@example.com)",
+								Required: true,
+							},
+							&cli.BoolFlag{
+								Name:  "permissions",
+								Usage: "List effective permissions instead of counts",
+							},
+						}, requestFlags()...),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							policyDir := c.String("policies")
+							hierarchyFile := c.String("hierarchy")
+							if hierarchyFile == "" {
+								if policyDir == "" {
+									return fmt.Errorf("either --policies or --hierarchy is required")
+								}
+								hierarchyFile = filepath.Join(policyDir, "hierarchy.yaml")
+							}
 
-						permission, err := database.GetPermissionByName(permissionName)
-						if err != nil {
-							return fmt.Errorf("failed to get permission: %w", err)
-						}
+							hierarchy, err := policy.LoadHierarchy(hierarchyFile, policyDir)
+							if err != nil {
+								return err
+							}
+
+							req, err := requestFromFlags(c)
+							if err != nil {
+								return err
+							}
+
+							analyzer, err := policy.NewAnalyzer(database)
+							if err != nil {
+								return err
+							}
+
+							resource := c.String("resource")
+							member := c.String("member")
+							access, err := analyzer.Effective(hierarchy, resource, member, req)
+							if err != nil {
+								return fmt.Errorf("failed to compute effective permissions: %w", err)
+							}
+
+							fmt.Printf("Effective access for %s on %s:\n", member, resource)
+							printMemberAccess(access, resource, c.Bool("permissions"))
 
-						if permission == nil {
-							fmt.Printf("Permission '%s' not found\n", permissionName)
 							return nil
-						}
+						}),
+					},
+				},
+			},
+			{
+				Name:  "access",
+				Usage: "Query access granted by a set of IAM policies",
+				CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
+					cli.ShowAppHelp(cmd)
+				},
+				Commands: []*cli.Command{
+					{
+						Name:  "who",
+						Usage: "Show members granted a permission on any resource",
+						Description: "Find every member/resource pair granted a permission via any role in a folder of\n" +
+							"exported IAM policies. Policy files are read recursively from --policies; resources are\n" +
+							"named after the file path (projects/demo.json -> projects/demo) unless the file carries\n" +
+							"a resource name (Cloud Asset Inventory format). Hidden, node_modules and vendor\n" +
+							"directories are not searched, and JSON files that are not IAM policies are skipped\n" +
+							"with a warning.\n\n" +
+							"Bindings whose IAM condition evaluates to false for the request context are excluded.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam access who --permission storage.objects.delete --policies .\n" +
+							"  gcp-iam access who --permission iam.serviceAccounts.actAs --policies ./policies",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:     "permission",
+								Usage:    "Permission to look for (e.g. storage.objects.delete)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "policies",
+								Usage:    "Directory containing exported IAM policy files",
+								Required: true,
+							},
+						}, requestFlags()...),
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							permissionName := c.String("permission")
+							if strings.Contains(permissionName, "/") {
+								v1, err := policy.PermissionToV1(permissionName)
+								if err != nil {
+									return err
+								}
+								permissionName = v1
+							}
 
-						fmt.Printf("Permission: %s\n", permission.Permission)
+							permission, err := database.GetPermissionByNameContext(ctx, permissionName)
+							if err != nil {
+								return fmt.Errorf("failed to get permission: %w", err)
+							}
+							if permission == nil {
+								return fmt.Errorf("permission '%s' not found", permissionName)
+							}
 
-						roles, err := database.GetRolesWithPermission(permission.Permission)
-						if err != nil {
-							return fmt.Errorf("failed to get roles with permission: %w", err)
-						}
+							policies, warnings, err := policy.LoadDir(c.String("policies"))
+							if err != nil {
+								return err
+							}
+							for _, warning := range warnings {
+								fmt.Fprintf(os.Stderr, "Warning: %v (skipped)\n", warning)
+							}
 
-						fmt.Printf("Roles with this permission (%d):\n", len(roles))
-						for _, role := range roles {
-							fmt.Printf("  - %-40s %s\n", role.Name, role.Title)
-						}
+							req, err := requestFromFlags(c)
+							if err != nil {
+								return err
+							}
+
+							analyzer, err := policy.NewAnalyzer(database)
+							if err != nil {
+								return err
+							}
 
-						return nil
-					}),
+							access, err := analyzer.WhoCan(policies, permissionName, req)
+							if err != nil {
+								return fmt.Errorf("failed to resolve access: %w", err)
+							}
+
+							fmt.Printf("Found %d grants of '%s' in %d policies:\n", len(access), permissionName, len(policies))
+							for _, a := range access {
+								line := fmt.Sprintf("  - %-40s %-40s %s", a.Resource, a.Member, a.Role)
+								if a.Status != policy.ConditionNone {
+									title := ""
+									if a.Condition != nil && a.Condition.Title != "" {
+										title = fmt.Sprintf(" (%s)", a.Condition.Title)
+									}
+									line += fmt.Sprintf(" [%s%s]", a.Status, title)
+								}
+								fmt.Println(line)
+							}
+
+							return nil
+						}),
+					},
 				},
-				{
-					Name:      "search",
-					Usage:     "Search IAM permissions",
-					ArgsUsage: "<search-query>",
-					Description: "Search for IAM permissions by name using a query string.\n\n" +
-						"Examples:\n" +
-						"  gcp-iam permission search storage\n" +
-						"  gcp-iam permission search create\n" +
-						"  gcp-iam permission search compute.instances",
-					ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-						completePermissionNames(cmd)
+			},
+			{
+				Name:      "lint",
+				Usage:     "Lint IAM policies against configurable rules",
+				ArgsUsage: "<policy.json|plan.json>...",
+				Description: "Check IAM policy files or Terraform plans (terraform show -json) against lint rules.\n\n" +
+					"Rules are configured in the 'lint' section of config.yaml:\n" +
+					"  lint:\n" +
+					"    rules:\n" +
+					"      - id: no-basic-roles\n" +
+					"        type: forbid-basic-roles\n" +
+					"      - id: no-unstable-roles\n" +
+					"        type: forbid-stages\n" +
+					"        severity: warning\n" +
+					"        stages: [DEPRECATED, ALPHA]\n" +
+					"      - id: no-public-delete\n" +
+					"        type: forbid-public-permissions\n" +
+					"        permissions: [storage.objects.delete]\n" +
+					"      - id: max-permissions\n" +
+					"        type: max-member-permissions\n" +
+					"        max: 500\n\n" +
+					"Rule types: forbid-basic-roles, forbid-roles, forbid-stages, forbid-public-permissions, max-member-permissions\n\n" +
+					"Examples:\n" +
+					"  gcp-iam lint policy.json\n" +
+					"  gcp-iam lint --format sarif plan.json > results.sarif",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: text or sarif",
+						Value: "text",
 					},
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						query := c.Args().First()
-						if query == "" {
-							return cli.ShowSubcommandHelp(c)
+				},
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					files := c.Args().Slice()
+					if len(files) == 0 {
+						return cli.ShowSubcommandHelp(c)
+					}
+
+					format := c.String("format")
+					if format != "text" && format != "sarif" {
+						return fmt.Errorf("invalid format '%s': expected text or sarif", format)
+					}
+
+					linter, err := lint.New(database, cfg.Lint.Rules)
+					if err != nil {
+						return fmt.Errorf("invalid lint configuration: %w", err)
+					}
+
+					var findings []lint.Finding
+					for _, file := range files {
+						policies, err := policy.Load(file)
+						if err != nil {
+							return err
 						}
 
-						permissions, err := database.SearchPermissions(query)
+						found, err := linter.Lint(file, policies)
 						if err != nil {
-							return fmt.Errorf("failed to search permissions: %w", err)
+							return fmt.Errorf("failed to lint %s: %w", file, err)
 						}
+						findings = append(findings, found...)
+					}
 
-						fmt.Printf("Found %d permissions matching '%s':\n", len(permissions), query)
-						for _, perm := range permissions {
-							fmt.Printf("  - %s\n", perm.Permission)
+					if format == "sarif" {
+						if err := lint.WriteSARIF(os.Stdout, linter.Rules(), findings, Version); err != nil {
+							return fmt.Errorf("failed to write SARIF: %w", err)
 						}
+					} else {
+						lint.WriteText(os.Stdout, findings)
+					}
 
-						return nil
-					}),
-				},
+					for _, f := range findings {
+						if f.Severity == lint.SeverityError {
+							return cli.Exit("", 1)
+						}
+					}
+					return nil
+				}),
 			},
-		},
-		{
-			Name:  "service",
-			Usage: "Query Google Cloud Services",
-			CommandNotFound: func(ctx context.Context, cmd *cli.Command, command string) {
-				cli.ShowAppHelp(cmd)
+			{
+				Name:  "shell",
+				Usage: "Start an interactive shell keeping the database open",
+				Description: "Run gcp-iam commands interactively without the 'gcp-iam' prefix.\n" +
+					"The config and database are loaded once for the whole session.\n\n" +
+					"Features:\n" +
+					"  - line editing and history (saved to ~/.gcp-iam/history)\n" +
+					"  - Tab completion of commands and role, permission and service names\n" +
+					"  - $last expands to the names listed by the previous command, $last[N] to the Nth (from 0)\n" +
+					"  - 'last' prints the previous result, 'exit' or Ctrl+D quits\n\n" +
+					"Example session:\n" +
+					"  gcp-iam> permission show storage.buckets.delete\n" +
+					"  gcp-iam> role compare $last[0] $last[1]",
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					if cmd.SessionFrom(ctx) != nil {
+						return fmt.Errorf("already in a shell")
+					}
+
+					historyPath := ""
+					if dataDir, err := config.DataDir(); err == nil {
+						historyPath = filepath.Join(dataDir, "history")
+					}
+
+					session := &cmd.Session{Config: cfg, DB: database}
+					return shell.New(session, newApp, historyPath).Run(ctx, os.Stdin, os.Stdout)
+				}),
+			},
+			{
+				Name:  "tui",
+				Usage: "Explore roles and permissions interactively",
+				Description: "Open a terminal UI to search roles, browse their permissions and compare roles.\n\n" +
+					"Keys:\n" +
+					"  type       filter roles (live search)\n" +
+					"  ↑/↓ PgUp/PgDn  move the selection\n" +
+					"  Tab        switch between the role list and the permission pane\n" +
+					"  Enter      on a permission: list roles granting it; on a role there: open it\n" +
+					"  Ctrl+S     mark a role; marking a second role opens the compare view\n" +
+					"  Esc        clear search / go back / quit\n" +
+					"  Ctrl+C     quit",
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					return tui.Run(ctx, database, os.Stdin, os.Stdout)
+				}),
+			},
+			{
+				Name:  "mcp",
+				Usage: "Run a Model Context Protocol (MCP) server over stdio",
+				Description: "Serve IAM queries to AI assistants using the Model Context Protocol over stdin/stdout.\n\n" +
+					"Tools: get_role, search_roles, roles_with_permission, compare_roles, minimal_roles_for_permissions\n\n" +
+					"Example client configuration:\n" +
+					"  {\"mcpServers\": {\"gcp-iam\": {\"command\": \"gcp-iam\", \"args\": [\"mcp\"]}}}",
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					// stdout carries the protocol; diagnostics must go to stderr
+					if err := mcp.New(database, Version).Serve(ctx, os.Stdin, os.Stdout); err != nil {
+						return fmt.Errorf("mcp server failed: %w", err)
+					}
+					return nil
+				}),
 			},
-			Commands: []*cli.Command{
-				{
-					Name:      "show",
-					Usage:     "Show service details",
-					ArgsUsage: "<service-name>",
-					Description: "Display detailed information about a specific Google Cloud service.\n\n" +
-						"Examples:\n" +
-						"  gcp-iam service show storage.googleapis.com\n" +
-						"  gcp-iam service show compute.googleapis.com",
-					ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-						completeServiceNames(cmd)
+			{
+				Name:  "serve",
+				Usage: "Serve the IAM database as a web UI and REST JSON API",
+				Description: "Start a read-only HTTP server exposing roles, permissions, services, compare and solve.\n" +
+					"A web UI for searching, comparing roles and finding the role you need is served at /.\n\n" +
+					"Endpoints (all GET, JSON):\n" +
+					"  /v1/roles?q=             /v1/roles/{name}   /v1/roles/{name}/permissions\n" +
+					"  /v1/permissions?q=       /v1/permissions/{name}\n" +
+					"  /v1/services?q=          /v1/services/{name}\n" +
+					"  /v1/compare?role=a&role=b\n" +
+					"  /v1/solve?permission=a&permission=b\n" +
+					"  /v1/openapi.json         /healthz\n\n" +
+					"List endpoints accept page_size and page_token. Responses carry an ETag and honor If-None-Match.\n\n" +
+					"Examples:\n" +
+					"  gcp-iam serve\n" +
+					"  gcp-iam serve --addr 127.0.0.1:9000",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "Address to listen on",
+						Value: ":8080",
 					},
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						serviceName := c.Args().First()
-						if serviceName == "" {
-							return cli.ShowSubcommandHelp(c)
-						}
+				},
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					addr := c.String("addr")
+					fmt.Printf("Serving web UI and API on %s (press Ctrl+C to stop)\n", addr)
+
+					if err := server.New(database, Version).ListenAndServe(ctx, addr); err != nil {
+						return fmt.Errorf("server failed: %w", err)
+					}
+					return nil
+				}),
+			},
+			{
+				Name:  "update",
+				Usage: "Update IAM roles, permissions, and services",
+				Description: "Fetch the latest data from Google Cloud Platform and update the local database.\n\n" +
+					"Use flags to specify which resources to update:\n" +
+					"  --roles    Update IAM roles and permissions\n" +
+					"  --services Update Google Cloud services\n\n" +
+					"You can specify both flags to update all resources.\n\n" +
+					"--roles fetches the permissions of roles that have none stored. Once the stored\n" +
+					"permissions are older than --if-older-than, or stale_after without it, the\n" +
+					"permissions of every role are fetched again.\n\n" +
+					"Examples:\n" +
+					"  gcp-iam update --roles --services # Update both roles and services\n" +
+					"  gcp-iam update --roles            # Update only roles and permissions\n" +
+					"  gcp-iam update --services         # Update only services\n" +
+					"  gcp-iam update --roles --services --if-older-than 7d   # Cheap enough for cron or shell startup",
+				Metadata: map[string]any{cmd.SkipStaleCheck: true},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "roles",
+						Usage: "Update IAM roles and permissions",
+					},
+					&cli.BoolFlag{
+						Name:  "services",
+						Usage: "Update Google Cloud services",
+					},
+					&cli.StringFlag{
+						Name:  "if-older-than",
+						Usage: "Only update data last updated longer ago than this age, e.g. 7d, 2w or 12h",
+					},
+				},
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					if database.ReadOnly() {
+						return fmt.Errorf("cannot update %s: %w (read_only is set in config.yaml)", cfg.DatabasePath, db.ErrReadOnly)
+					}
 
-						service, err := database.GetServiceByName(serviceName)
+					updater := update.New(database)
+
+					// Determine what to update based on flags
+					updateRoles := c.Bool("roles")
+					updateServices := c.Bool("services")
+
+					// If no flags specified, show help
+					if !updateRoles && !updateServices {
+						return cli.ShowSubcommandHelp(c)
+					}
+
+					// Permissions of roles that already have some are re-fetched once they are older
+					// than --if-older-than, or stale_after without it; otherwise only roles without
+					// permissions are fetched
+					refreshAge := cfg.StaleThreshold()
+
+					// Skip resources that are fresh enough
+					if value := c.String("if-older-than"); value != "" {
+						maxAge, err := config.ParseAge(value)
 						if err != nil {
-							return fmt.Errorf("failed to get service: %w", err)
+							return err
 						}
-
-						if service == nil {
-							fmt.Printf("Service '%s' not found\n", serviceName)
+						refreshAge = maxAge
+						if updateRoles {
+							if updateRoles, err = updater.NeedsUpdate(ctx, maxAge, db.ResourceRoles, db.ResourcePermissions); err != nil {
+								return err
+							}
+							if !updateRoles {
+								fmt.Printf("Roles and permissions were updated within %s, skipping\n", value)
+							}
+						}
+						if updateServices {
+							if updateServices, err = updater.NeedsUpdate(ctx, maxAge, db.ResourceServices); err != nil {
+								return err
+							}
+							if !updateServices {
+								fmt.Printf("Services were updated within %s, skipping\n", value)
+							}
+						}
+						if !updateRoles && !updateServices {
 							return nil
 						}
+					}
 
-						fmt.Printf("Service: %s\n", service.Name)
-						fmt.Printf("Title: %s\n", service.Title)
+					// Update roles and permissions if requested
+					if updateRoles {
+						// First update all roles
+						err := updater.UpdateRoles(ctx)
+						if err != nil {
+							// Check if it's an authentication error and return it directly
+							if strings.Contains(err.Error(), "Authentication failed accessing Google Cloud IAM API") {
+								return err
+							}
+							return fmt.Errorf("failed to update roles: %w", err)
+						}
 
-						return nil
-					}),
-				},
-				{
-					Name:      "search",
-					Usage:     "Search for services",
-					ArgsUsage: "<query>",
-					Description: "Search for Google Cloud services by name or title.\n\n" +
-						"The search is case-insensitive and matches partial strings in:\n" +
-						"  • Service name (e.g., 'storage.googleapis.com')\n" +
-						"  • Service title (e.g., 'Cloud Storage')\n\n" +
-						"Examples:\n" +
-						"  gcp-iam service search storage\n" +
-						"  gcp-iam service search compute\n" +
-						"  gcp-iam service search 'cloud sql'",
-					Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-						query := strings.Join(c.Args().Slice(), " ")
-						if query == "" {
-							return cli.ShowSubcommandHelp(c)
+						refresh := false
+						if refreshAge > 0 {
+							if refresh, err = updater.NeedsUpdate(ctx, refreshAge, db.ResourcePermissions); err != nil {
+								return err
+							}
 						}
 
-						services, err := database.SearchServices(query)
+						// Then update permissions of all roles if they are outdated, otherwise only of roles that have none
+						if refresh {
+							err = updater.RefreshPermissions(ctx)
+						} else {
+							err = updater.UpdateMissingPermissions(ctx)
+						}
 						if err != nil {
-							return fmt.Errorf("failed to search services: %w", err)
+							if ctx.Err() != nil {
+								return fmt.Errorf("%w\nCompleted roles are saved; run the same command again to resume", err)
+							}
+							return err
 						}
+					}
 
-						if len(services) == 0 {
-							fmt.Printf("No services found matching '%s'\n", query)
-							return nil
+					// Update services if requested
+					if updateServices {
+						err := updater.UpdateServices(ctx)
+						if err != nil {
+							return fmt.Errorf("failed to update services: %w", err)
 						}
+					}
 
-						fmt.Printf("Found %d services matching '%s':\n", len(services), query)
-						for _, service := range services {
-							fmt.Printf("  - %-40s %s\n", service.Name, service.Title)
-						}
+					if err := completion.RebuildCache(ctx, database, cfg.DatabasePath); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: failed to rebuild the completion cache: %v\n", err)
+					}
 
-						return nil
-					}),
-				},
+					fmt.Println("Update completed successfully")
+					return nil
+				}),
 			},
-		},
-		{
-			Name:  "update",
-			Usage: "Update IAM roles, permissions, and services",
-			Description: "Fetch the latest data from Google Cloud Platform and update the local database.\n\n" +
-				"Use flags to specify which resources to update:\n" +
-				"  --roles    Update IAM roles and permissions\n" +
-				"  --services Update Google Cloud services\n\n" +
-				"You can specify both flags to update all resources.\n\n" +
-				"Examples:\n" +
-				"  gcp-iam update --roles --services # Update both roles and services\n" +
-				"  gcp-iam update --roles            # Update only roles and permissions\n" +
-				"  gcp-iam update --services         # Update only services",
-			Flags: []cli.Flag{
-				&cli.BoolFlag{
-					Name:  "roles",
-					Usage: "Update IAM roles and permissions",
-				},
-				&cli.BoolFlag{
-					Name:  "services",
-					Usage: "Update Google Cloud services",
+			{
+				Name:   "complete-roles",
+				Usage:  "List all role names for shell completion",
+				Hidden: true,
+				Action: printNames(db.ResourceRoles),
+			},
+			{
+				Name:   "complete-permissions",
+				Usage:  "List all permission names for shell completion",
+				Hidden: true,
+				Action: printNames(db.ResourcePermissions),
+			},
+			{
+				Name:   "complete-services",
+				Usage:  "List all service names for shell completion",
+				Hidden: true,
+				Action: printNames(db.ResourceServices),
+			},
+			{
+				Name:  "db",
+				Usage: "Maintain the local database",
+				Commands: []*cli.Command{
+					{
+						Name:     "check",
+						Usage:    "Check database integrity and optionally repair it",
+						Metadata: map[string]any{cmd.SkipStaleCheck: true},
+						Description: "Verify the local database after interrupted or failed updates.\n\n" +
+							"Checks:\n" +
+							"  • SQLite file integrity (PRAGMA integrity_check)\n" +
+							"  • Permissions referencing missing roles\n" +
+							"  • Role names still carrying the legacy 'roles/' prefix\n" +
+							"  • Roles with no permissions stored\n\n" +
+							"With --repair, indexes are rebuilt, prefixes stripped and orphaned permissions deleted.\n" +
+							"Roles without permissions are fetched again by 'gcp-iam update --roles'.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam db check\n" +
+							"  gcp-iam db check --repair",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "repair",
+								Usage: "Fix the problems that can be resolved locally",
+							},
+						},
+						Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+							if c.Bool("repair") {
+								result, err := database.RepairContext(ctx)
+								if err != nil {
+									return fmt.Errorf("failed to repair database: %w", err)
+								}
+								fmt.Println("Repair:")
+								if result.Reindexed {
+									fmt.Println("  Rebuilt indexes")
+								}
+								fmt.Printf("  Renamed prefixed roles:       %d\n", result.RenamedRoles)
+								fmt.Printf("  Deleted duplicate roles:      %d\n", result.DeletedDuplicates)
+								fmt.Printf("  Deleted orphaned permissions: %d\n", result.DeletedPermissions)
+								fmt.Println()
+							}
+
+							report, err := database.CheckContext(ctx)
+							if err != nil {
+								return fmt.Errorf("failed to check database: %w", err)
+							}
+
+							fmt.Println("Database check:")
+							if len(report.Integrity) == 0 {
+								fmt.Println("  Integrity:                 ok")
+							} else {
+								fmt.Printf("  Integrity:                 %d problems\n", len(report.Integrity))
+								for _, msg := range report.Integrity {
+									fmt.Printf("    %s\n", msg)
+								}
+							}
+							fmt.Printf("  Orphaned permissions:      %d\n", report.OrphanedPermissions)
+							fmt.Printf("  Prefixed role names:       %d\n", report.PrefixedRoles)
+							fmt.Printf("  Roles without permissions: %d\n", len(report.EmptyRoles))
+
+							if report.OK() {
+								return nil
+							}
+							if len(report.EmptyRoles) > 0 {
+								fmt.Println("\nRun 'gcp-iam update --roles' to fetch permissions for roles without them")
+							}
+							if !c.Bool("repair") && (len(report.Integrity) > 0 || report.OrphanedPermissions > 0 || report.PrefixedRoles > 0) {
+								fmt.Println("\nRun 'gcp-iam db check --repair' to fix the database")
+							}
+							return cli.Exit("", 1)
+						}),
+					},
 				},
 			},
-			Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-				updater := update.New(database)
+			{
+				Name:  "config",
+				Usage: "Show, change and validate the configuration",
+				Description: "Settings are resolved in this order, later ones winning:\n" +
+					"  1. built-in defaults\n" +
+					"  2. top-level settings in config.yaml\n" +
+					"  3. the selected profile in config.yaml\n" +
+					"  4. " + config.EnvDatabase + " and " + config.EnvReadOnly + " environment variables\n" +
+					"  5. the --db flag\n\n" +
+					"The config file is --config, else " + config.EnvConfig + ", else ~/.gcp-iam/config.yaml\n" +
+					"(or $XDG_CONFIG_HOME/gcp-iam/config.yaml when ~/.gcp-iam does not exist).\n" +
+					"The profile is --profile, else " + config.EnvProfile + ", else the 'profile' key of config.yaml.\n\n" +
+					"Example config.yaml with one database per GCP organization:\n" +
+					"  profile: acme\n" +
+					"  profiles:\n" +
+					"    acme:\n" +
+					"      database_path: ~/.gcp-iam/acme.sqlite\n" +
+					"    globex:\n" +
+					"      database_path: /mnt/shared/globex.sqlite\n" +
+					"      read_only: true",
+				Commands: []*cli.Command{
+					{
+						Name:  "show",
+						Usage: "Show the effective configuration",
+						Description: "Print the configuration after applying the profile, environment variables and flags.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam config show\n" +
+							"  gcp-iam --profile globex config show",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							cfg, err := cmd.LoadConfig(c)
+							if err != nil {
+								return err
+							}
 
-				// Determine what to update based on flags
-				updateRoles := c.Bool("roles")
-				updateServices := c.Bool("services")
+							fmt.Printf("# config file: %s\n", cfg.Path)
+							enc := yaml.NewEncoder(os.Stdout)
+							enc.SetIndent(2)
+							if err := enc.Encode(cfg); err != nil {
+								return fmt.Errorf("failed to encode config: %w", err)
+							}
+							return enc.Close()
+						},
+					},
+					{
+						Name:      "set",
+						Usage:     "Change a setting in the config file",
+						ArgsUsage: "<key> <value>",
+						Description: "Store a setting in the config file, keeping other settings and comments.\n\n" +
+							"Keys: " + strings.Join(config.SettableKeys, ", ") + "\n\n" +
+							"Examples:\n" +
+							"  gcp-iam config set profiles.acme.database_path ~/.gcp-iam/acme.sqlite\n" +
+							"  gcp-iam config set profile acme\n" +
+							"  gcp-iam config set read_only true",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							if c.Args().Len() != 2 {
+								return cli.ShowSubcommandHelp(c)
+							}
 
-				// If no flags specified, show help
-				if !updateRoles && !updateServices {
-					return cli.ShowSubcommandHelp(c)
-				}
+							path, err := config.ResolvePath(cmd.LoadOptions(c))
+							if err != nil {
+								return err
+							}
 
-				// Update roles and permissions if requested
-				if updateRoles {
-					// First update all roles
-					err := updater.UpdateRoles(ctx)
+							key, value := c.Args().Get(0), c.Args().Get(1)
+							if err := config.Set(path, key, value); err != nil {
+								return err
+							}
+							fmt.Printf("Set %s = %s in %s\n", key, value, path)
+							return nil
+						},
+					},
+					{
+						Name:  "schema",
+						Usage: "Print the JSON Schema of config.yaml",
+						Description: "Print a JSON Schema for editor completion and validation of config.yaml.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam config schema > ~/.gcp-iam/config.schema.json\n\n" +
+							"Then reference it from config.yaml for the YAML language server:\n" +
+							"  # yaml-language-server: $schema=./config.schema.json",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							schema, err := config.Schema()
+							if err != nil {
+								return fmt.Errorf("failed to generate schema: %w", err)
+							}
+							fmt.Println(string(schema))
+							return nil
+						},
+					},
+					{
+						Name:  "validate",
+						Usage: "Check the configuration for mistakes",
+						Description: "Report unknown keys, values of the wrong type, relative or directory database paths,\n" +
+							"undefined profiles, invalid lint rules and missing read-only databases,\n" +
+							"with the line and column of each problem. Exits with status 1 if problems are found.\n" +
+							"Other commands only warn about unknown keys and relative database paths.\n\n" +
+							"Examples:\n" +
+							"  gcp-iam config validate",
+						Action: func(ctx context.Context, c *cli.Command) error {
+							cfg, err := config.LoadWith(cmd.LoadOptions(c))
+							var verrs config.ValidationErrors
+							if errors.As(err, &verrs) {
+								fmt.Printf("%s has %d problems:\n", verrs[0].File, len(verrs))
+								for _, p := range verrs {
+									fmt.Printf("  - %d:%d: %s\n", p.Line, p.Column, p.Message)
+								}
+								return cli.Exit("", 1)
+							}
+							if err != nil {
+								return err
+							}
+
+							problems := cfg.Validate()
+							if _, err := lint.New(nil, cfg.Lint.Rules); err != nil {
+								problems = append(problems, err)
+							}
+
+							if len(problems) == 0 {
+								fmt.Printf("%s is valid\n", cfg.Path)
+								return nil
+							}
+							fmt.Printf("%s has %d problems:\n", cfg.Path, len(problems))
+							for _, p := range problems {
+								fmt.Printf("  - %v\n", p)
+							}
+							return cli.Exit("", 1)
+						},
+					},
+				},
+			},
+			{
+				Name:     "info",
+				Usage:    "Show application configuration",
+				Metadata: map[string]any{cmd.SkipStaleCheck: true},
+				Description: "Display current application configuration including database statistics and file paths.\n\n" +
+					"Shows:\n" +
+					"  • Number of roles, permissions, and services in database\n" +
+					"  • Configuration file location\n" +
+					"  • Database file location\n\n" +
+					"Examples:\n" +
+					"  gcp-iam info",
+				Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
+					roleCount, err := database.CountRolesContext(ctx)
 					if err != nil {
-						// Check if it's an authentication error and return it directly
-						if strings.Contains(err.Error(), "Authentication failed accessing Google Cloud IAM API") {
-							return err
-						}
-						return fmt.Errorf("failed to update roles: %w", err)
+						return fmt.Errorf("failed to count roles: %w", err)
 					}
 
-					// Then update permissions only for roles that need it
-					fmt.Println("Identifying roles needing permission updates...")
-					rolesToUpdate, err := database.GetRolesNeedingPermissionUpdate()
+					permissionCount, err := database.CountPermissionsContext(ctx)
 					if err != nil {
-						return fmt.Errorf("failed to get roles needing updates: %w", err)
+						return fmt.Errorf("failed to count permissions: %w", err)
 					}
 
-					if len(rolesToUpdate) == 0 {
-						fmt.Println("No roles need permission updates - all roles are up to date")
-					} else {
-						fmt.Printf("Updating permissions for %d roles that need updates...\n", len(rolesToUpdate))
-						for i, role := range rolesToUpdate {
-							fmt.Printf("Updating permissions for role %d/%d: %s\n", i+1, len(rolesToUpdate), role.Name)
-							err = updater.UpdatePermissions(ctx, role.Name)
-							if err != nil {
-								fmt.Printf("Warning: failed to update permissions for role %s: %v\n", role.Name, err)
-								// Continue with other roles even if one fails
-							}
-						}
+					serviceCount, err := database.CountServicesContext(ctx)
+					if err != nil {
+						return fmt.Errorf("failed to count services: %w", err)
 					}
-				}
 
-				// Update services if requested
-				if updateServices {
-					err := updater.UpdateServices(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to update services: %w", err)
+					fmt.Println("GCP IAM Configuration:")
+					fmt.Printf("  Roles:        %d\n", roleCount)
+					fmt.Printf("  Permissions:  %d\n", permissionCount)
+					fmt.Printf("  Services:     %d\n", serviceCount)
+					fmt.Printf("  ConfigFile:   %s\n", cfg.Path)
+					if cfg.Profile != "" {
+						fmt.Printf("  Profile:      %s\n", cfg.Profile)
+					}
+					fmt.Printf("  DatabasePath: %s\n", cfg.DatabasePath)
+					if database.ReadOnly() {
+						fmt.Println("  Mode:         read-only")
 					}
-				}
 
-				fmt.Println("Update completed successfully")
-				return nil
-			}),
-		},
-		{
-			Name:   "complete-roles",
-			Usage:  "List all role names for shell completion",
-			Hidden: true,
-			Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-				roleNames, err := database.GetRoleNames()
-				if err != nil {
-					return err
-				}
+					fmt.Println("Last Update:")
+					threshold := cfg.StaleThreshold()
+					for _, resource := range db.Resources {
+						last, err := database.LastUpdateContext(ctx, resource)
+						if err != nil {
+							return fmt.Errorf("failed to get last update of %s: %w", resource, err)
+						}
 
-				for _, name := range roleNames {
-					fmt.Println(name)
-				}
-				return nil
-			}),
-		},
-		{
-			Name:   "complete-permissions",
-			Usage:  "List all permission names for shell completion",
-			Hidden: true,
-			Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-				permissionNames, err := database.GetPermissionNames()
-				if err != nil {
-					return err
-				}
+						label := fmt.Sprintf("%s:", strings.ToUpper(resource[:1])+resource[1:])
+						if last.IsZero() {
+							fmt.Printf("  %-13s never\n", label)
+							continue
+						}
 
-				for _, name := range permissionNames {
-					fmt.Println(name)
-				}
-				return nil
-			}),
-		},
-		{
-			Name:   "complete-services",
-			Usage:  "List all service names for shell completion",
-			Hidden: true,
-			Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-				serviceNames, err := database.GetServiceNames()
-				if err != nil {
-					return fmt.Errorf("failed to get service names: %w", err)
-				}
+						age := time.Since(last)
+						status := ""
+						if threshold > 0 && age > threshold {
+							status = " - stale"
+						}
+						fmt.Printf("  %-13s %s (%s ago%s)\n", label, last.Local().Format(time.DateTime), cmd.FormatAge(age), status)
+					}
 
-				for _, name := range serviceNames {
-					fmt.Println(name)
-				}
-				return nil
-			}),
+					return nil
+				}),
+			},
 		},
-		{
-			Name:  "info",
-			Usage: "Show application configuration",
-			Description: "Display current application configuration including database statistics and file paths.\n\n" +
-				"Shows:\n" +
-				"  • Number of roles, permissions, and services in database\n" +
-				"  • Configuration file location\n" +
-				"  • Database file location\n\n" +
-				"Examples:\n" +
-				"  gcp-iam info",
-			Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, database *db.DB) error {
-				roleCount, err := database.CountRoles()
-				if err != nil {
-					return fmt.Errorf("failed to count roles: %w", err)
-				}
-
-				permissionCount, err := database.CountPermissions()
-				if err != nil {
-					return fmt.Errorf("failed to count permissions: %w", err)
-				}
-
-				serviceCount, err := database.CountServices()
-				if err != nil {
-					return fmt.Errorf("failed to count services: %w", err)
-				}
-
-				configPath, _ := config.GetDefaultConfigPath()
-				fmt.Println("GCP IAM Configuration:")
-				fmt.Printf("  Roles:        %d\n", roleCount)
-				fmt.Printf("  Permissions:  %d\n", permissionCount)
-				fmt.Printf("  Services:     %d\n", serviceCount)
-				fmt.Printf("  ConfigFile:   %s\n", configPath)
-				fmt.Printf("  DatabasePath: %s\n", cfg.DatabasePath)
+	}
 
-				return nil
-			}),
-		},
-	},
+	setShellComplete(app)
+	return app
 }
 
+var app = newApp()
+
 func main() {
-	err := app.Run(context.Background(), os.Args)
+	// cancel the context on Ctrl-C so commands can stop cleanly and leave the database consistent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := app.Run(ctx, os.Args)
 	if err != nil {
 		log.Fatalf("failed to run command: %v", err)
 	}
@@ -4,8 +4,14 @@ import (
 	"bytes"
 	"context"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/kborovik/gcp-iam/completion"
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/internal/dbtest"
 )
 
 func TestCLICommands(t *testing.T) {
@@ -72,3 +78,62 @@ func TestCLICommands(t *testing.T) {
 		})
 	}
 }
+
+func TestCompleteArgs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, nil, 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv(config.EnvConfig, configPath)
+	t.Setenv("SHELL", "/bin/bash")
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	dbPath := dbtest.File(t, map[string][]string{
+		"viewer":        nil,
+		"editor":        nil,
+		"storage.admin": {"storage.buckets.get", "storage.objects.get"},
+	})
+	t.Setenv(config.EnvDatabase, dbPath)
+
+	tests := []struct {
+		name string
+		args []string
+		word string
+		want []string
+	}{
+		{"first role", []string{"role", "compare"}, "", []string{"editor", "storage.admin", "viewer"}},
+		{"second role excludes first", []string{"role", "compare", "viewer"}, "", []string{"editor", "storage.admin"}},
+		{"third role excludes both", []string{"role", "compare", "viewer", "editor"}, "", []string{"storage.admin"}},
+		{"prefixed word", []string{"role", "show"}, "roles/v", []string{"roles/viewer"}},
+		{"prefixed argument excluded", []string{"role", "compare", "roles/viewer"}, "", []string{"editor", "storage.admin"}},
+		{"single argument", []string{"role", "show", "viewer"}, "", nil},
+		{"every permission", []string{"role", "solve", "storage.buckets.get"}, "", []string{"storage.objects.get"}},
+		{"filtered by word", []string{"permission", "show"}, "storage.o", []string{"storage.objects.get"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(completion.WordEnv, tt.word)
+			args := append([]string{"gcp-iam"}, tt.args...)
+			args = append(args, "--generate-shell-completion")
+
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+			os.Args = args
+
+			var buf bytes.Buffer
+			app := newApp()
+			app.Writer = &buf
+			if err := app.Run(context.Background(), args); err != nil {
+				t.Fatalf("Completion failed: %v", err)
+			}
+
+			got := strings.Fields(buf.String())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
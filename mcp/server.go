@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/kborovik/gcp-iam/db"
+)
+
+// ProtocolVersion is the latest MCP protocol revision implemented by the server
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions lists the protocol revisions the server can negotiate, newest first
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC 2.0 error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// maxMessageSize bounds a single newline-delimited JSON-RPC message
+const maxMessageSize = 4 * 1024 * 1024
+
+// Server is a Model Context Protocol server exposing IAM queries as tools
+type Server struct {
+	db      *db.DB
+	version string
+	tools   []tool
+}
+
+// New creates an MCP server backed by the provided database connection
+func New(database *db.DB, version string) *Server {
+	s := &Server{db: database, version: version}
+	s.tools = s.registerTools()
+	return s
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Serve reads newline-delimited JSON-RPC messages from r and writes responses to w
+// until r is exhausted or ctx is cancelled. This is the MCP stdio transport.
+// Messages are read in a goroutine so cancellation is noticed while waiting for input;
+// a read still pending in r then ends when r is closed or the process exits.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			select {
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-done:
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("failed to read request: %w", err)
+			}
+			return nil
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+
+			resp, ok := s.handleMessage(ctx, line)
+			if !ok {
+				continue
+			}
+			if err := encoder.Encode(resp); err != nil {
+				return fmt.Errorf("failed to write response: %w", err)
+			}
+		}
+	}
+}
+
+// handleMessage processes one message, returning false for notifications which get no response
+func (s *Server) handleMessage(ctx context.Context, data []byte) (response, bool) {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), codeParseError, "parse error: %v", err), true
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		if req.ID == nil {
+			req.ID = json.RawMessage("null")
+		}
+		return errorResponse(req.ID, codeInvalidRequest, "invalid request"), true
+	}
+
+	// notifications (no id) never get a response
+	if req.ID == nil {
+		return response{}, false
+	}
+
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		if rerr, ok := err.(*rpcError); ok {
+			return errorResponse(req.ID, rerr.Code, "%s", rerr.Message), true
+		}
+		return errorResponse(req.ID, codeInternalError, "%v", err), true
+	}
+
+	return response{JSONRPC: "2.0", ID: req.ID, Result: result}, true
+}
+
+func (s *Server) dispatch(ctx context.Context, req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return s.listTools(), nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, error) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, p.ProtocolVersion) {
+		version = p.ProtocolVersion
+	}
+
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities": map[string]any{
+			"tools": map[string]any{},
+		},
+		"serverInfo": map[string]any{
+			"name":    "gcp-iam",
+			"version": s.version,
+		},
+		"instructions": "Authoritative Google Cloud IAM roles, permissions and services from a local database. " +
+			"Use these tools instead of guessing role or permission names.",
+	}, nil
+}
+
+func errorResponse(id json.RawMessage, code int, format string, args ...any) response {
+	return response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &rpcError{Code: code, Message: fmt.Sprintf(format, args...)},
+	}
+}
@@ -0,0 +1,183 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	return New(dbtest.New(t, map[string][]string{
+		"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+		"storage.objectAdmin":  {"storage.objects.get", "storage.objects.delete"},
+	}), "test")
+}
+
+type testResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// run sends newline-delimited messages through Serve and returns the decoded responses
+func run(t *testing.T, s *Server, messages ...string) []testResponse {
+	t.Helper()
+
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(messages, "\n")), &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	var responses []testResponse
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp testResponse
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+func callText(t *testing.T, s *Server, name, arguments string) (string, bool) {
+	t.Helper()
+
+	msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + arguments + `}}`
+	responses := run(t, s, msg)
+	if len(responses) != 1 || responses[0].Error != nil {
+		t.Fatalf("Expected 1 successful response, got %+v", responses)
+	}
+
+	var result struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(responses[0].Result, &result); err != nil {
+		t.Fatalf("Failed to decode tool result: %v", err)
+	}
+	return result.Content[0].Text, result.IsError
+}
+
+func TestServeStopsOnCancel(t *testing.T) {
+	s := newTestServer(t)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Serve(ctx, r, &out)
+	}()
+
+	// Serve is now blocked reading the pipe, which never receives a message
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Expected a clean stop, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after ctx was cancelled")
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	s := newTestServer(t)
+
+	responses := run(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"unknown/method"}`,
+	)
+
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses (notification gets none), got %d", len(responses))
+	}
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(responses[0].Result, &init)
+	if init.ProtocolVersion != "2024-11-05" {
+		t.Errorf("Expected negotiated version 2024-11-05, got %s", init.ProtocolVersion)
+	}
+
+	var list struct {
+		Tools []tool `json:"tools"`
+	}
+	json.Unmarshal(responses[1].Result, &list)
+	names := map[string]bool{}
+	for _, tl := range list.Tools {
+		names[tl.Name] = true
+	}
+	for _, expected := range []string{"get_role", "search_roles", "roles_with_permission", "compare_roles", "minimal_roles_for_permissions"} {
+		if !names[expected] {
+			t.Errorf("Expected tool %s to be listed", expected)
+		}
+	}
+
+	if responses[2].Error == nil || responses[2].Error.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found error, got %+v", responses[2])
+	}
+}
+
+func TestParseError(t *testing.T) {
+	s := newTestServer(t)
+
+	responses := run(t, s, `{not json`)
+	if len(responses) != 1 || responses[0].Error == nil || responses[0].Error.Code != codeParseError {
+		t.Errorf("Expected parse error, got %+v", responses)
+	}
+}
+
+func TestTools(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name      string
+		arguments string
+		contains  string
+		isError   bool
+	}{
+		{"get_role", `{"role":"roles/storage.objectViewer"}`, "storage.objects.list", false},
+		{"get_role", `{"role":"storage.missing"}`, "not found", true},
+		{"search_roles", `{"query":"objectAdmin"}`, "roles/storage.objectAdmin", false},
+		{"roles_with_permission", `{"permission":"storage.objects.delete"}`, "roles/storage.objectAdmin", false},
+		{"roles_with_permission", `{"permission":"storage.buckets.get"}`, "not found", true},
+		{"compare_roles", `{"roles":["storage.objectViewer","storage.objectAdmin"]}`, `"storage.objects.delete"`, false},
+		{"compare_roles", `{"roles":["storage.objectViewer"]}`, "at least 2", true},
+		{"minimal_roles_for_permissions", `{"permissions":["storage.objects.get","storage.objects.list"]}`, "roles/storage.objectViewer", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, isError := callText(t, s, tt.name, tt.arguments)
+			if isError != tt.isError {
+				t.Errorf("Expected isError=%v, got %v: %s", tt.isError, isError, text)
+			}
+			if !strings.Contains(text, tt.contains) {
+				t.Errorf("Expected result to contain %q, got %s", tt.contains, text)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/compare"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/constants"
+	"github.com/kborovik/gcp-iam/solver"
+)
+
+// maxSearchResults caps search tool output so responses stay within assistant context limits
+const maxSearchResults = 50
+
+// tool is an MCP tool definition with its handler
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+	handler     func(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+func stringProperty(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func stringArrayProperty(description string, minItems int) map[string]any {
+	return map[string]any{
+		"type":        "array",
+		"items":       map[string]any{"type": "string"},
+		"minItems":    minItems,
+		"description": description,
+	}
+}
+
+func objectSchema(required []string, properties map[string]any) map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func (s *Server) registerTools() []tool {
+	return []tool{
+		{
+			Name:        "get_role",
+			Description: "Get a predefined Google Cloud IAM role with its title, description, launch stage and full list of permissions.",
+			InputSchema: objectSchema([]string{"role"}, map[string]any{
+				"role": stringProperty("Role name, with or without the roles/ prefix, e.g. storage.objectViewer"),
+			}),
+			handler: s.getRole,
+		},
+		{
+			Name:        "search_roles",
+			Description: "Search predefined Google Cloud IAM roles by name, title or description.",
+			InputSchema: objectSchema([]string{"query"}, map[string]any{
+				"query": stringProperty("Search text, e.g. 'storage' or 'instance admin'"),
+			}),
+			handler: s.searchRoles,
+		},
+		{
+			Name:        "roles_with_permission",
+			Description: "List the predefined Google Cloud IAM roles that grant an exact permission.",
+			InputSchema: objectSchema([]string{"permission"}, map[string]any{
+				"permission": stringProperty("Permission name, e.g. storage.objects.get"),
+			}),
+			handler: s.rolesWithPermission,
+		},
+		{
+			Name:        "compare_roles",
+			Description: "Compare the permissions of two or more IAM roles: permissions common to all, permissions unique to each and the Jaccard similarity of every pair.",
+			InputSchema: objectSchema([]string{"roles"}, map[string]any{
+				"roles": stringArrayProperty("Role names to compare", 2),
+			}),
+			handler: s.compareRoles,
+		},
+		{
+			Name: "minimal_roles_for_permissions",
+			Description: "Find a small set of predefined IAM roles that together grant all the given permissions, " +
+				"preferring roles with fewer total permissions. Permissions no role grants are reported as uncovered.",
+			InputSchema: objectSchema([]string{"permissions"}, map[string]any{
+				"permissions": stringArrayProperty("Permission names that must be granted", 1),
+			}),
+			handler: s.minimalRoles,
+		},
+	}
+}
+
+func (s *Server) listTools() any {
+	return map[string]any{"tools": s.tools}
+}
+
+// callTool runs a tool. Tool failures are reported in the result with isError set,
+// so the assistant can see and react to them, rather than as protocol errors.
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+
+	for _, t := range s.tools {
+		if t.Name != p.Name {
+			continue
+		}
+
+		args := p.Arguments
+		if len(args) == 0 {
+			args = json.RawMessage("{}")
+		}
+
+		result, err := t.handler(ctx, args)
+		if err != nil {
+			return toolResult(err.Error(), true), nil
+		}
+
+		text, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode result: %w", err)
+		}
+		return toolResult(string(text), false), nil
+	}
+
+	return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", p.Name)}
+}
+
+func toolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// =============================================================================
+// TOOL HANDLERS
+// =============================================================================
+
+func decodeArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) lookupRole(ctx context.Context, name string) (*db.Role, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), constants.RolePrefix)
+	if name == "" {
+		return nil, fmt.Errorf("role is required")
+	}
+
+	role, err := s.db.GetRoleByNameContext(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role '%s': %w", name, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role '%s' not found; use search_roles to find the exact name", name)
+	}
+	return role, nil
+}
+
+func (s *Server) getRole(ctx context.Context, args json.RawMessage) (any, error) {
+	var a struct {
+		Role string `json:"role"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+
+	role, err := s.lookupRole(ctx, a.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.db.GetRolePermissionNamesContext(ctx, role.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+	}
+
+	return map[string]any{
+		"name":        constants.RolePrefix + role.Name,
+		"title":       role.Title,
+		"description": role.Description,
+		"stage":       role.Stage,
+		"permissions": permissions,
+	}, nil
+}
+
+type roleSummary struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Stage string `json:"stage"`
+}
+
+func summarize(roles []db.Role) []roleSummary {
+	summaries := make([]roleSummary, 0, len(roles))
+	for _, role := range roles {
+		summaries = append(summaries, roleSummary{
+			Name:  constants.RolePrefix + role.Name,
+			Title: role.Title,
+			Stage: role.Stage,
+		})
+	}
+	return summaries
+}
+
+func (s *Server) searchRoles(ctx context.Context, args json.RawMessage) (any, error) {
+	var a struct {
+		Query string `json:"query"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(a.Query) == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	roles, err := s.db.SearchRolesContext(ctx, a.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search roles: %w", err)
+	}
+
+	result := map[string]any{"total": len(roles)}
+	if len(roles) > maxSearchResults {
+		roles = roles[:maxSearchResults]
+		result["truncated"] = true
+	}
+	result["roles"] = summarize(roles)
+	return result, nil
+}
+
+func (s *Server) rolesWithPermission(ctx context.Context, args json.RawMessage) (any, error) {
+	var a struct {
+		Permission string `json:"permission"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+
+	permission, err := s.db.GetPermissionByNameContext(ctx, a.Permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permission: %w", err)
+	}
+	if permission == nil {
+		return nil, fmt.Errorf("permission '%s' not found in any predefined role", a.Permission)
+	}
+
+	roles, err := s.db.GetRolesWithPermissionContext(ctx, a.Permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles with permission: %w", err)
+	}
+
+	return map[string]any{
+		"permission": a.Permission,
+		"roles":      summarize(roles),
+	}, nil
+}
+
+func (s *Server) compareRoles(ctx context.Context, args json.RawMessage) (any, error) {
+	var a struct {
+		Roles []string `json:"roles"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if len(a.Roles) < 2 {
+		return nil, fmt.Errorf("at least 2 roles are required")
+	}
+
+	roles := make([]compare.RolePermissions, 0, len(a.Roles))
+	for _, name := range a.Roles {
+		role, err := s.lookupRole(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		permissions, err := s.db.GetRolePermissionNamesContext(ctx, role.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+		}
+		roles = append(roles, compare.RolePermissions{Role: role.Name, Permissions: permissions})
+	}
+
+	return compare.Compare(roles), nil
+}
+
+func (s *Server) minimalRoles(ctx context.Context, args json.RawMessage) (any, error) {
+	var a struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return nil, err
+	}
+	if len(a.Permissions) == 0 {
+		return nil, fmt.Errorf("at least 1 permission is required")
+	}
+
+	result, err := solver.MinimalRoles(ctx, s.db, a.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]map[string]any, 0, len(result.Roles))
+	for _, rc := range result.Roles {
+		roles = append(roles, map[string]any{
+			"name":              constants.RolePrefix + rc.Role.Name,
+			"title":             rc.Role.Title,
+			"grants":            rc.Covers,
+			"total_permissions": rc.TotalPermissions,
+		})
+	}
+
+	return map[string]any{
+		"roles":     roles,
+		"uncovered": result.Uncovered,
+	}, nil
+}
@@ -0,0 +1,19 @@
+// Package iam is a Go API for the local Google Cloud IAM dataset maintained by gcp-iam.
+//
+// It offers role, permission and service lookups, role comparison and minimal role
+// solving without depending on the command line interface:
+//
+//	client, err := iam.Open()
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	role, err := client.Role(ctx, "roles/storage.objectViewer")
+//	if errors.Is(err, iam.ErrNotFound) {
+//		// role does not exist
+//	}
+//
+// The dataset is populated with `gcp-iam update --roles --services`; until then Open
+// returns an error matching ErrNoDatabase.
+package iam
@@ -0,0 +1,37 @@
+package iam
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is matched by errors.Is for any lookup of an unknown role, permission or service
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidArgument is matched by errors.Is when a method is called with unusable arguments
+	ErrInvalidArgument = errors.New("invalid argument")
+
+	// ErrNoDatabase is matched by errors.Is when Open finds no database file; create one
+	// with `gcp-iam update --roles --services`
+	ErrNoDatabase = errors.New("database not initialized")
+)
+
+// NotFoundError reports which role, permission or service does not exist
+type NotFoundError struct {
+	Kind string // "role", "permission" or "service"
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s '%s' not found", e.Kind, e.Name)
+}
+
+// Is makes NotFoundError match ErrNotFound
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func invalidArgument(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidArgument, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,311 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kborovik/gcp-iam/compare"
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/constants"
+	"github.com/kborovik/gcp-iam/solver"
+)
+
+// Role is a predefined IAM role. Name has no "roles/" prefix.
+type Role struct {
+	Name        string    `json:"name"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Stage       string    `json:"stage"`
+	Deleted     bool      `json:"deleted"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Service is a Google Cloud service such as storage.googleapis.com
+type Service struct {
+	Name      string    `json:"name"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Comparison lists the permissions common to all compared roles and those unique to each role
+type Comparison struct {
+	Roles  []string            `json:"roles"`
+	Common []string            `json:"common"`
+	Unique map[string][]string `json:"unique"`
+	// Similarity[i][j] is the Jaccard similarity of the permissions of Roles[i] and Roles[j]
+	Similarity [][]float64 `json:"similarity"`
+}
+
+// Solution is a set of roles that together grant the requested permissions
+type Solution struct {
+	Roles     []RoleCoverage `json:"roles"`
+	Uncovered []string       `json:"uncovered"`
+}
+
+// RoleCoverage is a role selected by Solve and the requested permissions it grants
+type RoleCoverage struct {
+	Role             Role     `json:"role"`
+	Permissions      []string `json:"permissions"`
+	TotalPermissions int      `json:"total_permissions"`
+}
+
+// Client queries the local IAM database. It is safe for concurrent use.
+type Client struct {
+	db *db.DB
+}
+
+type options struct {
+	databasePath string
+	profile      string
+	readOnly     bool
+}
+
+// Option configures Open
+type Option func(*options)
+
+// WithDatabasePath opens the database at path instead of the one configured in ~/.gcp-iam/config.yaml
+func WithDatabasePath(path string) Option {
+	return func(o *options) {
+		o.databasePath = path
+	}
+}
+
+// WithProfile selects a profile from config.yaml, like the --profile flag
+func WithProfile(name string) Option {
+	return func(o *options) {
+		o.profile = name
+	}
+}
+
+// WithReadOnly opens the database read-only, e.g. a prebuilt database on a shared mount.
+// It is implied when read_only is set in config.yaml.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// Open opens the IAM database. Close the client when done.
+// It neither creates the database nor its directory: if the file does not exist, the
+// error matches ErrNoDatabase.
+func Open(opts ...Option) (*Client, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.databasePath == "" {
+		cfg, err := config.LoadWith(config.Options{Profile: o.profile, NoCreate: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		o.databasePath = cfg.DatabasePath
+		o.readOnly = o.readOnly || cfg.ReadOnly
+	}
+
+	if _, err := os.Stat(o.databasePath); errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s does not exist, run 'gcp-iam update --roles --services'", ErrNoDatabase, o.databasePath)
+	}
+
+	var dbOpts []db.Option
+	if o.readOnly {
+		dbOpts = append(dbOpts, db.WithReadOnly())
+	}
+
+	database, err := db.New(o.databasePath, dbOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &Client{db: database}, nil
+}
+
+// Close closes the database
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// normalizeRoleName strips the "roles/" prefix if present
+func normalizeRoleName(name string) string {
+	return strings.TrimPrefix(strings.TrimSpace(name), constants.RolePrefix)
+}
+
+// Role returns a role by name, with or without the "roles/" prefix
+func (c *Client) Role(ctx context.Context, name string) (*Role, error) {
+	name = normalizeRoleName(name)
+	role, err := c.db.GetRoleByNameContext(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role '%s': %w", name, err)
+	}
+	if role == nil {
+		return nil, &NotFoundError{Kind: "role", Name: name}
+	}
+
+	r := toRole(*role)
+	return &r, nil
+}
+
+// RolePermissions returns the sorted permissions granted by a role
+func (c *Client) RolePermissions(ctx context.Context, name string) ([]string, error) {
+	role, err := c.Role(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := c.db.GetRolePermissionNamesContext(ctx, role.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+	}
+	return permissions, nil
+}
+
+// SearchRoles returns the roles whose name, title or description contains query
+func (c *Client) SearchRoles(ctx context.Context, query string) ([]Role, error) {
+	roles, err := c.db.SearchRolesContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search roles: %w", err)
+	}
+	return toRoles(roles), nil
+}
+
+// RolesWithPermission returns the roles granting a permission.
+// It returns a NotFoundError if no role grants the permission.
+func (c *Client) RolesWithPermission(ctx context.Context, permission string) ([]Role, error) {
+	perm, err := c.db.GetPermissionByNameContext(ctx, permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permission '%s': %w", permission, err)
+	}
+	if perm == nil {
+		return nil, &NotFoundError{Kind: "permission", Name: permission}
+	}
+
+	roles, err := c.db.GetRolesWithPermissionContext(ctx, permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles with permission '%s': %w", permission, err)
+	}
+	return toRoles(roles), nil
+}
+
+// SearchPermissions returns the unique permission names containing query
+func (c *Client) SearchPermissions(ctx context.Context, query string) ([]string, error) {
+	permissions, err := c.db.SearchPermissionsContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search permissions: %w", err)
+	}
+
+	names := make([]string, 0, len(permissions))
+	for _, perm := range permissions {
+		names = append(names, perm.Permission)
+	}
+	return names, nil
+}
+
+// Service returns a service by name, e.g. storage.googleapis.com
+func (c *Client) Service(ctx context.Context, name string) (*Service, error) {
+	service, err := c.db.GetServiceByNameContext(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service '%s': %w", name, err)
+	}
+	if service == nil {
+		return nil, &NotFoundError{Kind: "service", Name: name}
+	}
+
+	s := toService(*service)
+	return &s, nil
+}
+
+// SearchServices returns the services whose name or title contains query
+func (c *Client) SearchServices(ctx context.Context, query string) ([]Service, error) {
+	services, err := c.db.SearchServicesContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search services: %w", err)
+	}
+
+	result := make([]Service, 0, len(services))
+	for _, service := range services {
+		result = append(result, toService(service))
+	}
+	return result, nil
+}
+
+// Compare compares the permissions of two or more roles
+func (c *Client) Compare(ctx context.Context, roles ...string) (*Comparison, error) {
+	if len(roles) < 2 {
+		return nil, invalidArgument("at least 2 roles are required, got %d", len(roles))
+	}
+
+	rolePermissions := make([]compare.RolePermissions, 0, len(roles))
+	for _, name := range roles {
+		role, err := c.Role(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		permissions, err := c.db.GetRolePermissionNamesContext(ctx, role.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get permissions for role '%s': %w", role.Name, err)
+		}
+		rolePermissions = append(rolePermissions, compare.RolePermissions{Role: role.Name, Permissions: permissions})
+	}
+
+	result := compare.Compare(rolePermissions)
+	return &Comparison{Roles: result.Roles, Common: result.Common, Unique: result.Unique, Similarity: result.Similarity}, nil
+}
+
+// Solve finds a small set of roles that together grant all permissions, preferring roles with
+// fewer total permissions. Permissions no role grants are returned in Solution.Uncovered.
+func (c *Client) Solve(ctx context.Context, permissions ...string) (*Solution, error) {
+	if len(permissions) == 0 {
+		return nil, invalidArgument("at least 1 permission is required")
+	}
+	result, err := solver.MinimalRoles(ctx, c.db, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	solution := &Solution{Roles: []RoleCoverage{}, Uncovered: []string{}}
+	for _, rc := range result.Roles {
+		solution.Roles = append(solution.Roles, RoleCoverage{
+			Role:             toRole(rc.Role),
+			Permissions:      rc.Covers,
+			TotalPermissions: rc.TotalPermissions,
+		})
+	}
+	solution.Uncovered = append(solution.Uncovered, result.Uncovered...)
+	return solution, nil
+}
+
+func toRole(r db.Role) Role {
+	return Role{
+		Name:        r.Name,
+		Title:       r.Title,
+		Description: r.Description,
+		Stage:       r.Stage,
+		Deleted:     r.Deleted,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
+
+func toRoles(roles []db.Role) []Role {
+	result := make([]Role, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, toRole(role))
+	}
+	return result
+}
+
+func toService(s db.Service) Service {
+	return Service{
+		Name:      s.Name,
+		Title:     s.Title,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
@@ -0,0 +1,152 @@
+package iam
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	path := dbtest.File(t, map[string][]string{
+		"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+		"storage.objectAdmin":  {"storage.objects.get", "storage.objects.delete"},
+	})
+	database, err := db.New(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := database.InsertService(&db.Service{Name: "storage.googleapis.com", Title: "Cloud Storage"}); err != nil {
+		t.Fatalf("Failed to insert service: %v", err)
+	}
+	database.Close()
+
+	client, err := Open(WithDatabasePath(path))
+	if err != nil {
+		t.Fatalf("Failed to open client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestOpenWithoutDatabase(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(config.EnvConfig, "")
+	t.Setenv(config.EnvDatabase, "")
+	t.Setenv(config.EnvProfile, "")
+
+	path := filepath.Join(t.TempDir(), "missing.sqlite")
+	if _, err := Open(WithDatabasePath(path)); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("Expected ErrNoDatabase for a missing file, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected Open not to create %s", path)
+	}
+
+	if _, err := Open(); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("Expected ErrNoDatabase for the configured database, got %v", err)
+	}
+	if entries, _ := os.ReadDir(home); len(entries) != 0 {
+		t.Errorf("Expected Open not to create files in the home directory, got %v", entries)
+	}
+}
+
+func TestRole(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	role, err := client.Role(ctx, "roles/storage.objectViewer")
+	if err != nil {
+		t.Fatalf("Role failed: %v", err)
+	}
+	if role.Name != "storage.objectViewer" {
+		t.Errorf("Expected storage.objectViewer, got %s", role.Name)
+	}
+
+	permissions, err := client.RolePermissions(ctx, "storage.objectViewer")
+	if err != nil || !reflect.DeepEqual(permissions, []string{"storage.objects.get", "storage.objects.list"}) {
+		t.Errorf("Unexpected permissions %v (%v)", permissions, err)
+	}
+
+	_, err = client.Role(ctx, "storage.missing")
+	var notFound *NotFoundError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &notFound) || notFound.Kind != "role" {
+		t.Errorf("Expected role NotFoundError, got %v", err)
+	}
+}
+
+func TestLookups(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	roles, err := client.RolesWithPermission(ctx, "storage.objects.get")
+	if err != nil || len(roles) != 2 {
+		t.Errorf("Expected 2 roles with storage.objects.get, got %v (%v)", roles, err)
+	}
+
+	if _, err := client.RolesWithPermission(ctx, "storage.buckets.get"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for unknown permission, got %v", err)
+	}
+
+	permissions, err := client.SearchPermissions(ctx, "objects")
+	if err != nil || len(permissions) != 3 {
+		t.Errorf("Expected 3 distinct permissions, got %v (%v)", permissions, err)
+	}
+
+	service, err := client.Service(ctx, "storage.googleapis.com")
+	if err != nil || service.Title != "Cloud Storage" {
+		t.Errorf("Unexpected service %+v (%v)", service, err)
+	}
+
+	if _, err := client.Service(ctx, "missing.googleapis.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for unknown service, got %v", err)
+	}
+}
+
+func TestCompareAndSolve(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	comparison, err := client.Compare(ctx, "storage.objectViewer", "roles/storage.objectAdmin")
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if !reflect.DeepEqual(comparison.Common, []string{"storage.objects.get"}) {
+		t.Errorf("Expected common [storage.objects.get], got %v", comparison.Common)
+	}
+
+	if _, err := client.Compare(ctx, "storage.objectViewer"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for single role, got %v", err)
+	}
+
+	solution, err := client.Solve(ctx, "storage.objects.get", "storage.objects.delete", "unknown.thing.do")
+	if err != nil {
+		t.Fatalf("Solve failed: %v", err)
+	}
+	if len(solution.Roles) != 1 || solution.Roles[0].Role.Name != "storage.objectAdmin" {
+		t.Errorf("Expected storage.objectAdmin, got %+v", solution.Roles)
+	}
+	if !reflect.DeepEqual(solution.Uncovered, []string{"unknown.thing.do"}) {
+		t.Errorf("Expected unknown.thing.do uncovered, got %v", solution.Uncovered)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	client := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.SearchRoles(ctx, "storage"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kborovik/gcp-iam/db"
+)
+
+// Grant is a role granted to a member by a policy binding, with its evaluated condition
+type Grant struct {
+	Resource  string          `json:"resource,omitempty"`
+	Member    string          `json:"member"`
+	Role      string          `json:"role"`
+	Condition *Expr           `json:"condition,omitempty"`
+	Status    ConditionStatus `json:"status"`
+	Err       error           `json:"-"`
+}
+
+// MemberAccess summarizes what a single member is granted under a request context
+type MemberAccess struct {
+	Member      string   `json:"member"`
+	Grants      []Grant  `json:"grants"`
+	Denials     []Denial `json:"denials,omitempty"`
+	Permissions []string `json:"permissions"`
+	Conditional []string `json:"conditional_permissions"`
+	Denied      []string `json:"denied_permissions,omitempty"`
+}
+
+// Access is a member granted a permission on a resource through a role
+type Access struct {
+	Resource  string          `json:"resource"`
+	Member    string          `json:"member"`
+	Role      string          `json:"role"`
+	Condition *Expr           `json:"condition,omitempty"`
+	Status    ConditionStatus `json:"status"`
+}
+
+// Analyzer resolves policy bindings to effective permissions using the local role database
+type Analyzer struct {
+	db        *db.DB
+	roles     *RoleCache
+	evaluator *Evaluator
+}
+
+// RoleCache looks up the permissions of predefined roles in the local database, reading
+// each role once
+type RoleCache struct {
+	db          *db.DB
+	permissions map[string][]string
+}
+
+// NewRoleCache creates an empty RoleCache backed by the provided database connection
+func NewRoleCache(database *db.DB) *RoleCache {
+	return &RoleCache{
+		db:          database,
+		permissions: make(map[string][]string),
+	}
+}
+
+// Permissions returns the permissions of a predefined role.
+// Custom roles are not in the local database and have no known permissions.
+func (c *RoleCache) Permissions(role string) ([]string, error) {
+	roleName, predefined := RoleName(role)
+	if !predefined {
+		return nil, nil
+	}
+
+	if perms, ok := c.permissions[roleName]; ok {
+		return perms, nil
+	}
+
+	perms, err := c.db.GetRolePermissionNames(roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions for role '%s': %w", roleName, err)
+	}
+	c.permissions[roleName] = perms
+
+	return perms, nil
+}
+
+// NewAnalyzer creates an Analyzer backed by the provided database connection
+func NewAnalyzer(database *db.DB) (*Analyzer, error) {
+	evaluator, err := NewEvaluator()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Analyzer{
+		db:        database,
+		roles:     NewRoleCache(database),
+		evaluator: evaluator,
+	}, nil
+}
+
+// Grants expands all bindings into per-member grants and evaluates their conditions
+func (a *Analyzer) Grants(policies []Policy, req Request) []Grant {
+	var grants []Grant
+	for _, p := range policies {
+		for _, binding := range p.Bindings {
+			status, err := a.evaluator.Status(binding.Condition, req)
+			for _, member := range binding.Members {
+				grants = append(grants, Grant{
+					Resource:  p.Resource,
+					Member:    member,
+					Role:      binding.Role,
+					Condition: binding.Condition,
+					Status:    status,
+					Err:       err,
+				})
+			}
+		}
+	}
+	return grants
+}
+
+// Analyze returns the effective access of every member in the policies, sorted by member.
+// Permissions granted only through conditions that cannot be evaluated are reported as conditional.
+// Permissions denied by the deny policies are removed from the result and reported as denied.
+func (a *Analyzer) Analyze(policies []Policy, denies []DenyPolicy, req Request) ([]MemberAccess, error) {
+	byMember := make(map[string][]Grant)
+	for _, grant := range a.Grants(policies, req) {
+		byMember[grant.Member] = append(byMember[grant.Member], grant)
+	}
+
+	members := make([]string, 0, len(byMember))
+	for member := range byMember {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	access := make([]MemberAccess, 0, len(members))
+	for _, member := range members {
+		denials := a.evaluator.Denials(denies, nil, member, req)
+		ma, err := a.memberAccess(member, byMember[member], denials)
+		if err != nil {
+			return nil, err
+		}
+		access = append(access, ma)
+	}
+
+	return access, nil
+}
+
+// WhoCan returns every member/resource pair granted a permission by any binding, sorted by
+// resource and member. Bindings whose condition evaluates to false for req are excluded.
+func (a *Analyzer) WhoCan(policies []Policy, permission string, req Request) ([]Access, error) {
+	roles, err := a.db.GetRolesWithPermission(permission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles with permission '%s': %w", permission, err)
+	}
+
+	granting := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		granting[role.Name] = true
+	}
+
+	var access []Access
+	for _, grant := range a.Grants(policies, req) {
+		roleName, predefined := RoleName(grant.Role)
+		if !predefined || !granting[roleName] || grant.Status == ConditionFalse {
+			continue
+		}
+		access = append(access, Access{
+			Resource:  grant.Resource,
+			Member:    grant.Member,
+			Role:      roleName,
+			Condition: grant.Condition,
+			Status:    grant.Status,
+		})
+	}
+
+	sort.SliceStable(access, func(i, j int) bool {
+		if access[i].Resource != access[j].Resource {
+			return access[i].Resource < access[j].Resource
+		}
+		return access[i].Member < access[j].Member
+	})
+
+	return access, nil
+}
+
+// RolePermissions returns the permissions of a predefined role, caching lookups.
+// Custom roles are not in the local database and have no known permissions.
+func (a *Analyzer) RolePermissions(role string) ([]string, error) {
+	return a.roles.Permissions(role)
+}
+
+func (a *Analyzer) memberAccess(member string, grants []Grant, denials []Denial) (MemberAccess, error) {
+	effective := make(map[string]bool)
+	conditional := make(map[string]bool)
+
+	for _, grant := range grants {
+		if grant.Status == ConditionFalse {
+			continue
+		}
+
+		perms, err := a.RolePermissions(grant.Role)
+		if err != nil {
+			return MemberAccess{}, err
+		}
+
+		for _, perm := range perms {
+			if grant.Status.Effective() {
+				effective[perm] = true
+			} else {
+				conditional[perm] = true
+			}
+		}
+	}
+
+	for perm := range effective {
+		delete(conditional, perm)
+	}
+
+	// Deny policies are evaluated before allow policies: a matching deny rule always wins,
+	// and a deny rule whose condition cannot be evaluated makes the permission conditional
+	denied := make(map[string]bool)
+	for _, denial := range denials {
+		if !denial.Status.Effective() {
+			continue
+		}
+		for _, set := range []map[string]bool{effective, conditional} {
+			for perm := range set {
+				if denial.Denies(perm) {
+					delete(set, perm)
+					denied[perm] = true
+				}
+			}
+		}
+	}
+	for _, denial := range denials {
+		if denial.Status != ConditionUnknown {
+			continue
+		}
+		for perm := range effective {
+			if denial.Denies(perm) {
+				delete(effective, perm)
+				conditional[perm] = true
+			}
+		}
+	}
+
+	return MemberAccess{
+		Member:      member,
+		Grants:      grants,
+		Denials:     denials,
+		Permissions: sortedKeys(effective),
+		Conditional: sortedKeys(conditional),
+		Denied:      sortedKeys(denied),
+	}, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Effective computes the access a member has on a resource, including roles inherited from
+// every ancestor in the hierarchy and deny policies attached to any of them.
+// Conditions see the target resource as resource.name and its node type as resource.type
+// unless req already sets them.
+func (a *Analyzer) Effective(h *Hierarchy, resource, member string, req Request) (MemberAccess, error) {
+	chain, err := h.Ancestors(resource)
+	if err != nil {
+		return MemberAccess{}, err
+	}
+
+	if req.ResourceName == "" {
+		req.ResourceName = resource
+	}
+	if req.ResourceType == "" {
+		req.ResourceType = chain[0].Type
+	}
+
+	var grants []Grant
+	var denials []Denial
+	for _, node := range chain {
+		for _, grant := range a.Grants(node.Policies, req) {
+			if h.MemberMatches(grant.Member, member) {
+				grants = append(grants, grant)
+			}
+		}
+		denials = append(denials, a.evaluator.Denials(node.DenyPolicies, h, member, req)...)
+	}
+
+	return a.memberAccess(member, grants, denials)
+}
@@ -0,0 +1,186 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+// testGrants are the predefined roles the analyzer tests look up
+var testGrants = map[string][]string{
+	"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+	"storage.objectAdmin":  {"storage.objects.get", "storage.objects.delete"},
+	"compute.viewer":       {"compute.instances.get"},
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	evaluator, err := NewEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	req := Request{
+		ResourceName: "projects/_/buckets/logs/objects/2025/app.log",
+		ResourceType: "storage.googleapis.com/Object",
+		Time:         time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`resource.name.startsWith("projects/_/buckets/logs/")`, true},
+		{`resource.name.startsWith("projects/_/buckets/data/")`, false},
+		{`resource.type == "storage.googleapis.com/Object"`, true},
+		{`request.time < timestamp("2026-01-01T00:00:00Z")`, true},
+		{`request.time < timestamp("2025-01-01T00:00:00Z")`, false},
+		{`request.time.getHours("UTC") >= 9 && request.time.getHours("UTC") <= 17`, true},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluator.Evaluate(tt.expression, req)
+		if err != nil {
+			t.Errorf("Failed to evaluate %s: %v", tt.expression, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Evaluate(%s) = %v, expected %v", tt.expression, result, tt.expected)
+		}
+	}
+}
+
+func TestConditionStatus(t *testing.T) {
+	evaluator, err := NewEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	req := Request{Time: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		condition *Expr
+		expected  ConditionStatus
+	}{
+		{nil, ConditionNone},
+		{&Expr{Expression: `request.time < timestamp("2026-01-01T00:00:00Z")`}, ConditionTrue},
+		{&Expr{Expression: `request.time > timestamp("2026-01-01T00:00:00Z")`}, ConditionFalse},
+		// resource.name was not supplied in the request context
+		{&Expr{Expression: `resource.name.startsWith("projects/")`}, ConditionUnknown},
+		// unsupported function
+		{&Expr{Expression: `resource.matchTag("123/env", "prod")`}, ConditionUnknown},
+	}
+
+	for _, tt := range tests {
+		status, _ := evaluator.Status(tt.condition, req)
+		if status != tt.expected {
+			t.Errorf("Status(%v) = %s, expected %s", tt.condition, status, tt.expected)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	policies := []Policy{{
+		Bindings: []Binding{
+			{Role: "roles/storage.objectViewer", Members: []string{"user:a@example.com"}},
+			{
+				Role:      "roles/storage.objectAdmin",
+				Members:   []string{"user:a@example.com"},
+				Condition: &Expr{Title: "expired", Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`},
+			},
+			{
+				Role:      "roles/compute.viewer",
+				Members:   []string{"user:a@example.com", "user:b@example.com"},
+				Condition: &Expr{Title: "tagged", Expression: `resource.matchTag("123/env", "prod")`},
+			},
+		},
+	}}
+
+	access, err := analyzer.Analyze(policies, nil, Request{Time: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Failed to analyze policies: %v", err)
+	}
+
+	if len(access) != 2 {
+		t.Fatalf("Expected 2 members, got %d", len(access))
+	}
+
+	a := access[0]
+	if a.Member != "user:a@example.com" {
+		t.Fatalf("Expected members sorted, got %s first", a.Member)
+	}
+
+	if len(a.Grants) != 3 {
+		t.Errorf("Expected 3 grants, got %d", len(a.Grants))
+	}
+
+	// storage.objects.delete is only granted by the expired binding
+	expected := []string{"storage.objects.get", "storage.objects.list"}
+	if len(a.Permissions) != len(expected) {
+		t.Fatalf("Expected permissions %v, got %v", expected, a.Permissions)
+	}
+	for i, perm := range expected {
+		if a.Permissions[i] != perm {
+			t.Errorf("Expected permission %s, got %s", perm, a.Permissions[i])
+		}
+	}
+
+	if len(a.Conditional) != 1 || a.Conditional[0] != "compute.instances.get" {
+		t.Errorf("Expected compute.instances.get to be conditional, got %v", a.Conditional)
+	}
+}
+
+func TestWhoCan(t *testing.T) {
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	policies := []Policy{
+		{
+			Resource: "projects/b",
+			Bindings: []Binding{
+				{Role: "roles/storage.objectViewer", Members: []string{"user:z@example.com", "user:a@example.com"}},
+				{Role: "roles/compute.viewer", Members: []string{"user:c@example.com"}},
+			},
+		},
+		{
+			Resource: "projects/a",
+			Bindings: []Binding{
+				{Role: "roles/storage.objectAdmin", Members: []string{"group:ops@example.com"}},
+				{
+					Role:      "roles/storage.objectAdmin",
+					Members:   []string{"user:expired@example.com"},
+					Condition: &Expr{Expression: `request.time < timestamp("2020-01-01T00:00:00Z")`},
+				},
+				{Role: "projects/a/roles/custom", Members: []string{"user:custom@example.com"}},
+			},
+		},
+	}
+
+	access, err := analyzer.WhoCan(policies, "storage.objects.get", Request{Time: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to find access: %v", err)
+	}
+
+	expected := []Access{
+		{Resource: "projects/a", Member: "group:ops@example.com", Role: "storage.objectAdmin"},
+		{Resource: "projects/b", Member: "user:a@example.com", Role: "storage.objectViewer"},
+		{Resource: "projects/b", Member: "user:z@example.com", Role: "storage.objectViewer"},
+	}
+
+	if len(access) != len(expected) {
+		t.Fatalf("Expected %d grants, got %d: %+v", len(expected), len(access), access)
+	}
+
+	for i, e := range expected {
+		if access[i].Resource != e.Resource || access[i].Member != e.Member || access[i].Role != e.Role {
+			t.Errorf("Expected %+v at %d, got %+v", e, i, access[i])
+		}
+	}
+}
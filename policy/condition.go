@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Request is the attribute context IAM conditions are evaluated against.
+// Empty fields are left undefined, so conditions referencing them cannot be evaluated.
+type Request struct {
+	ResourceName    string
+	ResourceType    string
+	ResourceService string
+	Time            time.Time
+}
+
+// ConditionStatus is the outcome of evaluating a binding condition
+type ConditionStatus string
+
+const (
+	ConditionNone    ConditionStatus = "unconditional"
+	ConditionTrue    ConditionStatus = "condition met"
+	ConditionFalse   ConditionStatus = "condition not met"
+	ConditionUnknown ConditionStatus = "condition not evaluable"
+)
+
+// Effective reports whether a binding with this status grants access
+func (s ConditionStatus) Effective() bool {
+	return s == ConditionNone || s == ConditionTrue
+}
+
+// Evaluator compiles and evaluates IAM condition expressions with CEL
+type Evaluator struct {
+	env      *cel.Env
+	programs map[string]cel.Program
+}
+
+// NewEvaluator creates an Evaluator exposing the `resource` and `request` attributes
+func NewEvaluator() (*Evaluator, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	return &Evaluator{
+		env:      env,
+		programs: make(map[string]cel.Program),
+	}, nil
+}
+
+// Evaluate evaluates a condition expression against the request context
+func (e *Evaluator) Evaluate(expression string, req Request) (bool, error) {
+	program, err := e.program(expression)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := program.Eval(map[string]any{
+		"resource": req.resourceAttributes(),
+		"request":  req.requestAttributes(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate condition: %w", err)
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluated to %v, expected bool", out.Value())
+	}
+
+	return result, nil
+}
+
+// Status evaluates an optional binding condition, mapping evaluation errors to ConditionUnknown
+func (e *Evaluator) Status(condition *Expr, req Request) (ConditionStatus, error) {
+	if condition == nil || condition.Expression == "" {
+		return ConditionNone, nil
+	}
+
+	ok, err := e.Evaluate(condition.Expression, req)
+	if err != nil {
+		return ConditionUnknown, err
+	}
+	if ok {
+		return ConditionTrue, nil
+	}
+	return ConditionFalse, nil
+}
+
+// program returns the compiled program for an expression, compiling it on first use
+func (e *Evaluator) program(expression string) (cel.Program, error) {
+	if program, ok := e.programs[expression]; ok {
+		return program, nil
+	}
+
+	ast, issues := e.env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile condition: %w", issues.Err())
+	}
+
+	program, err := e.env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile condition: %w", err)
+	}
+
+	e.programs[expression] = program
+	return program, nil
+}
+
+func (r Request) resourceAttributes() map[string]any {
+	attrs := make(map[string]any)
+	if r.ResourceName != "" {
+		attrs["name"] = r.ResourceName
+	}
+	if r.ResourceType != "" {
+		attrs["type"] = r.ResourceType
+	}
+	if r.ResourceService != "" {
+		attrs["service"] = r.ResourceService
+	}
+	return attrs
+}
+
+func (r Request) requestAttributes() map[string]any {
+	attrs := make(map[string]any)
+	if !r.Time.IsZero() {
+		attrs["time"] = r.Time
+	}
+	return attrs
+}
@@ -0,0 +1,257 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ServiceDomain is the domain suffix of Google Cloud service names used in v2 permission names
+const ServiceDomain = ".googleapis.com"
+
+// DenyPolicy is an IAM v2 deny policy as returned by `gcloud iam policies get --kind=denypolicies`
+type DenyPolicy struct {
+	Name        string           `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Etag        string           `json:"etag,omitempty"`
+	Rules       []DenyPolicyRule `json:"rules"`
+	Resource    string           `json:"-"`
+}
+
+// DenyPolicyRule wraps a deny rule with its description
+type DenyPolicyRule struct {
+	Description string   `json:"description,omitempty"`
+	DenyRule    DenyRule `json:"denyRule"`
+}
+
+// DenyRule denies permissions to principals, with exceptions and an optional condition.
+// Principals use the v2 format (principal://goog/subject/alice@example.com) and permissions
+// the v2 format (storage.googleapis.com/buckets.delete).
+type DenyRule struct {
+	DeniedPrincipals     []string `json:"deniedPrincipals"`
+	ExceptionPrincipals  []string `json:"exceptionPrincipals,omitempty"`
+	DeniedPermissions    []string `json:"deniedPermissions"`
+	ExceptionPermissions []string `json:"exceptionPermissions,omitempty"`
+	DenialCondition      *Expr    `json:"denialCondition,omitempty"`
+}
+
+// LoadDeny reads a deny policy file containing a single policy, a JSON array of policies
+// or a `{"policies": [...]}` list response
+func LoadDeny(path string) ([]DenyPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deny policy file: %w", err)
+	}
+
+	policies, err := ParseDeny(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return policies, nil
+}
+
+// ParseDeny decodes one or more deny policies
+func ParseDeny(data []byte) ([]DenyPolicy, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var policies []DenyPolicy
+		if err := json.Unmarshal(data, &policies); err != nil {
+			return nil, fmt.Errorf("invalid deny policy list: %w", err)
+		}
+		return policies, nil
+	}
+
+	var probe struct {
+		Policies []DenyPolicy     `json:"policies"`
+		Rules    []DenyPolicyRule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if probe.Policies != nil {
+		return probe.Policies, nil
+	}
+	if probe.Rules == nil {
+		return nil, fmt.Errorf("unrecognized format: expected deny policy with 'rules'")
+	}
+
+	var p DenyPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid deny policy: %w", err)
+	}
+	return []DenyPolicy{p}, nil
+}
+
+// PermissionToV1 converts a v2 permission name (storage.googleapis.com/buckets.delete)
+// to the v1 format stored in the database (storage.buckets.delete)
+func PermissionToV1(permission string) (string, error) {
+	service, rest, ok := strings.Cut(permission, "/")
+	if !ok {
+		return "", fmt.Errorf("invalid v2 permission '%s': expected service.googleapis.com/resource.verb", permission)
+	}
+
+	prefix, ok := strings.CutSuffix(service, ServiceDomain)
+	if !ok || prefix == "" || rest == "" {
+		return "", fmt.Errorf("invalid v2 permission '%s': expected service.googleapis.com/resource.verb", permission)
+	}
+
+	return prefix + "." + rest, nil
+}
+
+// PermissionToV2 converts a v1 permission name (storage.buckets.delete)
+// to the v2 format used by deny policies (storage.googleapis.com/buckets.delete)
+func PermissionToV2(permission string) (string, error) {
+	service, rest, ok := strings.Cut(permission, ".")
+	if !ok || service == "" || rest == "" || strings.Contains(permission, "/") {
+		return "", fmt.Errorf("invalid permission '%s': expected service.resource.verb", permission)
+	}
+
+	return service + ServiceDomain + "/" + rest, nil
+}
+
+// PrincipalToMember converts a v2 principal identifier to the v1 member format used in allow policies
+func PrincipalToMember(principal string) (string, error) {
+	switch {
+	case principal == "principalSet://goog/public:all":
+		return "allUsers", nil
+	case strings.HasPrefix(principal, "principal://goog/subject/"):
+		return "user:" + strings.TrimPrefix(principal, "principal://goog/subject/"), nil
+	case strings.HasPrefix(principal, "principalSet://goog/group/"):
+		return "group:" + strings.TrimPrefix(principal, "principalSet://goog/group/"), nil
+	case strings.HasPrefix(principal, "principal://iam.googleapis.com/projects/-/serviceAccounts/"):
+		return "serviceAccount:" + strings.TrimPrefix(principal, "principal://iam.googleapis.com/projects/-/serviceAccounts/"), nil
+	}
+
+	return "", fmt.Errorf("unsupported principal '%s'", principal)
+}
+
+// MemberToPrincipal converts a v1 allow policy member to the v2 principal identifier
+func MemberToPrincipal(member string) (string, error) {
+	if member == "allUsers" {
+		return "principalSet://goog/public:all", nil
+	}
+
+	kind, id, ok := strings.Cut(member, ":")
+	if ok {
+		switch kind {
+		case "user":
+			return "principal://goog/subject/" + id, nil
+		case "group":
+			return "principalSet://goog/group/" + id, nil
+		case "serviceAccount":
+			return "principal://iam.googleapis.com/projects/-/serviceAccounts/" + id, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported member '%s'", member)
+}
+
+// Denial is a deny rule that applies to a member
+type Denial struct {
+	Resource    string          `json:"resource,omitempty"`
+	Policy      string          `json:"policy,omitempty"`
+	Rule        DenyRule        `json:"rule"`
+	Status      ConditionStatus `json:"status"`
+	Permissions []string        `json:"-"`
+	Exceptions  []string        `json:"-"`
+	Err         error           `json:"-"`
+}
+
+// Denies reports whether the denial applies to a v1 permission
+func (d Denial) Denies(permission string) bool {
+	return matchAny(d.Permissions, permission) && !matchAny(d.Exceptions, permission)
+}
+
+// Denials returns the deny rules of the policies that apply to a member, with evaluated conditions.
+// Denied permissions that cannot be converted are reported in Err while the others still
+// apply. An exception permission that cannot be converted might exempt any permission, so
+// its rule gets Status ConditionUnknown. So does a rule whose principals may or may not
+// include the member, e.g. an unsupported principal type or a group the hierarchy does
+// not declare.
+func (e *Evaluator) Denials(policies []DenyPolicy, h *Hierarchy, member string, req Request) []Denial {
+	var denials []Denial
+	for _, p := range policies {
+		for _, r := range p.Rules {
+			rule := r.DenyRule
+			denied, deniedErr := principalsMatch(h, rule.DeniedPrincipals, member)
+			exempt, exemptErr := principalsMatch(h, rule.ExceptionPrincipals, member)
+			if exempt || (!denied && deniedErr == nil) {
+				continue
+			}
+
+			denial := Denial{Resource: p.Resource, Policy: p.Name, Rule: rule}
+			denial.Status, denial.Err = e.Status(rule.DenialCondition, req)
+			if err := errors.Join(deniedErr, exemptErr); err != nil {
+				if denial.Status != ConditionFalse {
+					denial.Status = ConditionUnknown
+				}
+				denial.Err = errors.Join(denial.Err, err)
+			}
+
+			var err error
+			if denial.Permissions, err = permissionsToV1(rule.DeniedPermissions); err != nil {
+				denial.Err = errors.Join(denial.Err, err)
+			}
+			if denial.Exceptions, err = permissionsToV1(rule.ExceptionPermissions); err != nil {
+				denial.Status, denial.Err = ConditionUnknown, errors.Join(denial.Err, err)
+			}
+
+			denials = append(denials, denial)
+		}
+	}
+	return denials
+}
+
+// permissionsToV1 converts the permissions it can, returning the errors of the others
+func permissionsToV1(permissions []string) ([]string, error) {
+	converted := make([]string, 0, len(permissions))
+	var errs []error
+	for _, perm := range permissions {
+		v1, err := PermissionToV1(perm)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		converted = append(converted, v1)
+	}
+	return converted, errors.Join(errs...)
+}
+
+// principalsMatch reports whether any v2 principal applies to the v1 member. When none
+// does, the error lists the principals that might: unsupported principal types and groups
+// whose members the hierarchy does not declare.
+func principalsMatch(h *Hierarchy, principals []string, member string) (bool, error) {
+	var errs []error
+	for _, principal := range principals {
+		if principal == "principalSet://goog/public:all" {
+			return true, nil
+		}
+		bindingMember, err := PrincipalToMember(principal)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if h.MemberMatches(bindingMember, member) {
+			return true, nil
+		}
+		if strings.HasPrefix(bindingMember, "group:") && !h.declaresGroup(bindingMember) {
+			errs = append(errs, fmt.Errorf("members of principal '%s' are unknown: add the group to the hierarchy", principal))
+		}
+	}
+	return false, errors.Join(errs...)
+}
+
+// matchAny reports whether the permission matches any pattern; patterns may use * wildcards
+func matchAny(patterns []string, permission string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, permission); ok {
+			return true
+		}
+	}
+	return false
+}
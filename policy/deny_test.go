@@ -0,0 +1,299 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+func TestParseDeny(t *testing.T) {
+	single := []byte(`{
+		"name": "policies/cloudresourcemanager.googleapis.com%2Fprojects%2Fdemo/denypolicies/no-delete",
+		"rules": [{
+			"description": "no bucket deletion",
+			"denyRule": {
+				"deniedPrincipals": ["principalSet://goog/public:all"],
+				"exceptionPrincipals": ["principalSet://goog/group/admins@example.com"],
+				"deniedPermissions": ["storage.googleapis.com/buckets.delete"]
+			}
+		}]
+	}`)
+
+	policies, err := ParseDeny(single)
+	if err != nil {
+		t.Fatalf("Failed to parse deny policy: %v", err)
+	}
+
+	if len(policies) != 1 || len(policies[0].Rules) != 1 {
+		t.Fatalf("Expected 1 policy with 1 rule, got %+v", policies)
+	}
+
+	if policies[0].Rules[0].DenyRule.DeniedPermissions[0] != "storage.googleapis.com/buckets.delete" {
+		t.Error("Expected denied permission to be parsed")
+	}
+
+	list := []byte(`{"policies": [{"name": "a", "rules": []}, {"name": "b", "rules": []}]}`)
+	if policies, err := ParseDeny(list); err != nil || len(policies) != 2 {
+		t.Errorf("Expected 2 policies from list response, got %d (%v)", len(policies), err)
+	}
+
+	array := []byte(`[{"name": "a", "rules": []}]`)
+	if policies, err := ParseDeny(array); err != nil || len(policies) != 1 {
+		t.Errorf("Expected 1 policy from array, got %d (%v)", len(policies), err)
+	}
+
+	if _, err := ParseDeny([]byte(`{"bindings": []}`)); err == nil {
+		t.Error("Expected error for allow policy")
+	}
+}
+
+func TestPermissionTranslation(t *testing.T) {
+	tests := []struct {
+		v1 string
+		v2 string
+	}{
+		{"storage.buckets.delete", "storage.googleapis.com/buckets.delete"},
+		{"compute.instances.setMetadata", "compute.googleapis.com/instances.setMetadata"},
+		{"iam.serviceAccounts.actAs", "iam.googleapis.com/serviceAccounts.actAs"},
+	}
+
+	for _, tt := range tests {
+		v2, err := PermissionToV2(tt.v1)
+		if err != nil || v2 != tt.v2 {
+			t.Errorf("PermissionToV2(%s) = %s (%v), expected %s", tt.v1, v2, err, tt.v2)
+		}
+
+		v1, err := PermissionToV1(tt.v2)
+		if err != nil || v1 != tt.v1 {
+			t.Errorf("PermissionToV1(%s) = %s (%v), expected %s", tt.v2, v1, err, tt.v1)
+		}
+	}
+
+	for _, invalid := range []string{"storage", "storage.buckets.delete", "example.com/buckets.delete", ".googleapis.com/x"} {
+		if _, err := PermissionToV1(invalid); err == nil {
+			t.Errorf("Expected error for v2 permission %s", invalid)
+		}
+	}
+
+	if _, err := PermissionToV2("storage"); err == nil {
+		t.Error("Expected error for v1 permission without resource")
+	}
+}
+
+func TestPrincipalTranslation(t *testing.T) {
+	tests := []struct {
+		member    string
+		principal string
+	}{
+		{"allUsers", "principalSet://goog/public:all"},
+		{"user:alice@example.com", "principal://goog/subject/alice@example.com"},
+		{"group:ops@example.com", "principalSet://goog/group/ops@example.com"},
+		{"serviceAccount:app@demo.iam.gserviceaccount.com", "principal://iam.googleapis.com/projects/-/serviceAccounts/app@demo.iam.gserviceaccount.com"},
+	}
+
+	for _, tt := range tests {
+		principal, err := MemberToPrincipal(tt.member)
+		if err != nil || principal != tt.principal {
+			t.Errorf("MemberToPrincipal(%s) = %s (%v), expected %s", tt.member, principal, err, tt.principal)
+		}
+
+		member, err := PrincipalToMember(tt.principal)
+		if err != nil || member != tt.member {
+			t.Errorf("PrincipalToMember(%s) = %s (%v), expected %s", tt.principal, member, err, tt.member)
+		}
+	}
+}
+
+func TestAnalyzeWithDeny(t *testing.T) {
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	policies := []Policy{{
+		Bindings: []Binding{
+			{Role: "roles/storage.objectAdmin", Members: []string{"user:a@example.com", "user:b@example.com", "user:c@example.com"}},
+		},
+	}}
+
+	denies := []DenyPolicy{{
+		Name: "no-delete",
+		Rules: []DenyPolicyRule{
+			{DenyRule: DenyRule{
+				DeniedPrincipals:    []string{"principalSet://goog/public:all"},
+				ExceptionPrincipals: []string{"principal://goog/subject/b@example.com"},
+				DeniedPermissions:   []string{"storage.googleapis.com/objects.*"},
+				// objects.get stays allowed
+				ExceptionPermissions: []string{"storage.googleapis.com/objects.get"},
+			}},
+			{DenyRule: DenyRule{
+				DeniedPrincipals:  []string{"principal://goog/subject/c@example.com"},
+				DeniedPermissions: []string{"storage.googleapis.com/objects.get"},
+				DenialCondition:   &Expr{Expression: `resource.name.startsWith("projects/_/buckets/secret")`},
+			}},
+		},
+	}}
+
+	access, err := analyzer.Analyze(policies, denies, Request{Time: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to analyze policies: %v", err)
+	}
+
+	byMember := make(map[string]MemberAccess)
+	for _, ma := range access {
+		byMember[ma.Member] = ma
+	}
+
+	a := byMember["user:a@example.com"]
+	if len(a.Permissions) != 1 || a.Permissions[0] != "storage.objects.get" {
+		t.Errorf("Expected only storage.objects.get for a, got %v", a.Permissions)
+	}
+	if len(a.Denied) != 1 || a.Denied[0] != "storage.objects.delete" {
+		t.Errorf("Expected storage.objects.delete denied for a, got %v", a.Denied)
+	}
+
+	b := byMember["user:b@example.com"]
+	if len(b.Permissions) != 2 || len(b.Denied) != 0 {
+		t.Errorf("Expected exception principal b to keep all permissions, got %v denied %v", b.Permissions, b.Denied)
+	}
+
+	// The second rule's condition cannot be evaluated without a resource name
+	c := byMember["user:c@example.com"]
+	if len(c.Permissions) != 0 || len(c.Conditional) != 1 || c.Conditional[0] != "storage.objects.get" {
+		t.Errorf("Expected storage.objects.get conditional for c, got %v conditional %v", c.Permissions, c.Conditional)
+	}
+}
+
+func TestDenyWithInvalidPermission(t *testing.T) {
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	policies := []Policy{{
+		Bindings: []Binding{
+			{Role: "roles/storage.objectAdmin", Members: []string{"user:a@example.com"}},
+		},
+	}}
+	denies := []DenyPolicy{{
+		Name: "no-delete",
+		Rules: []DenyPolicyRule{{DenyRule: DenyRule{
+			DeniedPrincipals:  []string{"principal://goog/subject/a@example.com"},
+			DeniedPermissions: []string{"storage.objects.get", "storage.googleapis.com/objects.delete"},
+		}}},
+	}}
+
+	access, err := analyzer.Analyze(policies, denies, Request{Time: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to analyze policies: %v", err)
+	}
+	if len(access) != 1 {
+		t.Fatalf("Expected access for one member, got %d", len(access))
+	}
+
+	// The malformed v1 name is reported, the valid v2 permission is still denied
+	a := access[0]
+	if len(a.Denied) != 1 || a.Denied[0] != "storage.objects.delete" {
+		t.Errorf("Expected storage.objects.delete denied, got %v", a.Denied)
+	}
+	if len(a.Permissions) != 1 || a.Permissions[0] != "storage.objects.get" {
+		t.Errorf("Expected storage.objects.get to stay allowed, got %v", a.Permissions)
+	}
+	if len(a.Denials) != 1 || a.Denials[0].Err == nil || !strings.Contains(a.Denials[0].Err.Error(), "storage.objects.get") {
+		t.Errorf("Expected the denial to report the malformed permission, got %+v", a.Denials)
+	}
+	if !a.Denials[0].Status.Effective() {
+		t.Errorf("Expected the denial to stay in effect, got status %s", a.Denials[0].Status)
+	}
+}
+
+func TestDenyWithUnresolvedPrincipals(t *testing.T) {
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	policies := []Policy{{
+		Bindings: []Binding{
+			{Role: "roles/storage.objectAdmin", Members: []string{"user:a@example.com"}},
+		},
+	}}
+	for _, principal := range []string{
+		"principalSet://goog/cloudIdentityCustomerId/C01234",
+		"principalSet://iam.googleapis.com/locations/global/workforcePools/staff/*",
+		"principalSet://goog/group/admins@example.com",
+	} {
+		denies := []DenyPolicy{{
+			Name: "no-delete",
+			Rules: []DenyPolicyRule{{DenyRule: DenyRule{
+				DeniedPrincipals:  []string{principal},
+				DeniedPermissions: []string{"storage.googleapis.com/objects.delete"},
+			}}},
+		}}
+
+		access, err := analyzer.Analyze(policies, denies, Request{Time: time.Now()})
+		if err != nil {
+			t.Fatalf("Failed to analyze policies: %v", err)
+		}
+		a := access[0]
+
+		// The member may or may not be denied, so the permission is only conditional
+		if len(a.Denials) != 1 || a.Denials[0].Status != ConditionUnknown || a.Denials[0].Err == nil {
+			t.Errorf("%s: expected an unknown denial with an error, got %+v", principal, a.Denials)
+		}
+		if slices.Contains(a.Permissions, "storage.objects.delete") || !slices.Contains(a.Conditional, "storage.objects.delete") {
+			t.Errorf("%s: expected storage.objects.delete to be conditional, got %v and %v", principal, a.Permissions, a.Conditional)
+		}
+	}
+}
+
+func TestEffectiveWithDeny(t *testing.T) {
+	dir := writeTestHierarchy(t)
+	writeFile(t, filepath.Join(dir, "organizations", "123.deny.json"), `{"rules": [{"denyRule": {
+		"deniedPrincipals": ["principalSet://goog/group/sre@example.com"],
+		"deniedPermissions": ["storage.googleapis.com/objects.delete"]
+	}}]}`)
+
+	h, err := LoadHierarchy(filepath.Join(dir, "hierarchy.yaml"), dir)
+	if err != nil {
+		t.Fatalf("Failed to load hierarchy: %v", err)
+	}
+
+	if len(h.Node("organizations/123").DenyPolicies) != 1 {
+		t.Fatal("Expected deny policy to be loaded for organization")
+	}
+
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	access, err := analyzer.Effective(h, "projects/demo", "user:alice@example.com", Request{Time: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to compute effective access: %v", err)
+	}
+
+	if len(access.Denied) != 1 || access.Denied[0] != "storage.objects.delete" {
+		t.Errorf("Expected storage.objects.delete to be denied via group, got %v", access.Denied)
+	}
+}
+
+func TestLoadDeny(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.json")
+	if err := os.WriteFile(path, []byte(`{"rules": []}`), 0644); err != nil {
+		t.Fatalf("Failed to write deny policy: %v", err)
+	}
+
+	if _, err := LoadDeny(path); err != nil {
+		t.Errorf("Failed to load deny policy: %v", err)
+	}
+
+	if _, err := LoadDeny(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
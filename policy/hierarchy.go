@@ -0,0 +1,210 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Hierarchy describes a Google Cloud resource hierarchy (organization, folders, projects, resources)
+// with the IAM policy attached at each node
+type Hierarchy struct {
+	Nodes  []*Node             `yaml:"nodes"`
+	Groups map[string][]string `yaml:"groups"`
+
+	index map[string]*Node
+}
+
+// Node is a resource in the hierarchy
+type Node struct {
+	Name         string       `yaml:"name"`
+	Parent       string       `yaml:"parent"`
+	Type         string       `yaml:"type"`
+	Policy       string       `yaml:"policy"`
+	Deny         string       `yaml:"deny"`
+	Policies     []Policy     `yaml:"-"`
+	DenyPolicies []DenyPolicy `yaml:"-"`
+}
+
+// LoadHierarchy reads a hierarchy description and the policy of every node from policyDir.
+// A node's policy is read from its `policy` file if set, otherwise from `<policyDir>/<name>.json`
+// (e.g. policies/projects/demo.json) or `<policyDir>/<name with / replaced by _>.json` if present.
+// Deny policies are read the same way from the `deny` file or `<name>.deny.json`.
+func LoadHierarchy(path, policyDir string) (*Hierarchy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hierarchy file: %w", err)
+	}
+
+	var h Hierarchy
+	if err := yaml.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to parse hierarchy file: %w", err)
+	}
+
+	if policyDir == "" {
+		policyDir = filepath.Dir(path)
+	}
+
+	if err := h.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	for _, node := range h.Nodes {
+		file, err := node.policyFile(policyDir, node.Policy, ".json")
+		if err != nil {
+			return nil, err
+		}
+		if file != "" {
+			policies, err := Load(file)
+			if err != nil {
+				return nil, fmt.Errorf("node '%s': %w", node.Name, err)
+			}
+			for i := range policies {
+				if policies[i].Resource == "" {
+					policies[i].Resource = node.Name
+				}
+			}
+			node.Policies = policies
+		}
+
+		file, err = node.policyFile(policyDir, node.Deny, ".deny.json")
+		if err != nil {
+			return nil, err
+		}
+		if file != "" {
+			denies, err := LoadDeny(file)
+			if err != nil {
+				return nil, fmt.Errorf("node '%s': %w", node.Name, err)
+			}
+			for i := range denies {
+				denies[i].Resource = node.Name
+			}
+			node.DenyPolicies = denies
+		}
+	}
+
+	return &h, nil
+}
+
+// Node returns the node with the given name, or nil if it does not exist
+func (h *Hierarchy) Node(name string) *Node {
+	return h.index[name]
+}
+
+// Ancestors returns the node and all its ancestors, starting with the node itself
+func (h *Hierarchy) Ancestors(name string) ([]*Node, error) {
+	var chain []*Node
+	for current := name; current != ""; {
+		node := h.index[current]
+		if node == nil {
+			if len(chain) == 0 {
+				return nil, fmt.Errorf("resource '%s' not found in hierarchy", name)
+			}
+			return nil, fmt.Errorf("parent '%s' of '%s' not found in hierarchy", current, chain[len(chain)-1].Name)
+		}
+		if slices.Contains(chain, node) {
+			return nil, fmt.Errorf("cycle in hierarchy at '%s'", current)
+		}
+		chain = append(chain, node)
+		current = node.Parent
+	}
+	return chain, nil
+}
+
+// MemberMatches reports whether a policy binding member applies to the given principal,
+// expanding allUsers, allAuthenticatedUsers, domain: members and the hierarchy's group memberships
+func (h *Hierarchy) MemberMatches(bindingMember, member string) bool {
+	if bindingMember == member {
+		return true
+	}
+
+	switch {
+	case strings.HasPrefix(bindingMember, "deleted:"):
+		return false
+	case bindingMember == "allUsers":
+		return true
+	case bindingMember == "allAuthenticatedUsers":
+		return member != "allUsers"
+	case strings.HasPrefix(bindingMember, "domain:"):
+		domain := strings.TrimPrefix(bindingMember, "domain:")
+		if kind, email, ok := strings.Cut(member, ":"); ok && (kind == "user" || kind == "group") {
+			return strings.HasSuffix(email, "@"+domain)
+		}
+		return false
+	case strings.HasPrefix(bindingMember, "group:"):
+		return h != nil && h.inGroup(bindingMember, member, nil)
+	}
+
+	return false
+}
+
+// declaresGroup reports whether the hierarchy's groups section lists the members of group
+func (h *Hierarchy) declaresGroup(group string) bool {
+	if h == nil {
+		return false
+	}
+	_, ok := h.Groups[group]
+	return ok
+}
+
+// inGroup resolves nested group memberships declared in the hierarchy's groups section
+func (h *Hierarchy) inGroup(group, member string, visited []string) bool {
+	if slices.Contains(visited, group) {
+		return false
+	}
+	visited = append(visited, group)
+
+	for _, m := range h.Groups[group] {
+		if m == member {
+			return true
+		}
+		if strings.HasPrefix(m, "group:") && h.inGroup(m, member, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hierarchy) buildIndex() error {
+	h.index = make(map[string]*Node, len(h.Nodes))
+	for _, node := range h.Nodes {
+		if node.Name == "" {
+			return errors.New("hierarchy node without name")
+		}
+		if _, ok := h.index[node.Name]; ok {
+			return fmt.Errorf("duplicate hierarchy node '%s'", node.Name)
+		}
+		h.index[node.Name] = node
+	}
+	return nil
+}
+
+// policyFile returns the configured policy file, or the first existing default file
+// named after the node with the given extension. It returns "" if there is none.
+func (n *Node) policyFile(policyDir, configured, ext string) (string, error) {
+	if configured != "" {
+		if filepath.IsAbs(configured) {
+			return configured, nil
+		}
+		return filepath.Join(policyDir, configured), nil
+	}
+
+	candidates := []string{
+		filepath.Join(policyDir, filepath.FromSlash(n.Name)+ext),
+		filepath.Join(policyDir, strings.ReplaceAll(n.Name, "/", "_")+ext),
+	}
+	for _, file := range candidates {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("node '%s': %w", n.Name, err)
+		}
+	}
+
+	return "", nil
+}
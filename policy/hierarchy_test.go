@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func writeTestHierarchy(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "hierarchy.yaml"), `
+nodes:
+  - name: organizations/123
+  - name: folders/456
+    parent: organizations/123
+  - name: projects/demo
+    parent: folders/456
+    type: cloudresourcemanager.googleapis.com/Project
+    policy: demo-policy.json
+  - name: projects/other
+    parent: organizations/123
+groups:
+  group:ops@example.com: [group:sre@example.com]
+  group:sre@example.com: [user:alice@example.com]
+`)
+	writeFile(t, filepath.Join(dir, "organizations", "123.json"),
+		`{"bindings": [{"role": "roles/compute.viewer", "members": ["domain:example.com"]}]}`)
+	writeFile(t, filepath.Join(dir, "folders_456.json"),
+		`{"bindings": [{"role": "roles/storage.objectViewer", "members": ["group:ops@example.com"]}]}`)
+	writeFile(t, filepath.Join(dir, "demo-policy.json"), `{"bindings": [
+		{"role": "roles/storage.objectAdmin", "members": ["user:alice@example.com"],
+		 "condition": {"title": "demo only", "expression": "resource.name == \"projects/demo\""}}
+	]}`)
+
+	return dir
+}
+
+func TestLoadHierarchy(t *testing.T) {
+	dir := writeTestHierarchy(t)
+
+	h, err := LoadHierarchy(filepath.Join(dir, "hierarchy.yaml"), "")
+	if err != nil {
+		t.Fatalf("Failed to load hierarchy: %v", err)
+	}
+
+	tests := map[string]int{
+		"organizations/123": 1,
+		"folders/456":       1,
+		"projects/demo":     1,
+		"projects/other":    0,
+	}
+	for name, expected := range tests {
+		node := h.Node(name)
+		if node == nil {
+			t.Fatalf("Expected node %s", name)
+		}
+		if len(node.Policies) != expected {
+			t.Errorf("Expected %d policies on %s, got %d", expected, name, len(node.Policies))
+		}
+	}
+
+	chain, err := h.Ancestors("projects/demo")
+	if err != nil {
+		t.Fatalf("Failed to get ancestors: %v", err)
+	}
+	if len(chain) != 3 || chain[2].Name != "organizations/123" {
+		t.Errorf("Expected chain to end at organization, got %d nodes", len(chain))
+	}
+
+	if _, err := h.Ancestors("projects/missing"); err == nil {
+		t.Error("Expected error for unknown resource")
+	}
+}
+
+func TestHierarchyCycle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hierarchy.yaml")
+	writeFile(t, path, `
+nodes:
+  - name: folders/1
+    parent: folders/2
+  - name: folders/2
+    parent: folders/1
+`)
+
+	h, err := LoadHierarchy(path, dir)
+	if err != nil {
+		t.Fatalf("Failed to load hierarchy: %v", err)
+	}
+
+	if _, err := h.Ancestors("folders/1"); err == nil {
+		t.Error("Expected error for cyclic hierarchy")
+	}
+}
+
+func TestMemberMatches(t *testing.T) {
+	h := &Hierarchy{Groups: map[string][]string{
+		"group:ops@example.com": {"group:sre@example.com"},
+		"group:sre@example.com": {"user:alice@example.com", "group:ops@example.com"},
+	}}
+
+	tests := []struct {
+		binding  string
+		member   string
+		expected bool
+	}{
+		{"user:alice@example.com", "user:alice@example.com", true},
+		{"user:bob@example.com", "user:alice@example.com", false},
+		{"allUsers", "user:alice@example.com", true},
+		{"allAuthenticatedUsers", "serviceAccount:app@demo.iam.gserviceaccount.com", true},
+		{"domain:example.com", "user:alice@example.com", true},
+		{"domain:example.com", "user:alice@example.org", false},
+		{"group:ops@example.com", "user:alice@example.com", true},
+		{"group:ops@example.com", "user:bob@example.com", false},
+		{"deleted:user:alice@example.com?uid=1", "user:alice@example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := h.MemberMatches(tt.binding, tt.member); got != tt.expected {
+			t.Errorf("MemberMatches(%s, %s) = %v, expected %v", tt.binding, tt.member, got, tt.expected)
+		}
+	}
+}
+
+func TestEffective(t *testing.T) {
+	dir := writeTestHierarchy(t)
+
+	h, err := LoadHierarchy(filepath.Join(dir, "hierarchy.yaml"), dir)
+	if err != nil {
+		t.Fatalf("Failed to load hierarchy: %v", err)
+	}
+
+	analyzer, err := NewAnalyzer(dbtest.New(t, testGrants))
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+
+	req := Request{Time: time.Now()}
+
+	access, err := analyzer.Effective(h, "projects/demo", "user:alice@example.com", req)
+	if err != nil {
+		t.Fatalf("Failed to compute effective access: %v", err)
+	}
+
+	if len(access.Grants) != 3 {
+		t.Fatalf("Expected 3 grants (direct, folder via group, org via domain), got %d", len(access.Grants))
+	}
+
+	expected := []string{"compute.instances.get", "storage.objects.delete", "storage.objects.get", "storage.objects.list"}
+	if len(access.Permissions) != len(expected) {
+		t.Fatalf("Expected permissions %v, got %v", expected, access.Permissions)
+	}
+
+	// The project-level policy is not inherited by a sibling project
+	access, err = analyzer.Effective(h, "projects/other", "user:alice@example.com", req)
+	if err != nil {
+		t.Fatalf("Failed to compute effective access: %v", err)
+	}
+
+	if len(access.Permissions) != 1 || access.Permissions[0] != "compute.instances.get" {
+		t.Errorf("Expected only organization permissions, got %v", access.Permissions)
+	}
+}
@@ -0,0 +1,258 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/internal/constants"
+)
+
+// Policy is a Google Cloud IAM allow policy as exported by
+// `gcloud <resource> get-iam-policy --format=json`
+type Policy struct {
+	Resource string    `json:"resource,omitempty"`
+	Version  int       `json:"version,omitempty"`
+	Etag     string    `json:"etag,omitempty"`
+	Bindings []Binding `json:"bindings"`
+}
+
+// Binding grants a role to a list of members, optionally under a condition
+type Binding struct {
+	Role      string   `json:"role"`
+	Members   []string `json:"members"`
+	Condition *Expr    `json:"condition,omitempty"`
+}
+
+// Expr is an IAM condition expressed in Common Expression Language (CEL)
+type Expr struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Expression  string `json:"expression"`
+}
+
+// ErrUnrecognizedFormat is returned for JSON that is neither an IAM policy nor a Terraform plan
+var ErrUnrecognizedFormat = errors.New("unrecognized format: expected IAM policy or Terraform plan JSON")
+
+// Load reads an IAM policy file or a Terraform plan JSON file and returns the policies it contains
+func Load(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policies, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return policies, nil
+}
+
+// Parse decodes an IAM policy, a `{"resource": ..., "policy": ...}` wrapper
+// as produced by Cloud Asset Inventory, or a Terraform plan (`terraform show -json`)
+func Parse(data []byte) ([]Policy, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch {
+	case probe["resource_changes"] != nil || probe["planned_values"] != nil:
+		return parsePlan(data)
+	case probe["policy"] != nil:
+		var wrapper struct {
+			Resource string `json:"resource"`
+			Policy   Policy `json:"policy"`
+		}
+		if err := json.Unmarshal(data, &wrapper); err != nil {
+			return nil, fmt.Errorf("invalid policy: %w", err)
+		}
+		wrapper.Policy.Resource = wrapper.Resource
+		return []Policy{wrapper.Policy}, nil
+	case probe["bindings"] != nil || probe["etag"] != nil:
+		var p Policy
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("invalid policy: %w", err)
+		}
+		return []Policy{p}, nil
+	}
+
+	return nil, ErrUnrecognizedFormat
+}
+
+// RoleName strips the "roles/" prefix from predefined role names.
+// The boolean result is false for custom roles (projects/*/roles/*, organizations/*/roles/*).
+func RoleName(role string) (string, bool) {
+	if after, ok := strings.CutPrefix(role, constants.RolePrefix); ok {
+		return after, true
+	}
+	if strings.Contains(role, "/") {
+		return role, false
+	}
+	return role, true
+}
+
+// Members returns the sorted list of unique members across all bindings
+func (p *Policy) Members() []string {
+	seen := make(map[string]bool)
+	var members []string
+	for _, b := range p.Bindings {
+		for _, m := range b.Members {
+			if !seen[m] {
+				seen[m] = true
+				members = append(members, m)
+			}
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// parsePlan extracts IAM bindings from google_*_iam_{policy,binding,member} resources of a Terraform plan
+func parsePlan(data []byte) ([]Policy, error) {
+	var plan struct {
+		PlannedValues struct {
+			RootModule planModule `json:"root_module"`
+		} `json:"planned_values"`
+	}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid Terraform plan: %w", err)
+	}
+
+	var policies []Policy
+	var walk func(m planModule) error
+	walk = func(m planModule) error {
+		for _, r := range m.Resources {
+			p, ok, err := planResourcePolicy(r)
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.Address, err)
+			}
+			if ok {
+				policies = append(policies, p)
+			}
+		}
+		for _, child := range m.ChildModules {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(plan.PlannedValues.RootModule); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+type planModule struct {
+	Resources    []planResource `json:"resources"`
+	ChildModules []planModule   `json:"child_modules"`
+}
+
+type planResource struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Values  struct {
+		Role       string   `json:"role"`
+		Member     string   `json:"member"`
+		Members    []string `json:"members"`
+		PolicyData string   `json:"policy_data"`
+		Condition  []Expr   `json:"condition"`
+	} `json:"values"`
+}
+
+func planResourcePolicy(r planResource) (Policy, bool, error) {
+	if !strings.HasPrefix(r.Type, "google_") {
+		return Policy{}, false, nil
+	}
+
+	p := Policy{Resource: r.Address}
+	var condition *Expr
+	if len(r.Values.Condition) > 0 {
+		condition = &r.Values.Condition[0]
+	}
+
+	switch {
+	case strings.HasSuffix(r.Type, "_iam_member"):
+		p.Bindings = []Binding{{Role: r.Values.Role, Members: []string{r.Values.Member}, Condition: condition}}
+	case strings.HasSuffix(r.Type, "_iam_binding"):
+		p.Bindings = []Binding{{Role: r.Values.Role, Members: r.Values.Members, Condition: condition}}
+	case strings.HasSuffix(r.Type, "_iam_policy"):
+		if r.Values.PolicyData == "" {
+			return Policy{}, false, nil
+		}
+		if err := json.Unmarshal([]byte(r.Values.PolicyData), &p); err != nil {
+			return Policy{}, false, fmt.Errorf("invalid policy_data: %w", err)
+		}
+		p.Resource = r.Address
+	default:
+		return Policy{}, false, nil
+	}
+
+	return p, true, nil
+}
+
+// skipDirs are directories of dependencies that never hold exported policies
+var skipDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// LoadDir loads all policy files (*.json) below dir, skipping deny policies (*.deny.json)
+// as well as hidden, node_modules and vendor directories. Policies without a resource
+// name are named after their file path relative to dir, e.g. projects/demo.json becomes
+// projects/demo. JSON files that are not IAM policies, such as package.json, are skipped
+// and returned as warnings.
+func LoadDir(dir string) ([]Policy, []error, error) {
+	var policies []Policy
+	var warnings []error
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(d.Name(), ".") || skipDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" || strings.HasSuffix(path, ".deny.json") {
+			return nil
+		}
+
+		loaded, err := Load(path)
+		var syntaxErr *json.SyntaxError
+		if errors.Is(err, ErrUnrecognizedFormat) || errors.As(err, &syntaxErr) {
+			warnings = append(warnings, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		resource := filepath.ToSlash(strings.TrimSuffix(rel, ".json"))
+
+		for i := range loaded {
+			if loaded[i].Resource == "" {
+				loaded[i].Resource = resource
+			}
+		}
+		policies = append(policies, loaded...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load policies from %s: %w", dir, err)
+	}
+
+	return policies, warnings, nil
+}
@@ -0,0 +1,216 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	data := []byte(`{
+		"version": 3,
+		"etag": "BwXyz",
+		"bindings": [
+			{"role": "roles/storage.objectViewer", "members": ["allUsers", "user:a@example.com"]},
+			{
+				"role": "roles/editor",
+				"members": ["user:b@example.com"],
+				"condition": {"title": "expires", "expression": "request.time < timestamp('2030-01-01T00:00:00Z')"}
+			}
+		]
+	}`)
+
+	policies, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+
+	p := policies[0]
+	if len(p.Bindings) != 2 {
+		t.Fatalf("Expected 2 bindings, got %d", len(p.Bindings))
+	}
+
+	if p.Bindings[1].Condition == nil || p.Bindings[1].Condition.Title != "expires" {
+		t.Error("Expected condition to be parsed on second binding")
+	}
+
+	members := p.Members()
+	if len(members) != 3 {
+		t.Errorf("Expected 3 unique members, got %d", len(members))
+	}
+}
+
+func TestParseAssetWrapper(t *testing.T) {
+	data := []byte(`{
+		"resource": "//cloudresourcemanager.googleapis.com/projects/demo",
+		"policy": {"bindings": [{"role": "roles/viewer", "members": ["group:ops@example.com"]}]}
+	}`)
+
+	policies, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+
+	if policies[0].Resource != "//cloudresourcemanager.googleapis.com/projects/demo" {
+		t.Errorf("Expected resource to be set, got '%s'", policies[0].Resource)
+	}
+}
+
+func TestParseTerraformPlan(t *testing.T) {
+	data := []byte(`{
+		"format_version": "1.2",
+		"planned_values": {
+			"root_module": {
+				"resources": [
+					{
+						"address": "google_project_iam_member.viewer",
+						"type": "google_project_iam_member",
+						"values": {"role": "roles/viewer", "member": "user:a@example.com", "condition": []}
+					},
+					{
+						"address": "google_storage_bucket.data",
+						"type": "google_storage_bucket",
+						"values": {"name": "data"}
+					}
+				],
+				"child_modules": [
+					{
+						"resources": [
+							{
+								"address": "module.iam.google_project_iam_binding.admins",
+								"type": "google_project_iam_binding",
+								"values": {"role": "roles/owner", "members": ["user:b@example.com", "user:c@example.com"]}
+							},
+							{
+								"address": "module.iam.google_project_iam_policy.project",
+								"type": "google_project_iam_policy",
+								"values": {"policy_data": "{\"bindings\":[{\"role\":\"roles/editor\",\"members\":[\"allUsers\"]}]}"}
+							}
+						]
+					}
+				]
+			}
+		}
+	}`)
+
+	policies, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Failed to parse plan: %v", err)
+	}
+
+	if len(policies) != 3 {
+		t.Fatalf("Expected 3 policies, got %d", len(policies))
+	}
+
+	if policies[1].Resource != "module.iam.google_project_iam_binding.admins" {
+		t.Errorf("Expected resource address, got '%s'", policies[1].Resource)
+	}
+
+	if len(policies[1].Bindings[0].Members) != 2 {
+		t.Errorf("Expected 2 members in binding, got %d", len(policies[1].Bindings[0].Members))
+	}
+
+	if policies[2].Bindings[0].Role != "roles/editor" {
+		t.Errorf("Expected policy_data to be decoded, got role '%s'", policies[2].Bindings[0].Role)
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	if _, err := Parse([]byte(`{"foo": "bar"}`)); err == nil {
+		t.Error("Expected error for unrecognized format")
+	}
+
+	if _, err := Parse([]byte(`not json`)); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(`{"bindings": [{"role": "roles/viewer", "members": ["user:a@example.com"]}]}`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+
+	policies, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+
+	if len(policies) != 1 || policies[0].Bindings[0].Role != "roles/viewer" {
+		t.Error("Expected policy to be loaded from file")
+	}
+}
+
+func TestRoleName(t *testing.T) {
+	tests := []struct {
+		role       string
+		name       string
+		predefined bool
+	}{
+		{"roles/viewer", "viewer", true},
+		{"storage.admin", "storage.admin", true},
+		{"projects/demo/roles/custom", "projects/demo/roles/custom", false},
+		{"organizations/123/roles/custom", "organizations/123/roles/custom", false},
+	}
+
+	for _, tt := range tests {
+		name, predefined := RoleName(tt.role)
+		if name != tt.name || predefined != tt.predefined {
+			t.Errorf("RoleName(%q) = (%q, %v), expected (%q, %v)", tt.role, name, predefined, tt.name, tt.predefined)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"projects/demo.json":      `{"bindings": [{"role": "roles/viewer", "members": ["user:a@example.com"]}]}`,
+		"projects/demo.deny.json": `{"rules": []}`,
+		"asset.json":              `{"resource": "//storage.googleapis.com/projects/_/buckets/logs", "policy": {"bindings": []}}`,
+		"notes.txt":               `not a policy`,
+		"package.json":            `{"name": "demo", "version": "1.0.0"}`,
+		"tsconfig.json": `{ // comments are not JSON
+			"compilerOptions": {}}`,
+		"node_modules/x/a.json": `{"bindings": [{"role": "roles/owner", "members": ["allUsers"]}]}`,
+		".terraform/state.json": `{"bindings": [{"role": "roles/owner", "members": ["allUsers"]}]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	policies, warnings, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to load policies: %v", err)
+	}
+
+	// package.json and tsconfig.json are skipped, node_modules and .terraform not searched
+	if len(warnings) != 2 {
+		t.Errorf("Expected 2 skipped files, got %v", warnings)
+	}
+
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %d", len(policies))
+	}
+
+	resources := map[string]bool{}
+	for _, p := range policies {
+		resources[p.Resource] = true
+	}
+
+	for _, expected := range []string{"projects/demo", "//storage.googleapis.com/projects/_/buckets/logs"} {
+		if !resources[expected] {
+			t.Errorf("Expected policy for resource %s, got %v", expected, resources)
+		}
+	}
+}
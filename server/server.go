@@ -0,0 +1,387 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kborovik/gcp-iam/compare"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/constants"
+	"github.com/kborovik/gcp-iam/solver"
+)
+
+// APIVersion is the path prefix of the current REST API version
+const APIVersion = "/v1"
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	shutdownTimeout = 5 * time.Second
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// webFS holds the single page web UI served at the root path
+//
+//go:embed web
+var webFS embed.FS
+
+// Server exposes the local IAM database as a read-only REST JSON API
+type Server struct {
+	db      *db.DB
+	version string
+	mux     *http.ServeMux
+}
+
+// New creates a Server backed by the provided database connection
+func New(database *db.DB, version string) *Server {
+	s := &Server{
+		db:      database,
+		version: version,
+		mux:     http.NewServeMux(),
+	}
+	s.routes()
+	return s
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled, then shuts down gracefully
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("GET "+APIVersion+"/openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("GET "+APIVersion+"/roles", s.handleSearchRoles)
+	s.mux.HandleFunc("GET "+APIVersion+"/roles/{name}", s.handleGetRole)
+	s.mux.HandleFunc("GET "+APIVersion+"/roles/{name}/permissions", s.handleRolePermissions)
+	s.mux.HandleFunc("GET "+APIVersion+"/permissions", s.handleSearchPermissions)
+	s.mux.HandleFunc("GET "+APIVersion+"/permissions/{name}", s.handleGetPermission)
+	s.mux.HandleFunc("GET "+APIVersion+"/services", s.handleSearchServices)
+	s.mux.HandleFunc("GET "+APIVersion+"/services/{name}", s.handleGetService)
+	s.mux.HandleFunc("GET "+APIVersion+"/compare", s.handleCompare)
+	s.mux.HandleFunc("GET "+APIVersion+"/solve", s.handleSolve)
+	s.mux.HandleFunc("GET "+APIVersion+"/", func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	})
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, map[string]string{"status": "ok", "version": s.version})
+	})
+
+	web, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(err)
+	}
+	s.mux.Handle("GET /", http.FileServerFS(web))
+}
+
+// =============================================================================
+// HANDLERS
+// =============================================================================
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	s.writeBody(w, r, "application/json", openAPISpec)
+}
+
+func (s *Server) handleSearchRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.db.SearchRolesContext(r.Context(), r.URL.Query().Get("q"))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to search roles: %v", err)
+		return
+	}
+	writePage(s, w, r, "roles", roles)
+}
+
+func (s *Server) handleGetRole(w http.ResponseWriter, r *http.Request) {
+	role, ok := s.lookupRole(r.Context(), w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+
+	permissions, err := s.db.GetRolePermissionNamesContext(r.Context(), role.Name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get permissions for role '%s': %v", role.Name, err)
+		return
+	}
+
+	s.writeJSON(w, r, map[string]any{
+		"role":        role,
+		"permissions": permissions,
+	})
+}
+
+func (s *Server) handleRolePermissions(w http.ResponseWriter, r *http.Request) {
+	role, ok := s.lookupRole(r.Context(), w, r.PathValue("name"))
+	if !ok {
+		return
+	}
+
+	permissions, err := s.db.GetRolePermissionNamesContext(r.Context(), role.Name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get permissions for role '%s': %v", role.Name, err)
+		return
+	}
+	writePage(s, w, r, "permissions", permissions)
+}
+
+func (s *Server) handleSearchPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := s.db.SearchPermissionsContext(r.Context(), r.URL.Query().Get("q"))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to search permissions: %v", err)
+		return
+	}
+
+	names := make([]string, 0, len(permissions))
+	for _, perm := range permissions {
+		names = append(names, perm.Permission)
+	}
+	writePage(s, w, r, "permissions", names)
+}
+
+func (s *Server) handleGetPermission(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	permission, err := s.db.GetPermissionByNameContext(r.Context(), name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get permission: %v", err)
+		return
+	}
+	if permission == nil {
+		s.writeError(w, http.StatusNotFound, "permission '%s' not found", name)
+		return
+	}
+
+	roles, err := s.db.GetRolesWithPermissionContext(r.Context(), name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get roles with permission: %v", err)
+		return
+	}
+
+	s.writeJSON(w, r, map[string]any{
+		"permission": name,
+		"roles":      roles,
+	})
+}
+
+func (s *Server) handleSearchServices(w http.ResponseWriter, r *http.Request) {
+	services, err := s.db.SearchServicesContext(r.Context(), r.URL.Query().Get("q"))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to search services: %v", err)
+		return
+	}
+	writePage(s, w, r, "services", services)
+}
+
+func (s *Server) handleGetService(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	service, err := s.db.GetServiceByNameContext(r.Context(), name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get service: %v", err)
+		return
+	}
+	if service == nil {
+		s.writeError(w, http.StatusNotFound, "service '%s' not found", name)
+		return
+	}
+	s.writeJSON(w, r, service)
+}
+
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	names := queryList(r, "role")
+	if len(names) < 2 {
+		s.writeError(w, http.StatusBadRequest, "at least 2 roles are required (role=a&role=b)")
+		return
+	}
+
+	roles := make([]compare.RolePermissions, 0, len(names))
+	for _, name := range names {
+		role, ok := s.lookupRole(r.Context(), w, name)
+		if !ok {
+			return
+		}
+		permissions, err := s.db.GetRolePermissionNamesContext(r.Context(), role.Name)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to get permissions for role '%s': %v", role.Name, err)
+			return
+		}
+		roles = append(roles, compare.RolePermissions{Role: role.Name, Permissions: permissions})
+	}
+
+	s.writeJSON(w, r, compare.Compare(roles))
+}
+
+func (s *Server) handleSolve(w http.ResponseWriter, r *http.Request) {
+	permissions := queryList(r, "permission")
+	if len(permissions) == 0 {
+		s.writeError(w, http.StatusBadRequest, "at least 1 permission is required (permission=a&permission=b)")
+		return
+	}
+
+	result, err := solver.MinimalRoles(r.Context(), s.db, permissions)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to solve: %v", err)
+		return
+	}
+	s.writeJSON(w, r, result)
+}
+
+// =============================================================================
+// HELPERS
+// =============================================================================
+
+// lookupRole fetches a role by name, writing a 404 or 500 response if it cannot be returned
+func (s *Server) lookupRole(ctx context.Context, w http.ResponseWriter, name string) (*db.Role, bool) {
+	name = strings.TrimPrefix(name, constants.RolePrefix)
+	role, err := s.db.GetRoleByNameContext(ctx, name)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get role '%s': %v", name, err)
+		return nil, false
+	}
+	if role == nil {
+		s.writeError(w, http.StatusNotFound, "role '%s' not found", name)
+		return nil, false
+	}
+	return role, true
+}
+
+// queryList returns the values of a repeated or comma separated query parameter
+func queryList(r *http.Request, key string) []string {
+	var values []string
+	for _, value := range r.URL.Query()[key] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// writePage writes one page of items using page_size and page_token query parameters.
+// Page tokens are opaque to clients and encode the offset of the next item.
+func writePage[T any](s *Server, w http.ResponseWriter, r *http.Request, key string, items []T) {
+	pageSize := defaultPageSize
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid page_size '%s'", value)
+			return
+		}
+		pageSize = min(size, maxPageSize)
+	}
+
+	offset := 0
+	if token := r.URL.Query().Get("page_token"); token != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err == nil {
+			offset, err = strconv.Atoi(string(decoded))
+		}
+		if err != nil || offset < 0 || offset > len(items) {
+			s.writeError(w, http.StatusBadRequest, "invalid page_token")
+			return
+		}
+	}
+
+	end := min(offset+pageSize, len(items))
+	page := items[offset:end]
+	if page == nil {
+		page = []T{}
+	}
+
+	nextToken := ""
+	if end < len(items) {
+		nextToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+
+	s.writeJSON(w, r, map[string]any{
+		key:               page,
+		"next_page_token": nextToken,
+		"total_size":      len(items),
+	})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to encode response: %v", err)
+		return
+	}
+	s.writeBody(w, r, "application/json", append(body, '\n'))
+}
+
+// writeBody writes a response with a content-based ETag, answering 304 Not Modified
+// when the client already has the current representation
+func (s *Server) writeBody(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(body); err != nil && !errors.Is(err, http.ErrHandlerTimeout) {
+		log.Printf("Warning: failed to write response: %v", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    status,
+			"message": fmt.Sprintf(format, args...),
+		},
+	})
+}
+
+// etagMatches checks an If-None-Match header value, which may list several ETags or "*"
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
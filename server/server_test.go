@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	database := dbtest.New(t, map[string][]string{
+		"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+		"storage.objectAdmin":  {"storage.objects.get", "storage.objects.delete"},
+		"compute.viewer":       {"compute.instances.get"},
+	})
+	if err := database.InsertService(&db.Service{Name: "storage.googleapis.com", Title: "Cloud Storage"}); err != nil {
+		t.Fatalf("Failed to insert service: %v", err)
+	}
+
+	return New(database, "test")
+}
+
+func get(t *testing.T, s *Server, path string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+func TestGetRole(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(t, s, "/v1/roles/roles%2Fstorage.objectViewer", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Role        db.Role  `json:"role"`
+		Permissions []string `json:"permissions"`
+	}
+	decode(t, rec, &body)
+
+	if body.Role.Name != "storage.objectViewer" {
+		t.Errorf("Expected role storage.objectViewer, got %s", body.Role.Name)
+	}
+	if len(body.Permissions) != 2 {
+		t.Errorf("Expected 2 permissions, got %v", body.Permissions)
+	}
+
+	rec = get(t, s, "/v1/roles/missing", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown role, got %d", rec.Code)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s := newTestServer(t)
+
+	var names []string
+	path := "/v1/roles?page_size=2"
+	for range 5 {
+		rec := get(t, s, path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var page struct {
+			Roles         []db.Role `json:"roles"`
+			NextPageToken string    `json:"next_page_token"`
+			TotalSize     int       `json:"total_size"`
+		}
+		decode(t, rec, &page)
+
+		if page.TotalSize != 3 {
+			t.Errorf("Expected total_size 3, got %d", page.TotalSize)
+		}
+		for _, role := range page.Roles {
+			names = append(names, role.Name)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		path = "/v1/roles?page_size=2&page_token=" + page.NextPageToken
+	}
+
+	if len(names) != 3 {
+		t.Errorf("Expected 3 roles across pages, got %v", names)
+	}
+
+	for _, query := range []string{"page_size=0", "page_size=abc", "page_token=!!"} {
+		if rec := get(t, s, "/v1/roles?"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(t, s, "/v1/services/storage.googleapis.com", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with ETag, got %d and %q", rec.Code, etag)
+	}
+
+	rec = get(t, s, "/v1/services/storage.googleapis.com", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected empty body for 304, got %q", rec.Body.String())
+	}
+
+	rec = get(t, s, "/v1/services/storage.googleapis.com", http.Header{"If-None-Match": {`"stale"`}})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for stale ETag, got %d", rec.Code)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(t, s, "/v1/compare?role=storage.objectViewer&role=storage.objectAdmin", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Common []string            `json:"common"`
+		Unique map[string][]string `json:"unique"`
+	}
+	decode(t, rec, &body)
+
+	if len(body.Common) != 1 || body.Common[0] != "storage.objects.get" {
+		t.Errorf("Expected common [storage.objects.get], got %v", body.Common)
+	}
+	if len(body.Unique["storage.objectAdmin"]) != 1 {
+		t.Errorf("Expected 1 unique permission for storage.objectAdmin, got %v", body.Unique)
+	}
+
+	if rec := get(t, s, "/v1/compare?role=storage.objectViewer", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for single role, got %d", rec.Code)
+	}
+}
+
+func TestSolve(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(t, s, "/v1/solve?permission=storage.objects.get,storage.objects.list&permission=unknown.thing.do", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Roles []struct {
+			Role db.Role `json:"role"`
+		} `json:"roles"`
+		Uncovered []string `json:"uncovered"`
+	}
+	decode(t, rec, &body)
+
+	if len(body.Roles) != 1 || body.Roles[0].Role.Name != "storage.objectViewer" {
+		t.Errorf("Expected storage.objectViewer, got %+v", body.Roles)
+	}
+	if len(body.Uncovered) != 1 || body.Uncovered[0] != "unknown.thing.do" {
+		t.Errorf("Expected unknown.thing.do to be uncovered, got %v", body.Uncovered)
+	}
+
+	// Fully covered and fully uncovered requests still send arrays
+	for _, query := range []string{"permission=storage.objects.get", "permission=unknown.thing.do"} {
+		rec := get(t, s, "/v1/solve?"+query, nil)
+		if body := rec.Body.String(); strings.Contains(body, "null") {
+			t.Errorf("Expected arrays instead of null for %s, got %s", query, body)
+		}
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(t, s, "/v1/permissions/unknown.thing.do", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", rec.Code)
+	}
+
+	var body struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	decode(t, rec, &body)
+
+	if body.Error.Code != http.StatusNotFound || body.Error.Message == "" {
+		t.Errorf("Expected structured error, got %s", rec.Body.String())
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(t, s, "/v1/openapi.json", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var spec map[string]any
+	decode(t, rec, &spec)
+
+	if spec["openapi"] == nil || spec["paths"] == nil {
+		t.Error("Expected OpenAPI document with paths")
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, path := range []string{"/", "/app.js", "/style.css"} {
+		rec := get(t, s, path, nil)
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("Expected %s to be served, got %d", path, rec.Code)
+		}
+	}
+
+	rec := get(t, s, "/v1/unknown", nil)
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON 404 for unknown API path, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
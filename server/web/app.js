@@ -0,0 +1,236 @@
+// Single page UI for the gcp-iam REST API. Routing is hash based so the
+// embedded file server only ever needs to serve index.html.
+"use strict";
+
+const API = "/v1";
+const app = document.getElementById("app");
+
+// -----------------------------------------------------------------------------
+// Helpers
+// -----------------------------------------------------------------------------
+
+function esc(value) {
+  return String(value ?? "").replace(/[&<>"']/g, (c) => ({
+    "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;",
+  })[c]);
+}
+
+async function api(path, params = {}) {
+  const url = new URL(API + path, location.origin);
+  for (const [key, value] of Object.entries(params)) {
+    for (const v of [].concat(value)) {
+      if (v !== undefined && v !== "") url.searchParams.append(key, v);
+    }
+  }
+  const res = await fetch(url);
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error ? body.error.message : res.statusText);
+  return body;
+}
+
+function roleLink(name) {
+  return `<a href="#/role/${encodeURIComponent(name)}">${esc(name)}</a>`;
+}
+
+function permissionLink(name) {
+  return `<a href="#/permission/${encodeURIComponent(name)}">${esc(name)}</a>`;
+}
+
+function permissionList(perms) {
+  if (!perms.length) return `<p class="muted">None</p>`;
+  return `<ul class="plain">${perms.map((p) => `<li>${permissionLink(p)}</li>`).join("")}</ul>`;
+}
+
+function splitList(value) {
+  return value.split(/[\s,]+/).map((v) => v.trim()).filter(Boolean);
+}
+
+function render(html) {
+  app.innerHTML = html;
+}
+
+function renderError(err) {
+  render(`<div class="error">${esc(err.message)}</div>`);
+}
+
+// -----------------------------------------------------------------------------
+// Views
+// -----------------------------------------------------------------------------
+
+async function searchView(params) {
+  const q = params.get("q") || "";
+  const kind = params.get("kind") || "roles";
+
+  render(`
+    <form id="search">
+      <input name="q" value="${esc(q)}" placeholder="Search roles or permissions, e.g. storage.objects" autofocus>
+      <button name="kind" value="roles">Roles</button>
+      <button name="kind" value="permissions">Permissions</button>
+    </form>
+    <div id="results"></div>`);
+
+  document.getElementById("search").addEventListener("submit", (e) => {
+    e.preventDefault();
+    const value = new FormData(e.target).get("q");
+    const button = e.submitter ? e.submitter.value : kind;
+    location.hash = `#/?kind=${button}&q=${encodeURIComponent(value)}`;
+  });
+
+  if (!q) return;
+  await loadResults(kind, q, "");
+}
+
+async function loadResults(kind, q, pageToken) {
+  const results = document.getElementById("results");
+  const page = await api(`/${kind}`, { q, page_size: 50, page_token: pageToken });
+  const items = page[kind];
+
+  const rows = kind === "roles"
+    ? items.map((r) => `<tr><td>${roleLink(r.name)}</td><td>${esc(r.title)}</td><td><span class="stage">${esc(r.stage)}</span></td></tr>`)
+    : items.map((p) => `<tr><td>${permissionLink(p)}</td></tr>`);
+
+  if (!pageToken) {
+    const header = kind === "roles" ? "<tr><th>Role</th><th>Title</th><th>Stage</th></tr>" : "<tr><th>Permission</th></tr>";
+    results.innerHTML = `<p class="muted">${page.total_size} ${kind} matching "${esc(q)}"</p><table><thead>${header}</thead><tbody></tbody></table>`;
+  }
+  results.querySelector("tbody").insertAdjacentHTML("beforeend", rows.join(""));
+
+  results.querySelector(".more")?.remove();
+  if (page.next_page_token) {
+    results.insertAdjacentHTML("beforeend", `<button class="more">Load more</button>`);
+    results.querySelector(".more").addEventListener("click", () => loadResults(kind, q, page.next_page_token));
+  }
+}
+
+async function roleView(name) {
+  const { role, permissions } = await api(`/roles/${encodeURIComponent(name)}`);
+  render(`
+    <h1>${esc(role.name)} <span class="stage">${esc(role.stage)}</span></h1>
+    <p><strong>${esc(role.title)}</strong></p>
+    <p class="muted">${esc(role.description)}</p>
+    <p><a href="#/compare?roles=${encodeURIComponent(role.name)}">Compare with another role</a></p>
+    <h2>Permissions (${permissions.length})</h2>
+    ${permissionList(permissions)}`);
+}
+
+async function permissionView(name) {
+  const { permission, roles } = await api(`/permissions/${encodeURIComponent(name)}`);
+  render(`
+    <h1>${esc(permission)}</h1>
+    <h2>Roles granting this permission (${roles.length})</h2>
+    <table>
+      <thead><tr><th>Role</th><th>Title</th><th>Stage</th></tr></thead>
+      <tbody>${roles.map((r) => `<tr><td>${roleLink(r.name)}</td><td>${esc(r.title)}</td><td><span class="stage">${esc(r.stage)}</span></td></tr>`).join("")}</tbody>
+    </table>`);
+}
+
+async function compareView(params) {
+  const roles = splitList(params.get("roles") || "");
+
+  render(`
+    <form id="compare">
+      <input name="roles" value="${esc(roles.join(", "))}" placeholder="Two or more roles, e.g. storage.objectViewer, storage.objectAdmin" autofocus>
+      <button>Compare</button>
+    </form>
+    <div id="results"></div>`);
+
+  document.getElementById("compare").addEventListener("submit", (e) => {
+    e.preventDefault();
+    const value = splitList(new FormData(e.target).get("roles"));
+    location.hash = `#/compare?roles=${encodeURIComponent(value.join(","))}`;
+  });
+
+  if (roles.length < 2) return;
+
+  const result = await api("/compare", { role: roles });
+  document.getElementById("results").innerHTML = `
+    <h2>Common permissions (${result.common.length})</h2>
+    ${permissionList(result.common)}
+    <h2>Unique permissions</h2>
+    <div class="columns">
+      ${result.roles.map((r) => `
+        <div>
+          <h2>${roleLink(r)} (${result.unique[r].length})</h2>
+          ${permissionList(result.unique[r])}
+        </div>`).join("")}
+    </div>`;
+}
+
+async function solveView(params) {
+  const permissions = splitList(params.get("permissions") || "");
+
+  render(`
+    <p class="muted">List the permissions you need; the smallest set of predefined roles granting them is shown.</p>
+    <form id="solve">
+      <textarea name="permissions" placeholder="storage.objects.get&#10;storage.objects.list" autofocus>${esc(permissions.join("\n"))}</textarea>
+      <button>Find roles</button>
+    </form>
+    <div id="results"></div>`);
+
+  document.getElementById("solve").addEventListener("submit", (e) => {
+    e.preventDefault();
+    const value = splitList(new FormData(e.target).get("permissions"));
+    location.hash = `#/solve?permissions=${encodeURIComponent(value.join(","))}`;
+  });
+
+  if (!permissions.length) return;
+
+  const result = await api("/solve", { permission: permissions });
+  const uncovered = result.uncovered || [];
+  document.getElementById("results").innerHTML = `
+    <table>
+      <thead><tr><th>Role</th><th>Grants</th><th>Total permissions</th></tr></thead>
+      <tbody>${(result.roles || []).map((rc) => `
+        <tr>
+          <td>${roleLink(rc.role.name)}<div class="muted">${esc(rc.role.title)}</div></td>
+          <td><ul class="plain">${rc.covers.map((p) => `<li class="ok">✓ ${permissionLink(p)}</li>`).join("")}</ul></td>
+          <td>${rc.total_permissions}</td>
+        </tr>`).join("")}
+      </tbody>
+    </table>
+    ${uncovered.length ? `
+      <h2 class="bad">Not granted by any role (${uncovered.length})</h2>
+      <ul class="plain">${uncovered.map((p) => `<li class="bad">✗ ${esc(p)}</li>`).join("")}</ul>` : ""}`;
+}
+
+// -----------------------------------------------------------------------------
+// Router
+// -----------------------------------------------------------------------------
+
+async function route() {
+  const hash = location.hash.replace(/^#/, "") || "/";
+  const [path, query] = hash.split("?");
+  const params = new URLSearchParams(query || "");
+  const [, view, ...rest] = path.split("/");
+  const name = decodeURIComponent(rest.join("/"));
+
+  try {
+    switch (view) {
+      case "role":
+        await roleView(name);
+        break;
+      case "permission":
+        await permissionView(name);
+        break;
+      case "compare":
+        await compareView(params);
+        break;
+      case "solve":
+        await solveView(params);
+        break;
+      default:
+        await searchView(params);
+    }
+  } catch (err) {
+    renderError(err);
+  }
+  window.scrollTo(0, 0);
+}
+
+window.addEventListener("hashchange", route);
+route();
+
+fetch("/healthz")
+  .then((res) => res.json())
+  .then((body) => { document.getElementById("version").textContent = body.version; })
+  .catch(() => {});
@@ -0,0 +1,103 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/internal/constants"
+)
+
+// maxHistory is the number of lines kept in memory and reloaded on startup
+const maxHistory = 1000
+
+// history is a bounded line history persisted by appending to a file
+type history struct {
+	path    string
+	entries []string // oldest first
+}
+
+// loadHistory reads the last maxHistory lines of the history file and drops older lines from
+// the file, so appending in Add does not grow it forever. An empty path disables persistence.
+func loadHistory(path string) (*history, error) {
+	h := &history{path: path}
+	if path == "" {
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("failed to read history: %w", err)
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		if err := h.rewrite(); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// rewrite replaces the history file with the entries in memory
+func (h *history) rewrite() error {
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(h.entries, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to trim history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to trim history: %w", err)
+	}
+	return nil
+}
+
+// Add records a line in memory and appends it to the history file
+func (h *history) Add(entry string) {
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), constants.DefaultDirPermissions); err != nil {
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, entry)
+}
+
+// Len returns the number of entries
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+// At returns an entry, 0 being the most recent
+func (h *history) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
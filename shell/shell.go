@@ -0,0 +1,339 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kborovik/gcp-iam/cmd"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+)
+
+const (
+	prompt = "gcp-iam> "
+
+	// maxCandidates limits how many completion candidates are listed at once
+	maxCandidates = 50
+)
+
+// interactive lists the commands that take over stdin or run until interrupted.
+// Inside the shell they would compete with the prompt for input, so Exec refuses them.
+var interactive = map[string]bool{"mcp": true, "serve": true, "shell": true, "tui": true}
+
+// Shell is an interactive read-eval-print loop running gcp-iam commands against a shared session
+type Shell struct {
+	session     *cmd.Session
+	newApp      func() *cli.Command
+	historyPath string
+
+	commands map[string][]string // subcommand names by parent path, "" for top level
+	names    []string            // role, permission and service names, loaded on first completion
+}
+
+// New creates a shell. newApp must return a fresh command tree for every call because
+// parsed flag values are kept on the command and would otherwise leak between lines.
+func New(session *cmd.Session, newApp func() *cli.Command, historyPath string) *Shell {
+	s := &Shell{
+		session:     session,
+		newApp:      newApp,
+		historyPath: historyPath,
+		commands:    make(map[string][]string),
+	}
+	s.indexCommands("", newApp().Commands)
+	return s
+}
+
+func (s *Shell) indexCommands(parent string, commands []*cli.Command) {
+	for _, c := range commands {
+		if c.Hidden {
+			continue
+		}
+		s.commands[parent] = append(s.commands[parent], c.Name)
+		s.indexCommands(strings.TrimSpace(parent+" "+c.Name), c.Commands)
+	}
+	sort.Strings(s.commands[parent])
+}
+
+// Run reads and executes lines until EOF, "exit" or ctx cancellation.
+// On a terminal it provides line editing, history and tab completion; otherwise lines are read as a script.
+func (s *Shell) Run(ctx context.Context, in *os.File, out io.Writer) error {
+	if !term.IsTerminal(int(in.Fd())) {
+		return s.runScript(ctx, in, out)
+	}
+
+	// Ctrl-C interrupts the running command, not the session: the prompt reads Ctrl-C as a key,
+	// and Exec cancels each command on SIGINT itself
+	ctx = context.WithoutCancel(ctx)
+
+	fd := int(in.Fd())
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, out}, prompt)
+
+	history, err := loadHistory(s.historyPath)
+	if err != nil {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
+	terminal.History = history
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		newLine, newPos, candidates := s.Complete(line, pos)
+		if len(candidates) > 1 && newLine == line {
+			fmt.Fprintln(terminal, formatCandidates(candidates))
+		}
+		return newLine, newPos, true
+	}
+
+	fmt.Fprintln(out, "Type a command without the 'gcp-iam' prefix, 'help' for commands or 'exit' to quit.")
+	fmt.Fprintln(out, "Use $last or $last[N] to refer to the names listed by the previous command.")
+
+	for ctx.Err() == nil {
+		// raw mode is only needed while editing; command output expects a cooked terminal
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to enable raw mode: %w", err)
+		}
+		if w, h, err := term.GetSize(fd); err == nil {
+			terminal.SetSize(w, h)
+		}
+		line, err := terminal.ReadLine()
+		term.Restore(fd, state)
+
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(out)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		if s.Exec(ctx, line, out) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Shell) runScript(ctx context.Context, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() && ctx.Err() == nil {
+		if s.Exec(ctx, scanner.Text(), out) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Exec runs one input line and reports whether the shell should exit. Errors are printed, not returned,
+// so a failing command does not end the session.
+func (s *Shell) Exec(ctx context.Context, line string, out io.Writer) (quit bool) {
+	args, err := Split(line)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return false
+	}
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "exit", "quit":
+		return true
+	case "help":
+		args = append(args[1:], "--help")
+	case "last":
+		for i, name := range s.session.Last {
+			fmt.Fprintf(out, "  [%d] %s\n", i, name)
+		}
+		return false
+	default:
+		if interactive[args[0]] {
+			fmt.Fprintf(out, "Error: '%s' cannot run inside the shell; exit and run 'gcp-iam %s' instead\n", args[0], args[0])
+			return false
+		}
+	}
+
+	args, err = Expand(args, s.session.Last)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return false
+	}
+
+	app := s.newApp()
+	app.Writer = out
+	app.ErrWriter = out
+	// keep cli.Exit from terminating the process
+	app.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+
+	// urfave/cli finds the parent command through the context, so each line runs from a fresh
+	// context that only inherits cancellation; otherwise "shell" would become the parent of the new tree
+	runCtx, cancel := context.WithCancel(cmd.WithSession(context.Background(), s.session))
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	runCtx, stopSignals := signal.NotifyContext(runCtx, os.Interrupt)
+	defer stopSignals()
+
+	err = app.Run(runCtx, append([]string{app.Name}, args...))
+	if err != nil {
+		var exitErr cli.ExitCoder
+		if !errors.As(err, &exitErr) || err.Error() != "" {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+	}
+	return false
+}
+
+// Split tokenizes a line like a POSIX shell: whitespace separates words,
+// single and double quotes group them and backslash escapes the next character.
+func Split(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '\'':
+			word.WriteRune(r)
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+			inWord = true
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// Expand replaces "$last" with every name of the previous result and "$last[N]" with its Nth name (0-based)
+func Expand(args, last []string) ([]string, error) {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "$last" {
+			if len(last) == 0 {
+				return nil, fmt.Errorf("$last is empty: no previous command listed any names")
+			}
+			expanded = append(expanded, last...)
+			continue
+		}
+
+		if index, ok := strings.CutPrefix(arg, "$last["); ok && strings.HasSuffix(index, "]") {
+			n, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid reference %s", arg)
+			}
+			if n < 0 || n >= len(last) {
+				return nil, fmt.Errorf("%s is out of range: $last has %d names", arg, len(last))
+			}
+			expanded = append(expanded, last[n])
+			continue
+		}
+
+		expanded = append(expanded, arg)
+	}
+	return expanded, nil
+}
+
+// Complete completes the word before pos. It returns the new line and cursor position
+// and the candidates considered; with several candidates the word is extended to their common prefix.
+func (s *Shell) Complete(line string, pos int) (string, int, []string) {
+	before := line[:pos]
+	start := strings.LastIndexAny(before, " \t") + 1
+	word := before[start:]
+
+	var candidates []string
+	for _, c := range s.candidates(strings.Fields(before[:start])) {
+		if strings.HasPrefix(c, word) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return line, pos, nil
+	}
+
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		completion += " "
+	}
+
+	newLine := before[:start] + completion + line[pos:]
+	return newLine, start + len(completion), candidates
+}
+
+// candidates returns the completions for the word following the given words
+func (s *Shell) candidates(words []string) []string {
+	if subcommands, ok := s.commands[strings.Join(words, " ")]; ok {
+		return subcommands
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	if s.names == nil {
+		s.names = loadNames(s.session.DB)
+	}
+	return append([]string{"$last"}, s.names...)
+}
+
+func loadNames(database *db.DB) []string {
+	names := []string{}
+	for _, fetch := range []func() ([]string, error){database.GetRoleNames, database.GetPermissionNames, database.GetServiceNames} {
+		if fetched, err := fetch(); err == nil {
+			names = append(names, fetched...)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func commonPrefix(items []string) string {
+	prefix := items[0]
+	for _, item := range items[1:] {
+		for !strings.HasPrefix(item, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func formatCandidates(candidates []string) string {
+	if len(candidates) > maxCandidates {
+		return strings.Join(candidates[:maxCandidates], "  ") + fmt.Sprintf("  ... (%d more)", len(candidates)-maxCandidates)
+	}
+	return strings.Join(candidates, "  ")
+}
@@ -0,0 +1,237 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/cmd"
+	"github.com/kborovik/gcp-iam/config"
+	"github.com/kborovik/gcp-iam/db"
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+	"github.com/urfave/cli/v3"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{"role show viewer", []string{"role", "show", "viewer"}},
+		{"  role   search  ", []string{"role", "search"}},
+		{`role search "storage admin"`, []string{"role", "search", "storage admin"}},
+		{`lint 'my policy.json'`, []string{"lint", "my policy.json"}},
+		{`a\ b ""`, []string{"a b", ""}},
+	}
+
+	for _, tt := range tests {
+		args, err := Split(tt.line)
+		if err != nil {
+			t.Errorf("Split(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Split(%q) = %q, expected %q", tt.line, args, tt.args)
+		}
+	}
+
+	if _, err := Split(`role search "unterminated`); err == nil {
+		t.Error("Expected error for unterminated quote")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	last := []string{"viewer", "editor"}
+
+	args, err := Expand([]string{"role", "compare", "$last"}, last)
+	if err != nil || !reflect.DeepEqual(args, []string{"role", "compare", "viewer", "editor"}) {
+		t.Errorf("Expected $last to expand to all names, got %q (%v)", args, err)
+	}
+
+	args, err = Expand([]string{"role", "show", "$last[1]"}, last)
+	if err != nil || !reflect.DeepEqual(args, []string{"role", "show", "editor"}) {
+		t.Errorf("Expected $last[1] to expand to editor, got %q (%v)", args, err)
+	}
+
+	for _, arg := range []string{"$last[2]", "$last[-1]", "$last[x]"} {
+		if _, err := Expand([]string{arg}, last); err == nil {
+			t.Errorf("Expected error for %s", arg)
+		}
+	}
+
+	if _, err := Expand([]string{"$last"}, nil); err == nil {
+		t.Error("Expected error for empty $last")
+	}
+}
+
+// newTestShell builds a shell over a command tree whose "list" command records its arguments
+// as the last result and whose "echo" command prints its arguments
+func newTestShell(t *testing.T) (*Shell, *bytes.Buffer) {
+	t.Helper()
+
+	database := dbtest.New(t, map[string][]string{"storage.admin": nil, "storage.objectViewer": nil})
+
+	var out bytes.Buffer
+	session := &cmd.Session{Config: &config.Config{}, DB: database}
+	newApp := func() *cli.Command {
+		return &cli.Command{
+			Name:  "gcp-iam",
+			Flags: []cli.Flag{&cli.StringFlag{Name: "db"}},
+			Commands: []*cli.Command{
+				{
+					Name: "role",
+					Commands: []*cli.Command{
+						{
+							Name: "list",
+							Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, d *db.DB) error {
+								if d != database {
+									t.Error("Expected session database to be reused")
+								}
+								cmd.Record(ctx, c.Args().Slice())
+								return nil
+							}),
+						},
+						{Name: "show"},
+						{
+							Name: "count",
+							Action: cmd.WithDB(func(ctx context.Context, c *cli.Command, cfg *config.Config, d *db.DB) error {
+								count, err := d.CountRoles()
+								fmt.Fprintf(&out, "%d roles\n", count)
+								return err
+							}),
+						},
+					},
+				},
+				{
+					Name: "echo",
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "prefix"},
+					},
+					Action: func(ctx context.Context, c *cli.Command) error {
+						out.WriteString(c.String("prefix") + strings.Join(c.Args().Slice(), ",") + "\n")
+						return nil
+					},
+				},
+			},
+		}
+	}
+
+	return New(session, newApp, ""), &out
+}
+
+func TestExec(t *testing.T) {
+	s, out := newTestShell(t)
+	ctx := context.Background()
+
+	for _, line := range []string{
+		"role list viewer editor",
+		"echo --prefix x: $last",
+		"echo $last[0]",
+		"echo $last[5]",
+	} {
+		if s.Exec(ctx, line, out) {
+			t.Fatalf("Unexpected exit on %q", line)
+		}
+	}
+
+	expected := "x:viewer,editor\nviewer\nError: $last[5] is out of range: $last has 2 names\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+
+	if !s.Exec(ctx, "exit", out) {
+		t.Error("Expected exit to end the session")
+	}
+}
+
+func TestExecRejectsInteractive(t *testing.T) {
+	s, out := newTestShell(t)
+
+	for _, name := range []string{"tui", "shell", "mcp", "serve"} {
+		out.Reset()
+		if s.Exec(context.Background(), name, out) {
+			t.Fatalf("Unexpected exit on %q", name)
+		}
+		if !strings.Contains(out.String(), "cannot run inside the shell") {
+			t.Errorf("Expected %q to be refused, got %q", name, out.String())
+		}
+	}
+}
+
+func TestExecOpensDatabaseGivenOnLine(t *testing.T) {
+	s, out := newTestShell(t)
+	other := dbtest.File(t, map[string][]string{"compute.viewer": nil})
+
+	for _, line := range []string{"role count", "role count --db " + other} {
+		if s.Exec(context.Background(), line, out) {
+			t.Fatalf("Unexpected exit on %q", line)
+		}
+	}
+
+	if out.String() != "2 roles\n1 roles\n" {
+		t.Errorf("Expected the --db database to be used for its line only, got %q", out.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s, _ := newTestShell(t)
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"ro", "role "},
+		{"role l", "role list "},
+		{"role show storage.", "role show storage."},
+		{"role show storage.a", "role show storage.admin "},
+		{"echo $la", "echo $last "},
+		{"zzz", "zzz"},
+	}
+
+	for _, tt := range tests {
+		line, pos, _ := s.Complete(tt.line, len(tt.line))
+		if line != tt.expected || pos != len(tt.expected) {
+			t.Errorf("Complete(%q) = %q at %d, expected %q", tt.line, line, pos, tt.expected)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	h.Add("role show viewer")
+	h.Add("role show viewer")
+	h.Add("permission search storage")
+
+	reloaded, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("Failed to reload history: %v", err)
+	}
+	if reloaded.Len() != 2 || reloaded.At(0) != "permission search storage" {
+		t.Errorf("Expected 2 persisted entries with the newest first, got %v", reloaded.entries)
+	}
+
+	for i := range maxHistory + 5 {
+		reloaded.Add(fmt.Sprintf("role show role%d", i))
+	}
+	if _, err := loadHistory(path); err != nil {
+		t.Fatalf("Failed to reload history: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read history file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != maxHistory || lines[len(lines)-1] != fmt.Sprintf("role show role%d", maxHistory+4) {
+		t.Errorf("Expected the history file to be trimmed to the last %d entries, got %d lines", maxHistory, len(lines))
+	}
+}
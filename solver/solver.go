@@ -0,0 +1,134 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/kborovik/gcp-iam/db"
+)
+
+// Result is a set of roles that together grant the requested permissions
+type Result struct {
+	Roles     []RoleCoverage `json:"roles"`
+	Uncovered []string       `json:"uncovered"`
+}
+
+// RoleCoverage is a selected role and the requested permissions it contributes
+type RoleCoverage struct {
+	Role             db.Role  `json:"role"`
+	Covers           []string `json:"covers"`
+	TotalPermissions int      `json:"total_permissions"`
+}
+
+// MinimalRoles finds a small set of predefined roles granting all the given permissions.
+// It uses the greedy set cover approximation: repeatedly pick the role covering the most
+// remaining permissions, preferring roles with fewer total permissions (least privilege).
+// Permissions not granted by any role are returned as uncovered. Roles and Uncovered are
+// never nil.
+func MinimalRoles(ctx context.Context, database *db.DB, permissions []string) (*Result, error) {
+	remaining := make(map[string]bool, len(permissions))
+	for _, perm := range permissions {
+		remaining[perm] = true
+	}
+
+	candidates := make(map[string]*candidate)
+	for perm := range remaining {
+		roles, err := database.GetRolesWithPermissionContext(ctx, perm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get roles with permission '%s': %w", perm, err)
+		}
+		for _, role := range roles {
+			c := candidates[role.Name]
+			if c == nil {
+				c = &candidate{role: role, covers: make(map[string]bool)}
+				candidates[role.Name] = c
+			}
+			c.covers[perm] = true
+		}
+	}
+
+	for _, c := range candidates {
+		count, err := countPermissions(ctx, database, c.role.Name)
+		if err != nil {
+			return nil, err
+		}
+		c.total = count
+	}
+
+	// Empty lists rather than nil so JSON clients always get arrays
+	result := &Result{Roles: []RoleCoverage{}, Uncovered: []string{}}
+	for len(remaining) > 0 {
+		best := bestCandidate(candidates, remaining)
+		if best == nil {
+			break
+		}
+
+		var covers []string
+		for perm := range best.covers {
+			if remaining[perm] {
+				covers = append(covers, perm)
+				delete(remaining, perm)
+			}
+		}
+		sort.Strings(covers)
+
+		result.Roles = append(result.Roles, RoleCoverage{
+			Role:             best.role,
+			Covers:           covers,
+			TotalPermissions: best.total,
+		})
+		delete(candidates, best.role.Name)
+	}
+
+	for perm := range remaining {
+		result.Uncovered = append(result.Uncovered, perm)
+	}
+	sort.Strings(result.Uncovered)
+
+	return result, nil
+}
+
+type candidate struct {
+	role   db.Role
+	covers map[string]bool
+	total  int
+}
+
+// bestCandidate returns the role covering the most remaining permissions, or nil if none covers any.
+// Ties are broken by fewest total permissions, then by name for stable output.
+func bestCandidate(candidates map[string]*candidate, remaining map[string]bool) *candidate {
+	var best *candidate
+	bestCount := 0
+
+	for _, c := range candidates {
+		count := 0
+		for perm := range c.covers {
+			if remaining[perm] {
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+
+		switch {
+		case best == nil, count > bestCount:
+		case count == bestCount && c.total < best.total:
+		case count == bestCount && c.total == best.total && c.role.Name < best.role.Name:
+		default:
+			continue
+		}
+		best, bestCount = c, count
+	}
+
+	return best
+}
+
+func countPermissions(ctx context.Context, database *db.DB, roleName string) (int, error) {
+	permissions, err := database.GetRolePermissionNamesContext(ctx, roleName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get permissions for role '%s': %w", roleName, err)
+	}
+	return len(permissions), nil
+}
@@ -0,0 +1,75 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+// testGrants are the roles the solver chooses from
+var testGrants = map[string][]string{
+	"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+	"storage.objectAdmin":  {"storage.objects.get", "storage.objects.list", "storage.objects.delete"},
+	"compute.viewer":       {"compute.instances.get"},
+}
+
+func TestMinimalRoles(t *testing.T) {
+	database := dbtest.New(t, testGrants)
+
+	tests := []struct {
+		name        string
+		permissions []string
+		roles       []string
+		uncovered   []string
+	}{
+		{
+			name:        "prefers smallest role",
+			permissions: []string{"storage.objects.get", "storage.objects.list"},
+			roles:       []string{"storage.objectViewer"},
+		},
+		{
+			name:        "picks role covering most",
+			permissions: []string{"storage.objects.get", "storage.objects.delete"},
+			roles:       []string{"storage.objectAdmin"},
+		},
+		{
+			name:        "combines roles",
+			permissions: []string{"storage.objects.list", "compute.instances.get"},
+			roles:       []string{"compute.viewer", "storage.objectViewer"},
+		},
+		{
+			name:        "reports uncovered",
+			permissions: []string{"compute.instances.get", "unknown.thing.do"},
+			roles:       []string{"compute.viewer"},
+			uncovered:   []string{"unknown.thing.do"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := MinimalRoles(context.Background(), database, tt.permissions)
+			if err != nil {
+				t.Fatalf("MinimalRoles failed: %v", err)
+			}
+
+			var roles []string
+			for _, rc := range result.Roles {
+				roles = append(roles, rc.Role.Name)
+			}
+
+			if len(roles) != len(tt.roles) {
+				t.Fatalf("Expected roles %v, got %v", tt.roles, roles)
+			}
+			for i := range roles {
+				if roles[i] != tt.roles[i] {
+					t.Errorf("Expected roles %v, got %v", tt.roles, roles)
+				}
+			}
+
+			if len(result.Uncovered) != len(tt.uncovered) {
+				t.Errorf("Expected uncovered %v, got %v", tt.uncovered, result.Uncovered)
+			}
+		})
+	}
+}
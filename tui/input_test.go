@@ -0,0 +1,63 @@
+//go:build unix
+
+package tui
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadInputStopsWithoutConsumingInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		_, err := readInput(r, make([]byte, 16), done)
+		result <- err
+	}()
+
+	close(done)
+	select {
+	case err := <-result:
+		if !errors.Is(err, errReaderStopped) {
+			t.Fatalf("expected errReaderStopped, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("readInput did not stop after done was closed")
+	}
+
+	if _, err := w.Write([]byte("q")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := r.Read(buf)
+	if err != nil || string(buf[:n]) != "q" {
+		t.Fatalf("expected input to remain unread, got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestReadInputReturnsAvailableInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if _, err := w.Write([]byte("jk")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := readInput(r, buf, make(chan struct{}))
+	if err != nil || string(buf[:n]) != "jk" {
+		t.Fatalf("expected \"jk\", got %q (%v)", buf[:n], err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package tui
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// waitInput waits up to inputPollInterval for the console attached to in to have input
+func waitInput(in *os.File) (bool, error) {
+	event, err := windows.WaitForSingleObject(windows.Handle(in.Fd()), uint32(inputPollInterval.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	return event == windows.WAIT_OBJECT_0, nil
+}
@@ -0,0 +1,118 @@
+package tui
+
+import "unicode/utf8"
+
+// KeyType identifies a decoded key press
+type KeyType int
+
+const (
+	KeyRune KeyType = iota
+	KeyUp
+	KeyDown
+	KeyPageUp
+	KeyPageDown
+	KeyHome
+	KeyEnd
+	KeyLeft
+	KeyRight
+	KeyTab
+	KeyEnter
+	KeyBackspace
+	KeyEsc
+	KeyCtrlC
+	KeyCtrlS
+	KeyCtrlU
+)
+
+// Key is a single key press; Rune is set for KeyRune
+type Key struct {
+	Type KeyType
+	Rune rune
+}
+
+// escapeSequences maps terminal escape sequences (without the leading ESC) to keys
+var escapeSequences = map[string]KeyType{
+	"[A":  KeyUp,
+	"[B":  KeyDown,
+	"[C":  KeyRight,
+	"[D":  KeyLeft,
+	"OA":  KeyUp,
+	"OB":  KeyDown,
+	"OC":  KeyRight,
+	"OD":  KeyLeft,
+	"[H":  KeyHome,
+	"[F":  KeyEnd,
+	"OH":  KeyHome,
+	"OF":  KeyEnd,
+	"[1~": KeyHome,
+	"[4~": KeyEnd,
+	"[5~": KeyPageUp,
+	"[6~": KeyPageDown,
+}
+
+// ParseKeys decodes raw terminal input into key presses. Unknown escape sequences are dropped.
+func ParseKeys(buf []byte) []Key {
+	var keys []Key
+	for len(buf) > 0 {
+		switch b := buf[0]; {
+		case b == 0x1b:
+			if key, n, ok := parseEscape(buf[1:]); ok {
+				keys = append(keys, key)
+				buf = buf[1+n:]
+				continue
+			}
+			if len(buf) > 1 && (buf[1] == '[' || buf[1] == 'O') {
+				buf = skipEscape(buf)
+				continue
+			}
+			keys = append(keys, Key{Type: KeyEsc})
+			buf = buf[1:]
+		case b == '\r' || b == '\n':
+			keys = append(keys, Key{Type: KeyEnter})
+			buf = buf[1:]
+		case b == '\t':
+			keys = append(keys, Key{Type: KeyTab})
+			buf = buf[1:]
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, Key{Type: KeyBackspace})
+			buf = buf[1:]
+		case b == 0x03:
+			keys = append(keys, Key{Type: KeyCtrlC})
+			buf = buf[1:]
+		case b == 0x13:
+			keys = append(keys, Key{Type: KeyCtrlS})
+			buf = buf[1:]
+		case b == 0x15:
+			keys = append(keys, Key{Type: KeyCtrlU})
+			buf = buf[1:]
+		case b < 0x20:
+			buf = buf[1:]
+		default:
+			r, size := utf8.DecodeRune(buf)
+			if r != utf8.RuneError {
+				keys = append(keys, Key{Type: KeyRune, Rune: r})
+			}
+			buf = buf[size:]
+		}
+	}
+	return keys
+}
+
+func parseEscape(buf []byte) (Key, int, bool) {
+	for seq, keyType := range escapeSequences {
+		if len(buf) >= len(seq) && string(buf[:len(seq)]) == seq {
+			return Key{Type: keyType}, len(seq), true
+		}
+	}
+	return Key{}, 0, false
+}
+
+// skipEscape drops an unrecognized CSI/SS3 sequence up to and including its final byte
+func skipEscape(buf []byte) []byte {
+	for i := 2; i < len(buf); i++ {
+		if buf[i] >= 0x40 && buf[i] <= 0x7e {
+			return buf[i+1:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		keys  []Key
+	}{
+		{"runes", "ab", []Key{{Type: KeyRune, Rune: 'a'}, {Type: KeyRune, Rune: 'b'}}},
+		{"arrows", "\x1b[A\x1b[B\x1bOA", []Key{{Type: KeyUp}, {Type: KeyDown}, {Type: KeyUp}}},
+		{"paging", "\x1b[5~\x1b[6~", []Key{{Type: KeyPageUp}, {Type: KeyPageDown}}},
+		{"esc alone", "\x1b", []Key{{Type: KeyEsc}}},
+		{"controls", "\r\t\x7f\x03\x13\x15", []Key{{Type: KeyEnter}, {Type: KeyTab}, {Type: KeyBackspace}, {Type: KeyCtrlC}, {Type: KeyCtrlS}, {Type: KeyCtrlU}}},
+		{"unknown sequence dropped", "\x1b[1;5Cx", []Key{{Type: KeyRune, Rune: 'x'}}},
+		{"utf8", "é", []Key{{Type: KeyRune, Rune: 'é'}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := ParseKeys([]byte(tt.input))
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("ParseKeys(%q) = %v, expected %v", tt.input, keys, tt.keys)
+			}
+		})
+	}
+}
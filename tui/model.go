@@ -0,0 +1,528 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kborovik/gcp-iam/compare"
+	"github.com/kborovik/gcp-iam/db"
+)
+
+// ANSI escape sequences used for rendering
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiGreen   = "\x1b[32m"
+	ansiCyan    = "\x1b[36m"
+)
+
+type view int
+
+const (
+	viewRoles view = iota
+	viewPermissionRoles
+	viewCompare
+)
+
+type focus int
+
+const (
+	focusRoles focus = iota
+	focusPermissions
+)
+
+// list is a scrollable list of items with a cursor
+type list struct {
+	items  []string
+	cursor int
+	offset int
+}
+
+func (l *list) set(items []string) {
+	l.items = items
+	l.cursor = 0
+	l.offset = 0
+}
+
+func (l *list) move(delta int) {
+	l.cursor = max(0, min(l.cursor+delta, len(l.items)-1))
+}
+
+func (l *list) selected() string {
+	if l.cursor < 0 || l.cursor >= len(l.items) {
+		return ""
+	}
+	return l.items[l.cursor]
+}
+
+// window returns the visible items for the given height, scrolling to keep the cursor visible
+func (l *list) window(height int) (items []string, first int) {
+	if height <= 0 {
+		return nil, 0
+	}
+	if l.cursor < l.offset {
+		l.offset = l.cursor
+	}
+	if l.cursor >= l.offset+height {
+		l.offset = l.cursor - height + 1
+	}
+	end := min(l.offset+height, len(l.items))
+	return l.items[l.offset:end], l.offset
+}
+
+// Model is the state of the explorer. It is independent of the terminal so it can be driven by tests.
+type Model struct {
+	db *db.DB
+
+	view  view
+	focus focus
+	query string
+
+	roles       list
+	titles      map[string]string
+	permissions list
+
+	// roles granting the permission selected in the permission pane
+	permission      string
+	permissionRoles list
+
+	marked     []string
+	comparison *compare.Result
+
+	status string
+}
+
+// NewModel creates a model listing all roles
+func NewModel(database *db.DB) (*Model, error) {
+	m := &Model{db: database, titles: make(map[string]string)}
+	if err := m.search(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// search refreshes the role list from the current query and loads the selected role's permissions
+func (m *Model) search() error {
+	roles, err := m.db.SearchRoles(m.query)
+	if err != nil {
+		return fmt.Errorf("failed to search roles: %w", err)
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+		m.titles[role.Name] = role.Title
+	}
+	m.roles.set(names)
+	return m.loadPermissions()
+}
+
+func (m *Model) loadPermissions() error {
+	role := m.roles.selected()
+	if role == "" {
+		m.permissions.set(nil)
+		return nil
+	}
+
+	names, err := m.db.GetRolePermissionNames(role)
+	if err != nil {
+		return fmt.Errorf("failed to get permissions for role '%s': %w", role, err)
+	}
+	m.permissions.set(names)
+	return nil
+}
+
+// selectRole moves the role cursor to name, clearing the search if the role is filtered out
+func (m *Model) selectRole(name string) error {
+	if !slices.Contains(m.roles.items, name) {
+		m.query = ""
+		if err := m.search(); err != nil {
+			return err
+		}
+	}
+	for i, item := range m.roles.items {
+		if item == name {
+			m.roles.cursor = i
+		}
+	}
+	return m.loadPermissions()
+}
+
+// Update applies a key press and reports whether the explorer should exit
+func (m *Model) Update(key Key) (quit bool, err error) {
+	m.status = ""
+
+	if key.Type == KeyCtrlC {
+		return true, nil
+	}
+
+	switch m.view {
+	case viewPermissionRoles:
+		return false, m.updatePermissionRoles(key)
+	case viewCompare:
+		if key.Type == KeyEsc || key.Type == KeyEnter {
+			m.view = viewRoles
+		}
+		return false, nil
+	}
+
+	return m.updateRoles(key)
+}
+
+func (m *Model) updateRoles(key Key) (bool, error) {
+	switch key.Type {
+	case KeyEsc:
+		if m.query != "" {
+			m.query = ""
+			return false, m.search()
+		}
+		if len(m.marked) > 0 {
+			m.marked = nil
+			return false, nil
+		}
+		return true, nil
+	case KeyTab:
+		if m.focus == focusRoles && len(m.permissions.items) > 0 {
+			m.focus = focusPermissions
+		} else {
+			m.focus = focusRoles
+		}
+	case KeyUp, KeyDown, KeyPageUp, KeyPageDown, KeyHome, KeyEnd:
+		l := &m.roles
+		if m.focus == focusPermissions {
+			l = &m.permissions
+		}
+		l.move(moveDelta(key, len(l.items)))
+		if m.focus == focusRoles {
+			return false, m.loadPermissions()
+		}
+	case KeyEnter:
+		if m.focus == focusPermissions {
+			return false, m.showPermissionRoles(m.permissions.selected())
+		}
+		if len(m.permissions.items) > 0 {
+			m.focus = focusPermissions
+		}
+	case KeyCtrlS:
+		return false, m.toggleMark(m.roles.selected())
+	case KeyBackspace:
+		if m.query != "" {
+			_, size := utf8.DecodeLastRuneInString(m.query)
+			m.query = m.query[:len(m.query)-size]
+			m.focus = focusRoles
+			return false, m.search()
+		}
+	case KeyCtrlU:
+		m.query = ""
+		m.focus = focusRoles
+		return false, m.search()
+	case KeyRune:
+		m.query += string(key.Rune)
+		m.focus = focusRoles
+		return false, m.search()
+	}
+	return false, nil
+}
+
+func (m *Model) updatePermissionRoles(key Key) error {
+	switch key.Type {
+	case KeyEsc:
+		m.view = viewRoles
+	case KeyUp, KeyDown, KeyPageUp, KeyPageDown, KeyHome, KeyEnd:
+		m.permissionRoles.move(moveDelta(key, len(m.permissionRoles.items)))
+	case KeyEnter:
+		role := m.permissionRoles.selected()
+		if role == "" {
+			return nil
+		}
+		m.view = viewRoles
+		m.focus = focusRoles
+		return m.selectRole(role)
+	case KeyCtrlS:
+		return m.toggleMark(m.permissionRoles.selected())
+	}
+	return nil
+}
+
+func moveDelta(key Key, size int) int {
+	switch key.Type {
+	case KeyUp:
+		return -1
+	case KeyDown:
+		return 1
+	case KeyPageUp:
+		return -10
+	case KeyPageDown:
+		return 10
+	case KeyHome:
+		return -size
+	case KeyEnd:
+		return size
+	}
+	return 0
+}
+
+func (m *Model) showPermissionRoles(permission string) error {
+	if permission == "" {
+		return nil
+	}
+
+	roles, err := m.db.GetRolesWithPermission(permission)
+	if err != nil {
+		return fmt.Errorf("failed to get roles with permission: %w", err)
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+		m.titles[role.Name] = role.Title
+	}
+
+	m.permission = permission
+	m.permissionRoles.set(names)
+	m.view = viewPermissionRoles
+	return nil
+}
+
+// toggleMark marks a role for comparison; marking a second role opens the compare view
+func (m *Model) toggleMark(role string) error {
+	if role == "" {
+		return nil
+	}
+
+	for i, marked := range m.marked {
+		if marked == role {
+			m.marked = append(m.marked[:i], m.marked[i+1:]...)
+			return nil
+		}
+	}
+
+	m.marked = append(m.marked, role)
+	if len(m.marked) < 2 {
+		m.status = fmt.Sprintf("Marked %s, mark another role to compare", role)
+		return nil
+	}
+
+	roles := make([]compare.RolePermissions, 0, len(m.marked))
+	for _, name := range m.marked {
+		permissions, err := m.db.GetRolePermissionNames(name)
+		if err != nil {
+			return fmt.Errorf("failed to get permissions for role '%s': %w", name, err)
+		}
+		roles = append(roles, compare.RolePermissions{Role: name, Permissions: permissions})
+	}
+
+	result := compare.Compare(roles)
+	m.comparison = &result
+	m.marked = nil
+	m.view = viewCompare
+	return nil
+}
+
+// =============================================================================
+// RENDERING
+// =============================================================================
+
+// View renders the model for a terminal of the given size. Each line is clipped to width.
+func (m *Model) View(width, height int) string {
+	width = max(width, 20)
+	height = max(height, 5)
+
+	var lines []string
+	switch m.view {
+	case viewPermissionRoles:
+		lines = m.viewPermissionRoles(width, height-1)
+	case viewCompare:
+		lines = m.viewCompare(width, height-1)
+	default:
+		lines = m.viewRoles(width, height-1)
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, ansiDim+clip(m.footer(), width)+ansiReset)
+
+	return strings.Join(lines, "\r\n")
+}
+
+func (m *Model) footer() string {
+	if m.status != "" {
+		return m.status
+	}
+	switch m.view {
+	case viewPermissionRoles:
+		return "↑/↓ move  Enter open role  Ctrl+S mark for compare  Esc back  Ctrl+C quit"
+	case viewCompare:
+		return "Esc back  Ctrl+C quit"
+	}
+	marked := ""
+	if len(m.marked) > 0 {
+		marked = fmt.Sprintf("  [marked: %s]", strings.Join(m.marked, ", "))
+	}
+	return "type to search  ↑/↓ move  Tab switch pane  Enter roles with permission  Ctrl+S mark for compare  Esc clear/quit" + marked
+}
+
+func (m *Model) viewRoles(width, height int) []string {
+	lines := []string{
+		ansiBold + "Search: " + ansiReset + clip(m.query, width-9) + "█",
+		ansiDim + strings.Repeat("─", width) + ansiReset,
+	}
+
+	leftWidth := width * 2 / 5
+	rightWidth := width - leftWidth - 3
+	paneHeight := height - len(lines) - 1
+
+	left := []string{ansiBold + clip(fmt.Sprintf("Roles (%d)", len(m.roles.items)), leftWidth) + ansiReset}
+	right := []string{ansiBold + clip(fmt.Sprintf("Permissions of %s (%d)", m.roles.selected(), len(m.permissions.items)), rightWidth) + ansiReset}
+
+	left = append(left, m.renderList(&m.roles, leftWidth, paneHeight, m.focus == focusRoles, true)...)
+	right = append(right, m.renderList(&m.permissions, rightWidth, paneHeight, m.focus == focusPermissions, false)...)
+
+	for i := 0; i < paneHeight+1; i++ {
+		lines = append(lines, pad(at(left, i), leftWidth)+ansiDim+" │ "+ansiReset+at(right, i))
+	}
+	return lines
+}
+
+func (m *Model) viewPermissionRoles(width, height int) []string {
+	lines := []string{
+		ansiBold + clip(fmt.Sprintf("Roles with permission %s (%d)", m.permission, len(m.permissionRoles.items)), width) + ansiReset,
+		ansiDim + strings.Repeat("─", width) + ansiReset,
+	}
+	return append(lines, m.renderList(&m.permissionRoles, width, height-len(lines), true, true)...)
+}
+
+func (m *Model) viewCompare(width, height int) []string {
+	c := m.comparison
+	if c == nil || len(c.Roles) < 2 {
+		return nil
+	}
+
+	colWidth := (width - 6) / 3
+	header := func(title string, count int) string {
+		return pad(ansiBold+clip(fmt.Sprintf("%s (%d)", title, count), colWidth)+ansiReset, colWidth)
+	}
+
+	first, second := c.Roles[0], c.Roles[1]
+	lines := []string{
+		header("Only in "+first, len(c.Unique[first])) + " │ " +
+			header("Common", len(c.Common)) + " │ " +
+			header("Only in "+second, len(c.Unique[second])),
+		ansiDim + strings.Repeat("─", width) + ansiReset,
+	}
+
+	for i := 0; i < height-len(lines); i++ {
+		lines = append(lines,
+			pad(colored(at(c.Unique[first], i), ansiCyan, colWidth), colWidth)+" │ "+
+				pad(colored(at(c.Common, i), ansiGreen, colWidth), colWidth)+" │ "+
+				colored(at(c.Unique[second], i), ansiCyan, colWidth))
+	}
+	return lines
+}
+
+// renderList renders a list with its cursor highlighted when active; marked roles get a "*"
+func (m *Model) renderList(l *list, width, height int, active, roles bool) []string {
+	items, first := l.window(height)
+	lines := make([]string, 0, len(items))
+	for i, item := range items {
+		text := item
+		if roles {
+			prefix := "  "
+			if slices.Contains(m.marked, item) {
+				prefix = "* "
+			}
+			text = prefix + item
+			if title := m.titles[item]; title != "" && len(text)+len(title)+3 < width {
+				text += ansiDim + "  " + title + ansiReset
+			}
+		}
+
+		line := clip(text, width)
+		if first+i == l.cursor {
+			style := ansiReverse
+			if !active {
+				style = ansiBold
+			}
+			line = style + pad(line, width) + ansiReset
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func at(items []string, i int) string {
+	if i < len(items) {
+		return items[i]
+	}
+	return ""
+}
+
+func colored(text, color string, width int) string {
+	if text == "" {
+		return ""
+	}
+	return color + clip(text, width) + ansiReset
+}
+
+// visibleLen returns the printed width of s, ignoring ANSI escape sequences
+func visibleLen(s string) int {
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == 0x1b:
+			inEscape = true
+		case inEscape:
+			if r >= 0x40 && r <= 0x7e && r != '[' {
+				inEscape = false
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// clip truncates s to width printed characters, keeping ANSI escape sequences intact
+func clip(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if visibleLen(s) <= width {
+		return s
+	}
+
+	var b strings.Builder
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == 0x1b:
+			inEscape = true
+		case inEscape:
+			if r >= 0x40 && r <= 0x7e && r != '[' {
+				inEscape = false
+			}
+		default:
+			if n == width-1 {
+				b.WriteString("…" + ansiReset)
+				return b.String()
+			}
+			n++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func pad(s string, width int) string {
+	if n := visibleLen(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kborovik/gcp-iam/internal/dbtest"
+)
+
+func newTestModel(t *testing.T) *Model {
+	t.Helper()
+
+	m, err := NewModel(dbtest.New(t, map[string][]string{
+		"compute.viewer":       {"compute.instances.get"},
+		"storage.objectAdmin":  {"storage.objects.get", "storage.objects.delete"},
+		"storage.objectViewer": {"storage.objects.get", "storage.objects.list"},
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	return m
+}
+
+func press(t *testing.T, m *Model, keys ...Key) {
+	t.Helper()
+	for _, key := range keys {
+		if _, err := m.Update(key); err != nil {
+			t.Fatalf("Update(%v) failed: %v", key, err)
+		}
+	}
+}
+
+func typeText(t *testing.T, m *Model, text string) {
+	t.Helper()
+	for _, r := range text {
+		press(t, m, Key{Type: KeyRune, Rune: r})
+	}
+}
+
+func TestSearchFiltersRoles(t *testing.T) {
+	m := newTestModel(t)
+
+	if len(m.roles.items) != 3 {
+		t.Fatalf("Expected 3 roles initially, got %v", m.roles.items)
+	}
+
+	typeText(t, m, "object")
+	if len(m.roles.items) != 2 {
+		t.Errorf("Expected 2 roles matching 'object', got %v", m.roles.items)
+	}
+	if m.roles.selected() != "storage.objectAdmin" || len(m.permissions.items) != 2 {
+		t.Errorf("Expected permissions of storage.objectAdmin, got %s %v", m.roles.selected(), m.permissions.items)
+	}
+
+	press(t, m, Key{Type: KeyDown})
+	if m.roles.selected() != "storage.objectViewer" || m.permissions.selected() != "storage.objects.get" {
+		t.Errorf("Expected permission pane to follow selection, got %s %v", m.roles.selected(), m.permissions.items)
+	}
+
+	press(t, m, Key{Type: KeyEsc})
+	if m.query != "" || len(m.roles.items) != 3 {
+		t.Errorf("Expected Esc to clear search, got query %q", m.query)
+	}
+
+	quit, _ := m.Update(Key{Type: KeyEsc})
+	if !quit {
+		t.Error("Expected Esc with empty search to quit")
+	}
+}
+
+func TestJumpToRolesWithPermission(t *testing.T) {
+	m := newTestModel(t)
+
+	typeText(t, m, "objectViewer")
+	press(t, m, Key{Type: KeyTab}, Key{Type: KeyEnter})
+
+	if m.view != viewPermissionRoles || m.permission != "storage.objects.get" {
+		t.Fatalf("Expected roles with storage.objects.get, got view %d permission %q", m.view, m.permission)
+	}
+	if len(m.permissionRoles.items) != 2 {
+		t.Errorf("Expected 2 roles with permission, got %v", m.permissionRoles.items)
+	}
+
+	// opening a role outside the current search clears the search
+	press(t, m, Key{Type: KeyEnter})
+	if m.view != viewRoles || m.roles.selected() != "storage.objectAdmin" || m.query != "" {
+		t.Errorf("Expected storage.objectAdmin to be selected, got %s (query %q)", m.roles.selected(), m.query)
+	}
+}
+
+func TestCompareMarkedRoles(t *testing.T) {
+	m := newTestModel(t)
+
+	typeText(t, m, "storage")
+	press(t, m, Key{Type: KeyCtrlS}, Key{Type: KeyDown}, Key{Type: KeyCtrlS})
+
+	if m.view != viewCompare || m.comparison == nil {
+		t.Fatalf("Expected compare view after marking 2 roles")
+	}
+	if len(m.comparison.Common) != 1 || m.comparison.Common[0] != "storage.objects.get" {
+		t.Errorf("Expected common storage.objects.get, got %v", m.comparison.Common)
+	}
+
+	screen := m.View(120, 20)
+	for _, expected := range []string{"Only in storage.objectAdmin", "storage.objects.delete", "storage.objects.list"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("Expected compare view to contain %q", expected)
+		}
+	}
+
+	press(t, m, Key{Type: KeyEsc})
+	if m.view != viewRoles {
+		t.Error("Expected Esc to return to role list")
+	}
+}
+
+func TestViewFitsTerminal(t *testing.T) {
+	m := newTestModel(t)
+
+	width, height := 60, 10
+	lines := strings.Split(m.View(width, height), "\r\n")
+	if len(lines) != height {
+		t.Errorf("Expected %d lines, got %d", height, len(lines))
+	}
+	for i, line := range lines {
+		if n := visibleLen(line); n > width {
+			t.Errorf("Line %d is %d wide, expected at most %d: %q", i, n, width, line)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kborovik/gcp-iam/db"
+	"golang.org/x/term"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	exitAltScreen  = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+
+	// resizePollInterval is how often the terminal size is checked for changes
+	resizePollInterval = 250 * time.Millisecond
+
+	// inputPollInterval is how long the input reader waits for input before checking
+	// whether the explorer has exited
+	inputPollInterval = 100 * time.Millisecond
+)
+
+// errReaderStopped is returned by readInput once done is closed
+var errReaderStopped = errors.New("input reader stopped")
+
+// readInput reads from in as soon as input is available. It only reads when input is
+// waiting, so once done is closed it returns without consuming input meant for whoever
+// reads in next, such as the shell the explorer was started from.
+func readInput(in *os.File, buf []byte, done <-chan struct{}) (int, error) {
+	for {
+		select {
+		case <-done:
+			return 0, errReaderStopped
+		default:
+		}
+
+		ready, err := waitInput(in)
+		if err != nil {
+			return 0, err
+		}
+		if ready {
+			return in.Read(buf)
+		}
+	}
+}
+
+// Run starts the interactive explorer on the terminal attached to in and out.
+// It returns when the user quits or ctx is cancelled.
+func Run(ctx context.Context, database *db.DB, in *os.File, out io.Writer) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("tui requires an interactive terminal")
+	}
+
+	model, err := NewModel(database)
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to enable raw mode: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Fprint(out, enterAltScreen)
+	defer fmt.Fprint(out, exitAltScreen)
+
+	keys := make(chan []Key)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		buf := make([]byte, 256)
+		for {
+			n, err := readInput(in, buf, done)
+			if errors.Is(err, errReaderStopped) {
+				return
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case keys <- ParseKeys(buf[:n]):
+			case <-done:
+				return
+			}
+		}
+	}()
+	// Stop the reader before the terminal is restored so it never reads past the explorer
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	width, height := terminalSize(fd)
+	render := func() {
+		fmt.Fprint(out, clearScreen+model.View(width, height))
+	}
+	render()
+
+	ticker := time.NewTicker(resizePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return fmt.Errorf("failed to read input: %w", err)
+		case <-ticker.C:
+			if w, h := terminalSize(fd); w != width || h != height {
+				width, height = w, h
+				render()
+			}
+		case batch := <-keys:
+			for _, key := range batch {
+				quit, err := model.Update(key)
+				if err != nil {
+					model.status = err.Error()
+				}
+				if quit {
+					return nil
+				}
+			}
+			render()
+		}
+	}
+}
+
+func terminalSize(fd int) (int, int) {
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return 80, 24
+	}
+	return width, height
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/kborovik/gcp-iam/db"
 	"google.golang.org/api/iam/v1"
@@ -42,11 +43,15 @@ func (u *Updater) UpdateRoles(ctx context.Context) error {
 
 	fmt.Printf("Fetched %d roles from GCP\n", len(roles))
 
-	err = u.updateDatabase(roles)
+	err = u.updateDatabase(ctx, roles)
 	if err != nil {
 		return fmt.Errorf("failed to update database: %w", err)
 	}
 
+	if err := u.recordUpdate(ctx, db.ResourceRoles); err != nil {
+		return err
+	}
+
 	fmt.Println("Successfully updated IAM roles and permissions")
 	return nil
 }
@@ -58,24 +63,60 @@ func (u *Updater) UpdatePermissions(ctx context.Context, roleName string) error
 		return fmt.Errorf("failed to fetch permissions for role %s: %w", roleName, err)
 	}
 
-	// Insert permissions into database and link them to the role
-	for _, permName := range permissions {
-		// Create permission record with role linkage
-		perm := &db.Permission{
-			Permission: permName,
-			Role:       roleName,
-		}
-
-		err = u.db.InsertPermission(perm)
-		if err != nil {
-			log.Printf("Warning: failed to insert permission %s for role %s: %v", permName, roleName, err)
-		}
+	// Replace the role's permission set in one transaction so an interrupted update
+	// never leaves a role with a partial or stale permission list
+	err = u.db.ReplaceRolePermissionsContext(ctx, roleName, permissions)
+	if err != nil {
+		return fmt.Errorf("failed to store permissions for role %s: %w", roleName, err)
 	}
 
 	log.Printf("Updated %d permissions for role %s", len(permissions), roleName)
 	return nil
 }
 
+// UpdateMissingPermissions fetches permissions for every role that has none stored yet.
+// It stops at the first cancellation of ctx; since each role is stored atomically,
+// running it again resumes with the remaining roles. The permissions update time is
+// not recorded because the permissions of the other roles are left as they were.
+func (u *Updater) UpdateMissingPermissions(ctx context.Context) error {
+	fmt.Println("Identifying roles needing permission updates...")
+	rolesToUpdate, err := u.db.GetRolesNeedingPermissionUpdateContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get roles needing updates: %w", err)
+	}
+
+	if len(rolesToUpdate) == 0 {
+		fmt.Println("No roles need permission updates - all roles are up to date")
+		return nil
+	}
+
+	fmt.Printf("Updating permissions for %d roles that need updates...\n", len(rolesToUpdate))
+	_, err = u.updateRolePermissions(ctx, rolesToUpdate)
+	return err
+}
+
+// RefreshPermissions re-fetches the permissions of every role, including roles that already
+// have permissions stored, and records the permissions update time once all of them were fetched.
+// Like UpdateMissingPermissions it stops at the first cancellation of ctx.
+func (u *Updater) RefreshPermissions(ctx context.Context) error {
+	roles, err := u.db.GetAllRolesContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	fmt.Printf("Refreshing permissions for %d roles...\n", len(roles))
+	failed, err := u.updateRolePermissions(ctx, roles)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		fmt.Printf("Warning: permissions of %d roles were not refreshed; run the update again to retry\n", failed)
+		return nil
+	}
+
+	return u.recordUpdate(ctx, db.ResourcePermissions)
+}
+
 // UpdateServices fetches all Google Cloud services and stores them in the database
 func (u *Updater) UpdateServices(ctx context.Context) error {
 	fmt.Println("Updating Google Cloud services...")
@@ -87,23 +128,36 @@ func (u *Updater) UpdateServices(ctx context.Context) error {
 
 	fmt.Printf("Fetched %d services from GCP\n", len(services))
 
-	// Update database with services
-	successCount := 0
-	for _, service := range services {
-		err = u.db.InsertService(&service)
-		if err != nil {
-			log.Printf("Warning: failed to insert service %s: %v", service.Name, err)
-			continue
-		}
-		successCount++
+	// Update database with services in one transaction
+	err = u.db.UpsertServicesContext(ctx, services)
+	if err != nil {
+		return fmt.Errorf("failed to store services: %w", err)
+	}
+
+	if err := u.recordUpdate(ctx, db.ResourceServices); err != nil {
+		return err
 	}
 
-	fmt.Printf("Successfully inserted %d services into database\n", successCount)
+	fmt.Printf("Successfully inserted %d services into database\n", len(services))
 
 	fmt.Println("Successfully updated Google Cloud services")
 	return nil
 }
 
+// NeedsUpdate reports whether any of resources was never updated or last updated more than maxAge ago
+func (u *Updater) NeedsUpdate(ctx context.Context, maxAge time.Duration, resources ...string) (bool, error) {
+	for _, resource := range resources {
+		last, err := u.db.LastUpdateContext(ctx, resource)
+		if err != nil {
+			return false, fmt.Errorf("failed to get last update of %s: %w", resource, err)
+		}
+		if last.IsZero() || time.Since(last) > maxAge {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // =============================================================================
 // PRIVATE IMPLEMENTATION - Helper Functions
 // =============================================================================
@@ -140,6 +194,9 @@ func (u *Updater) fetchRoles(ctx context.Context) ([]db.Role, error) {
 	})
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("authentication failed accessing Google Cloud IAM API.\nTo fix authentication issues, run: gcloud auth login --update-adc")
 	}
 
@@ -161,22 +218,45 @@ func (u *Updater) fetchPermissions(ctx context.Context, roleName string) ([]stri
 
 	role, err := service.Roles.Get(apiRoleName).Context(ctx).Do()
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("authentication failed accessing Google Cloud IAM API for role %s.\nTo fix authentication issues, run: gcloud auth login --update-adc", roleName)
 	}
 
 	return role.IncludedPermissions, nil
 }
 
-// updateDatabase stores roles in the database
-func (u *Updater) updateDatabase(roles []db.Role) error {
-	for _, role := range roles {
-		err := u.db.InsertRole(&role)
-		if err != nil {
-			log.Printf("Warning: failed to create role %s: %v", role.Name, err)
-			continue
+// updateDatabase stores roles in the database in a single transaction
+func (u *Updater) updateDatabase(ctx context.Context, roles []db.Role) error {
+	return u.db.UpsertRolesContext(ctx, roles)
+}
+
+// updateRolePermissions fetches and stores the permissions of roles, returning how many
+// roles failed. A failing role is reported and skipped; cancellation of ctx stops the update.
+func (u *Updater) updateRolePermissions(ctx context.Context, roles []db.Role) (failed int, err error) {
+	for i, role := range roles {
+		if err := ctx.Err(); err != nil {
+			return failed, fmt.Errorf("update interrupted after %d of %d roles: %w", i, len(roles), err)
+		}
+
+		fmt.Printf("Updating permissions for role %d/%d: %s\n", i+1, len(roles), role.Name)
+		if err := u.UpdatePermissions(ctx, role.Name); err != nil {
+			if ctx.Err() != nil {
+				return failed, fmt.Errorf("update interrupted after %d of %d roles: %w", i, len(roles), ctx.Err())
+			}
+			fmt.Printf("Warning: failed to update permissions for role %s: %v\n", role.Name, err)
+			failed++
 		}
 	}
+	return failed, nil
+}
 
+// recordUpdate stores the current time as the last successful update of resource
+func (u *Updater) recordUpdate(ctx context.Context, resource string) error {
+	if err := u.db.SetLastUpdateContext(ctx, resource, time.Now()); err != nil {
+		return fmt.Errorf("failed to record update time of %s: %w", resource, err)
+	}
 	return nil
 }
 
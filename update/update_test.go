@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kborovik/gcp-iam/db"
 )
@@ -95,7 +96,7 @@ func TestUpdateDatabase(t *testing.T) {
 		},
 	}
 
-	err = updater.updateDatabase(testRoles)
+	err = updater.updateDatabase(context.Background(), testRoles)
 	if err != nil {
 		t.Fatalf("Failed to update database: %v", err)
 	}
@@ -319,3 +320,57 @@ func TestUpdateServices(t *testing.T) {
 		}
 	}
 }
+
+func TestNeedsUpdate(t *testing.T) {
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	updater := New(database)
+
+	if needs, err := updater.NeedsUpdate(ctx, time.Hour, db.ResourceRoles); err != nil || !needs {
+		t.Errorf("Expected never updated roles to need an update, got %t (%v)", needs, err)
+	}
+
+	if err := updater.recordUpdate(ctx, db.ResourceRoles); err != nil {
+		t.Fatalf("Failed to record update: %v", err)
+	}
+	if needs, err := updater.NeedsUpdate(ctx, time.Hour, db.ResourceRoles); err != nil || needs {
+		t.Errorf("Expected fresh roles not to need an update, got %t (%v)", needs, err)
+	}
+
+	if err := database.SetLastUpdate(db.ResourcePermissions, time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Failed to set last update: %v", err)
+	}
+	if needs, err := updater.NeedsUpdate(ctx, 24*time.Hour, db.ResourceRoles, db.ResourcePermissions); err != nil || !needs {
+		t.Errorf("Expected stale permissions to need an update, got %t (%v)", needs, err)
+	}
+}
+
+func TestPermissionsUpdateRecordedOnlyAfterRefresh(t *testing.T) {
+	database, err := db.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	updater := New(database)
+
+	if err := updater.UpdateMissingPermissions(ctx); err != nil {
+		t.Fatalf("Failed to update missing permissions: %v", err)
+	}
+	if last, err := database.LastUpdate(db.ResourcePermissions); err != nil || !last.IsZero() {
+		t.Errorf("Expected no permissions update to be recorded without fetching, got %v (%v)", last, err)
+	}
+
+	if err := updater.RefreshPermissions(ctx); err != nil {
+		t.Fatalf("Failed to refresh permissions: %v", err)
+	}
+	if last, err := database.LastUpdate(db.ResourcePermissions); err != nil || last.IsZero() {
+		t.Errorf("Expected refresh to record the permissions update, got %v (%v)", last, err)
+	}
+}